@@ -0,0 +1,229 @@
+// Package access decides who may use the bot and the web API, and what they
+// may do. Users are on an allowlist with one of three roles; ADMIN_USER_ID is
+// a permanent owner that cannot be removed or demoted.
+package access
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// Role is a user's level of access
+type Role string
+
+const (
+	// RoleOwner can do everything, including managing the access list
+	RoleOwner Role = "owner"
+	// RoleOperator manages servers and triggers updates
+	RoleOperator Role = "operator"
+	// RoleViewer sees servers, status and history but changes nothing
+	RoleViewer Role = "viewer"
+)
+
+// Action is a class of operations checked against a role
+type Action string
+
+const (
+	// ActionView covers listing servers, status, containers, metrics, jobs and history
+	ActionView Action = "view"
+	// ActionUpdate covers triggering Watchtower updates
+	ActionUpdate Action = "update"
+	// ActionManage covers changing servers, schedules, freezes and webhooks
+	ActionManage Action = "manage"
+	// ActionAdmin covers managing the access list
+	ActionAdmin Action = "admin"
+)
+
+var permissions = map[Role][]Action{
+	RoleOwner:    {ActionView, ActionUpdate, ActionManage, ActionAdmin},
+	RoleOperator: {ActionView, ActionUpdate, ActionManage},
+	RoleViewer:   {ActionView},
+}
+
+var (
+	ErrNotMember      = errors.New("user is not on the access list")
+	ErrForbidden      = errors.New("role does not allow this action")
+	ErrBootstrapOwner = errors.New("the ADMIN_USER_ID owner cannot be changed")
+	ErrLastOwner      = errors.New("at least one owner must remain")
+)
+
+// ParseRole validates a role name
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := permissions[role]; !ok {
+		return "", fmt.Errorf("unknown role %q: use owner, operator or viewer", s)
+	}
+	return role, nil
+}
+
+// ParseAction validates an action name
+func ParseAction(s string) (Action, error) {
+	for _, a := range permissions[RoleOwner] {
+		if string(a) == s {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown action %q: use view, update, manage or admin", s)
+}
+
+// Can reports whether the role allows action
+func (r Role) Can(action Action) bool {
+	for _, a := range permissions[r] {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ForbiddenError reports an action the user's role does not allow
+type ForbiddenError struct {
+	Role   Role
+	Action Action
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("%s users cannot %s", e.Role, e.Action)
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return ErrForbidden
+}
+
+// Store persists the access list; *servers.ServerManager implements it
+type Store interface {
+	Members() []servers.Member
+	Member(userID int64) (servers.Member, bool)
+	SetMember(member servers.Member) error
+	RemoveMember(userID int64) error
+}
+
+// Controller answers access questions for the bot and the web API
+type Controller struct {
+	store Store
+	// owner is ADMIN_USER_ID, 0 if unset
+	owner int64
+}
+
+// NewController checks access against store, with owner (if non-zero) as a
+// permanent owner. With no owner and an empty list everybody is an owner,
+// which matches the behaviour of an unset ADMIN_USER_ID.
+func NewController(store Store, owner int64) *Controller {
+	return &Controller{store: store, owner: owner}
+}
+
+// Open reports whether access is unrestricted (no owner and no members)
+func (c *Controller) Open() bool {
+	return c.owner == 0 && len(c.store.Members()) == 0
+}
+
+// Role returns the user's role and whether they have access at all
+func (c *Controller) Role(userID int64) (Role, bool) {
+	if userID != 0 && userID == c.owner {
+		return RoleOwner, true
+	}
+	if m, ok := c.store.Member(userID); ok {
+		return Role(m.Role), true
+	}
+	if c.Open() {
+		return RoleOwner, true
+	}
+	return "", false
+}
+
+// Check returns nil if userID may perform action, ErrNotMember if they have
+// no access and a *ForbiddenError if their role does not allow it
+func (c *Controller) Check(userID int64, action Action) error {
+	role, ok := c.Role(userID)
+	if !ok {
+		return ErrNotMember
+	}
+	if !role.Can(action) {
+		return &ForbiddenError{Role: role, Action: action}
+	}
+	return nil
+}
+
+// Entry is a user with access, as listed by /users
+type Entry struct {
+	servers.Member
+	// Bootstrap marks the ADMIN_USER_ID owner
+	Bootstrap bool
+}
+
+// Members lists everybody with access, the ADMIN_USER_ID owner first
+func (c *Controller) Members() []Entry {
+	var list []Entry
+	if c.owner != 0 {
+		list = append(list, Entry{Member: servers.Member{UserID: c.owner, Role: string(RoleOwner)}, Bootstrap: true})
+	}
+	for _, m := range c.store.Members() {
+		if m.UserID != c.owner {
+			list = append(list, Entry{Member: m})
+		}
+	}
+	return list
+}
+
+// Grant gives userID a role, adding them to the list if needed. by is the
+// owner making the change.
+func (c *Controller) Grant(by, userID int64, role Role) error {
+	if err := c.Check(by, ActionAdmin); err != nil {
+		return err
+	}
+	if userID == c.owner {
+		return ErrBootstrapOwner
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	if c.Open() {
+		// The first entry ends open access, so keep whoever made it
+		if err := c.store.SetMember(servers.Member{UserID: by, Role: string(RoleOwner), AddedBy: by, AddedAt: time.Now()}); err != nil {
+			return err
+		}
+	}
+	if current, ok := c.store.Member(userID); ok && Role(current.Role) == RoleOwner && role != RoleOwner && c.lastOwner(userID) {
+		return ErrLastOwner
+	}
+
+	member := servers.Member{UserID: userID, Role: string(role), AddedBy: by, AddedAt: time.Now()}
+	if current, ok := c.store.Member(userID); ok {
+		member.AddedBy, member.AddedAt = current.AddedBy, current.AddedAt
+	}
+	return c.store.SetMember(member)
+}
+
+// Revoke removes userID from the access list
+func (c *Controller) Revoke(by, userID int64) error {
+	if err := c.Check(by, ActionAdmin); err != nil {
+		return err
+	}
+	if userID == c.owner {
+		return ErrBootstrapOwner
+	}
+	current, ok := c.store.Member(userID)
+	if !ok {
+		return ErrNotMember
+	}
+	if Role(current.Role) == RoleOwner && c.lastOwner(userID) {
+		return ErrLastOwner
+	}
+	return c.store.RemoveMember(userID)
+}
+
+// lastOwner reports whether userID is the only owner left
+func (c *Controller) lastOwner(userID int64) bool {
+	if c.owner != 0 {
+		return false
+	}
+	for _, m := range c.store.Members() {
+		if m.UserID != userID && Role(m.Role) == RoleOwner {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package access
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+type fakeStore struct {
+	members map[int64]servers.Member
+}
+
+func newFakeStore(members ...servers.Member) *fakeStore {
+	s := &fakeStore{members: make(map[int64]servers.Member)}
+	for _, m := range members {
+		s.members[m.UserID] = m
+	}
+	return s
+}
+
+func (s *fakeStore) Members() []servers.Member {
+	var list []servers.Member
+	for _, m := range s.members {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UserID < list[j].UserID })
+	return list
+}
+
+func (s *fakeStore) Member(userID int64) (servers.Member, bool) {
+	m, ok := s.members[userID]
+	return m, ok
+}
+
+func (s *fakeStore) SetMember(m servers.Member) error {
+	s.members[m.UserID] = m
+	return nil
+}
+
+func (s *fakeStore) RemoveMember(userID int64) error {
+	delete(s.members, userID)
+	return nil
+}
+
+func TestRolePermissions(t *testing.T) {
+	cases := []struct {
+		role    Role
+		allowed []Action
+		denied  []Action
+	}{
+		{RoleOwner, []Action{ActionView, ActionUpdate, ActionManage, ActionAdmin}, nil},
+		{RoleOperator, []Action{ActionView, ActionUpdate, ActionManage}, []Action{ActionAdmin}},
+		{RoleViewer, []Action{ActionView}, []Action{ActionUpdate, ActionManage, ActionAdmin}},
+	}
+	for _, c := range cases {
+		for _, a := range c.allowed {
+			if !c.role.Can(a) {
+				t.Errorf("%s should be able to %s", c.role, a)
+			}
+		}
+		for _, a := range c.denied {
+			if c.role.Can(a) {
+				t.Errorf("%s should not be able to %s", c.role, a)
+			}
+		}
+	}
+
+	if _, err := ParseRole("admin"); err == nil {
+		t.Error("expected unknown role to be rejected")
+	}
+}
+
+func TestControllerCheck(t *testing.T) {
+	c := NewController(newFakeStore(
+		servers.Member{UserID: 2, Role: string(RoleOperator)},
+		servers.Member{UserID: 3, Role: string(RoleViewer)},
+	), 1)
+
+	if err := c.Check(1, ActionAdmin); err != nil {
+		t.Errorf("ADMIN_USER_ID must be an owner: %v", err)
+	}
+	if err := c.Check(2, ActionUpdate); err != nil {
+		t.Errorf("operator should update: %v", err)
+	}
+	if err := c.Check(3, ActionView); err != nil {
+		t.Errorf("viewer should view: %v", err)
+	}
+
+	err := c.Check(3, ActionUpdate)
+	var forbidden *ForbiddenError
+	if !errors.Is(err, ErrForbidden) || !errors.As(err, &forbidden) || forbidden.Role != RoleViewer {
+		t.Errorf("expected viewer update to be forbidden, got %v", err)
+	}
+	if err := c.Check(4, ActionView); !errors.Is(err, ErrNotMember) {
+		t.Errorf("expected ErrNotMember for strangers, got %v", err)
+	}
+}
+
+func TestControllerGrantRevoke(t *testing.T) {
+	store := newFakeStore()
+	c := NewController(store, 1)
+
+	if err := c.Grant(1, 2, RoleViewer); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if err := c.Grant(2, 3, RoleViewer); !errors.Is(err, ErrForbidden) {
+		t.Errorf("viewers must not grant access, got %v", err)
+	}
+	if err := c.Grant(1, 1, RoleViewer); !errors.Is(err, ErrBootstrapOwner) {
+		t.Errorf("expected ErrBootstrapOwner, got %v", err)
+	}
+	if err := c.Revoke(1, 1); !errors.Is(err, ErrBootstrapOwner) {
+		t.Errorf("expected ErrBootstrapOwner, got %v", err)
+	}
+
+	if err := c.Grant(1, 2, RoleOperator); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if role, _ := c.Role(2); role != RoleOperator {
+		t.Errorf("expected operator, got %s", role)
+	}
+	if err := c.Revoke(1, 2); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, ok := c.Role(2); ok {
+		t.Error("revoked user still has access")
+	}
+	if err := c.Revoke(1, 2); !errors.Is(err, ErrNotMember) {
+		t.Errorf("expected ErrNotMember, got %v", err)
+	}
+}
+
+func TestControllerOpenAccess(t *testing.T) {
+	store := newFakeStore()
+	c := NewController(store, 0)
+
+	if !c.Open() {
+		t.Fatal("expected open access without owner or members")
+	}
+	if err := c.Check(42, ActionAdmin); err != nil {
+		t.Errorf("open access should allow everything: %v", err)
+	}
+
+	// The first grant closes access but keeps its author as owner
+	if err := c.Grant(42, 7, RoleViewer); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if c.Open() {
+		t.Error("access should no longer be open")
+	}
+	if role, ok := c.Role(42); !ok || role != RoleOwner {
+		t.Errorf("expected the granting user to stay owner, got %q %v", role, ok)
+	}
+	if _, ok := c.Role(99); ok {
+		t.Error("strangers must be locked out once the list is in use")
+	}
+
+	// Without ADMIN_USER_ID the last owner cannot step down
+	if err := c.Grant(42, 42, RoleViewer); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("expected ErrLastOwner, got %v", err)
+	}
+	if err := c.Revoke(42, 42); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("expected ErrLastOwner, got %v", err)
+	}
+}
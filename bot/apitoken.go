@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+const apiTokenUsage = "🔑 *API tokens*\n\n" +
+	"`/api_token create <name> <server[,server]|all> [action[,action]]` - Issue a token (private chat only)\n" +
+	"`/api_token list` - Your tokens\n" +
+	"`/api_token revoke <id>` - Revoke a token\n\n" +
+	"*Actions:* `view`, `update` (default) and `manage`. A token works on the servers of the current workspace " +
+	"and never does more than your role allows."
+
+func (wb *WatchtowerBot) handleAPIToken(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || args[0] == "list" {
+		wb.apiTokenList(message)
+		return
+	}
+
+	switch {
+	case args[0] == "create" && (len(args) == 3 || len(args) == 4):
+		actions := "update"
+		if len(args) == 4 {
+			actions = args[3]
+		}
+		wb.apiTokenCreate(message, args[1], args[2], actions)
+	case args[0] == "revoke" && len(args) == 2:
+		if err := wb.serverManager.RevokeAPIToken(message.From.ID, args[1]); err != nil {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error revoking token: `%v`", err))
+			return
+		}
+		log.Printf("🔑 User %d revoked API token %s", message.From.ID, args[1])
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("🗑 Token `%s` revoked.", args[1]))
+	default:
+		wb.sendMessage(message.Chat.ID, apiTokenUsage)
+	}
+}
+
+func (wb *WatchtowerBot) apiTokenCreate(message *tgbotapi.Message, name, serverArg, actionArg string) {
+	// The token is printed in the chat; a group would leak it to everyone there
+	if !message.Chat.IsPrivate() {
+		wb.sendMessage(message.Chat.ID, "🔒 Create API tokens in a private chat with the bot.")
+		return
+	}
+
+	nicknames, actions, err := parseTokenScope(serverArg, actionArg)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ %v\n\n%s", err, apiTokenUsage))
+		return
+	}
+	for _, a := range actions {
+		if !wb.allowed(message.Chat.ID, message.From.ID, access.Action(a)) {
+			return
+		}
+	}
+
+	raw, token, err := wb.serverManager.CreateAPIToken(message.From.ID, name, nicknames, actions)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error creating token: `%v`", err))
+		return
+	}
+	log.Printf("🔑 User %d created API token %s (%s) for servers %v: %v",
+		message.From.ID, token.ID, token.Name, token.Servers, token.Actions)
+
+	example := "<server>"
+	if len(token.Servers) > 0 {
+		example = token.Servers[0]
+	}
+	wb.sendMessage(message.Chat.ID, fmt.Sprintf("✅ *API token* `%s` *created*\n\n"+
+		"`%s`\n\n"+
+		"🌐 *Servers:* %s\n"+
+		"⚙️ *Actions:* %s\n\n"+
+		"Store it as a CI secret and trigger an update with:\n"+
+		"`curl -fsS -X POST -H \"Authorization: Bearer $WTM_TOKEN\" %s/api/servers/%s/update`\n\n"+
+		"🔐 The token is shown only once. Revoke it with `/api_token revoke %s`.",
+		token.Name, raw, tokenServers(token), strings.Join(token.Actions, ", "), wb.apiBaseURL(), example, token.ID))
+}
+
+func (wb *WatchtowerBot) apiTokenList(message *tgbotapi.Message) {
+	tokens := wb.serverManager.APITokens(message.From.ID)
+	if len(tokens) == 0 {
+		wb.sendMessage(message.Chat.ID, "📭 No API tokens.\n\n"+apiTokenUsage)
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString("🔑 *Your API tokens*\n")
+	for _, t := range tokens {
+		lastUsed := "never"
+		if !t.LastUsed.IsZero() {
+			lastUsed = t.LastUsed.UTC().Format("2006-01-02 15:04 UTC")
+		}
+		response.WriteString(fmt.Sprintf("\n`%s` - `%s`\n🌐 %s · ⚙️ %s\n🏢 `%s` · 🕒 last used %s\n",
+			t.ID, t.Name, tokenServers(t), strings.Join(t.Actions, ", "), t.Workspace, lastUsed))
+	}
+	wb.sendMessage(message.Chat.ID, response.String())
+}
+
+// parseTokenScope reads "home,vps" or "all" and "update,view"
+func parseTokenScope(serverArg, actionArg string) ([]string, []string, error) {
+	var nicknames []string
+	if serverArg != "all" {
+		for _, n := range strings.Split(serverArg, ",") {
+			if err := servers.ValidateNickname(n); err != nil {
+				return nil, nil, fmt.Errorf("`%s`: %v", n, err)
+			}
+			nicknames = append(nicknames, n)
+		}
+	}
+
+	var actions []string
+	for _, a := range strings.Split(actionArg, ",") {
+		action, err := access.ParseAction(a)
+		if err != nil {
+			return nil, nil, err
+		}
+		if action == access.ActionAdmin {
+			return nil, nil, errors.New("API tokens can't manage the access list")
+		}
+		actions = append(actions, string(action))
+	}
+	return nicknames, actions, nil
+}
+
+func tokenServers(t servers.APIToken) string {
+	if len(t.Servers) == 0 {
+		return "all servers"
+	}
+	return "`" + strings.Join(t.Servers, "`, `") + "`"
+}
+
+// apiBaseURL is the bot's public HTTP address, taken from WEBAPP_URL
+func (wb *WatchtowerBot) apiBaseURL() string {
+	if u, err := url.Parse(wb.webAppURL); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return "https://<bot-host>"
+}
@@ -0,0 +1,31 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTokenScope(t *testing.T) {
+	nicknames, actions, err := parseTokenScope("home,vps", "update,view")
+	if err != nil {
+		t.Fatalf("parseTokenScope: %v", err)
+	}
+	if !reflect.DeepEqual(nicknames, []string{"home", "vps"}) || !reflect.DeepEqual(actions, []string{"update", "view"}) {
+		t.Errorf("unexpected scope: %v %v", nicknames, actions)
+	}
+
+	if nicknames, _, err := parseTokenScope("all", "update"); err != nil || nicknames != nil {
+		t.Errorf("expected all servers, got %v, %v", nicknames, err)
+	}
+
+	for _, c := range [][2]string{
+		{"home,", "update"},
+		{"home", "deploy"},
+		{"home", "admin"},
+		{"home", ""},
+	} {
+		if _, _, err := parseTokenScope(c[0], c[1]); err == nil {
+			t.Errorf("parseTokenScope(%q, %q): expected an error", c[0], c[1])
+		}
+	}
+}
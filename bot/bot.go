@@ -1,19 +1,47 @@
 package bot
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/jobs"
 	"github.com/kfilin/watchtower-masterbot/servers"
 )
 
+// Reply keyboard buttons
+const (
+	menuAddServer    = "🚀 Add Server"
+	menuSwitchServer = "🔄 Switch Server"
+	menuListServers  = "📋 List Servers"
+)
+
+func isMenuButton(text string) bool {
+	return text == menuAddServer || text == menuSwitchServer || text == menuListServers
+}
+
 // WatchtowerBot matches the receiver name in your handlers.go
 type WatchtowerBot struct {
 	API           *tgbotapi.BotAPI
-	AdminID       int64
+	access        *access.Controller
 	serverManager *servers.ServerManager
 	webAppURL     string
+	conversations *conversations
+	callbackKey   []byte
+	inflight      *inflight
+	jobs          *jobs.Manager
+	dispatcher    *dispatcher
+	background    sync.WaitGroup
+
+	// ctx is the parent of every Watchtower call; Stop cancels it
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // GetManager returns the internal ServerManager
@@ -22,7 +50,8 @@ func (wb *WatchtowerBot) GetManager() *servers.ServerManager {
 }
 
 // NewBot initializes the bot without panicking
-func NewBot(token string, adminID int64, encryptionKey string, webAppURL string) (*WatchtowerBot, error) {
+// acl decides who may use it; workers is how many chats are served concurrently
+func NewBot(token string, acl *access.Controller, mgr *servers.ServerManager, webAppURL string, workers int) (*WatchtowerBot, error) {
 	if token == "" {
 		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN is missing")
 	}
@@ -34,18 +63,38 @@ func NewBot(token string, adminID int64, encryptionKey string, webAppURL string)
 
 	api.Debug = false
 
-	// Initialize the ServerManager with encryption key
-	mgr := servers.NewManager(encryptionKey)
-
-	return &WatchtowerBot{
+	ctx, cancel := context.WithCancel(context.Background())
+	wb := &WatchtowerBot{
 		API:           api,
-		AdminID:       adminID,
+		access:        acl,
 		serverManager: mgr,
 		webAppURL:     webAppURL,
-	}, nil
+		conversations: newConversations(conversationTimeout),
+		callbackKey:   hmacKey(token, "callback-data"),
+		inflight:      newInflight(),
+		jobs:          jobs.NewManager(jobs.DefaultRetention),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	wb.dispatcher = newDispatcher(workers, wb.dispatch)
+	return wb, nil
+}
+
+// hmacKey derives a purpose-specific signing key from the bot token
+func hmacKey(token, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
 }
 
-// Start begins the update loop
+// How long aborted work gets to wind down once the shutdown timeout is hit
+const abortGrace = 3 * time.Second
+
+// Start begins the update loop.
+// Updates are handed to the dispatcher, which serves chats concurrently while
+// keeping each chat in order. /cancel additionally aborts the chat's in-flight
+// Watchtower calls as soon as it arrives so it isn't stuck behind the request
+// it is meant to stop.
 func (wb *WatchtowerBot) Start() {
 	log.Printf("🤖 Authorized on account %s", wb.API.Self.UserName)
 
@@ -55,19 +104,101 @@ func (wb *WatchtowerBot) Start() {
 	updates := wb.API.GetUpdatesChan(u)
 
 	for update := range updates {
-		if update.Message == nil {
-			continue
+		var chatID int64
+		if update.CallbackQuery != nil {
+			from := update.CallbackQuery.From
+			if _, ok := wb.access.Role(from.ID); !ok {
+				log.Printf("🔒 Security: Ignored callback from unauthorized user %d (%s)", from.ID, from.UserName)
+				continue
+			}
+			chatID = from.ID
+			if update.CallbackQuery.Message != nil {
+				chatID = update.CallbackQuery.Message.Chat.ID
+			}
+		} else {
+			if update.Message == nil {
+				continue
+			}
+
+			// Security Check
+			if _, ok := wb.access.Role(update.Message.From.ID); !ok {
+				log.Printf("🔒 Security: Ignored message from unauthorized user %d (%s)",
+					update.Message.From.ID, update.Message.From.UserName)
+				continue
+			}
+
+			chatID = update.Message.Chat.ID
+			if update.Message.Command() == "cancel" {
+				if n := wb.abortRequests(chatID); n > 0 {
+					log.Printf("✋ Aborted %d request(s) in chat %d", n, chatID)
+				}
+			}
+		}
+
+		if !wb.dispatcher.Submit(chatID, update) {
+			log.Printf("🛑 Dropped update %d for chat %d: shutting down", update.UpdateID, chatID)
 		}
+	}
+}
+
+// dispatch handles a single authorized update
+func (wb *WatchtowerBot) dispatch(update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		log.Printf("📥 Received callback: '%s' from %s", update.CallbackQuery.Data, update.CallbackQuery.From.UserName)
+		wb.handleCallback(update.CallbackQuery)
+		return
+	}
+
+	log.Printf("📥 Received message: '%s' from %s", update.Message.Text, update.Message.From.UserName)
+	wb.Handle(update)
+}
+
+// goBackground runs fn outside the dispatcher; Stop waits for it
+func (wb *WatchtowerBot) goBackground(fn func()) {
+	wb.background.Add(1)
+	go func() {
+		defer wb.background.Done()
+		fn()
+	}()
+}
 
-		// Security Check
-		if wb.AdminID != 0 && update.Message.From.ID != wb.AdminID {
-			log.Printf("🔒 Security: Ignored message from unauthorized user %d (%s)",
-				update.Message.From.ID, update.Message.From.UserName)
-			continue
+// Stop stops polling and waits for queued updates, update jobs and other
+// background work to finish. If ctx expires first, in-flight Watchtower calls
+// are aborted and given a short grace period to report.
+func (wb *WatchtowerBot) Stop(ctx context.Context) {
+	wb.API.StopReceivingUpdates()
+
+	if err := wb.drain(ctx); err != nil {
+		log.Printf("⏱️ Shutdown timeout reached, aborting in-flight Watchtower calls")
+		wb.cancel()
+
+		graceCtx, cancel := context.WithTimeout(context.Background(), abortGrace)
+		defer cancel()
+		if err := wb.drain(graceCtx); err != nil {
+			log.Printf("⚠️ Some bot work did not finish before exit")
+			return
 		}
+	}
+	wb.cancel()
+	log.Println("✅ Bot drained")
+}
 
-		log.Printf("📥 Received message: '%s' from %s", update.Message.Text, update.Message.From.UserName)
-		wb.Handle(update)
+func (wb *WatchtowerBot) drain(ctx context.Context) error {
+	if err := wb.dispatcher.Drain(ctx); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wb.jobs.Wait()
+		wb.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -77,17 +208,65 @@ func (wb *WatchtowerBot) Handle(update tgbotapi.Update) {
 	cmd := msg.Command()
 	text := msg.Text
 
+	// Plain replies belong to the chat's multi-step flow, if any;
+	// commands and menu buttons abandon it
+	interrupt := msg.IsCommand() || isMenuButton(text)
+	if !interrupt && wb.continueConversation(msg) {
+		return
+	}
+	if interrupt && cmd != "cancel" {
+		if name, ok := wb.cancelConversation(msg.Chat.ID); ok {
+			log.Printf("💬 '%s' interrupted %s flow in chat %d", text, name, msg.Chat.ID)
+		}
+	}
+
+	if !wb.allowed(msg.Chat.ID, msg.From.ID, messageAction(msg)) {
+		return
+	}
+
 	switch {
+	case cmd == "cancel":
+		wb.handleCancel(msg)
 	case cmd == "start":
 		wb.showMainMenu(msg.Chat.ID)
-	case cmd == "add_server" || text == "🚀 Add Server":
+	case cmd == "add_server" || text == menuAddServer:
 		wb.handleAddServer(msg)
-	case cmd == "servers" || text == "📋 List Servers":
+	case cmd == "servers" || text == menuListServers:
 		wb.handleListServers(msg)
-	case cmd == "server" || text == "🔄 Switch Server":
+	case cmd == "server" || text == menuSwitchServer:
 		wb.handleSwitchServer(msg)
+	case cmd == "remove_server":
+		wb.handleRemoveServer(msg)
+	case cmd == "rename_server":
+		wb.handleRenameServer(msg)
+	case cmd == "edit_server":
+		wb.handleEditServer(msg)
 	case cmd == "wt_update":
 		wb.handleUpdate(msg)
+	case cmd == "wt_update_all":
+		wb.handleUpdateAll(msg)
+	case cmd == "schedule":
+		wb.handleSchedule(msg)
+	case cmd == "freeze":
+		wb.handleFreeze(msg)
+	case cmd == "hook":
+		wb.handleHook(msg)
+	case cmd == "history":
+		wb.handleHistory(msg)
+	case cmd == "users":
+		wb.handleUsers(msg)
+	case cmd == "workspace":
+		wb.handleWorkspace(msg)
+	case cmd == "api_token":
+		wb.handleAPIToken(msg)
+	case cmd == "jobs":
+		wb.handleJobs(msg)
+	case cmd == "job":
+		wb.handleJob(msg)
+	case cmd == "containers":
+		wb.handleContainers(msg)
+	case cmd == "metrics":
+		wb.handleMetrics(msg)
 	case cmd == "terminal":
 		wb.handleTerminal(msg)
 	default:
@@ -105,11 +284,11 @@ func (wb *WatchtowerBot) sendMessage(chatID int64, text string) {
 	// Create persistent keyboard menu
 	keyboard := tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("🚀 Add Server"),
-			tgbotapi.NewKeyboardButton("🔄 Switch Server"),
+			tgbotapi.NewKeyboardButton(menuAddServer),
+			tgbotapi.NewKeyboardButton(menuSwitchServer),
 		),
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("📋 List Servers"),
+			tgbotapi.NewKeyboardButton(menuListServers),
 		),
 	)
 	msg.ReplyMarkup = keyboard
@@ -130,7 +309,21 @@ func (wb *WatchtowerBot) showMainMenu(chatID int64) {
 		"• `/add_server` - Add a new Watchtower server\n" +
 		"• `/servers` - List your managed servers\n" +
 		"• `/server` - Switch active server context\n" +
+		"• `/rename_server` - Rename a server\n" +
+		"• `/edit_server` - Change a server's URL or token\n" +
+		"• `/remove_server` - Remove a server\n" +
 		"• `/wt_update` - Trigger container updates\n" +
+		"• `/wt_update_all` - Update every server at once\n" +
+		"• `/jobs` - Recent update jobs (`/job <id>` for details)\n" +
+		"• `/history` - Past updates (`/history [server] [n]`)\n" +
+		"• `/schedule` - Run updates on a cron schedule\n" +
+		"• `/freeze` - Block updates during freeze windows\n" +
+		"• `/hook` - Receive Watchtower's own scan reports\n" +
+		"• `/containers` - List containers on a server\n" +
+		"• `/metrics` - Scan statistics and trends\n" +
+		"• `/workspace` - Share servers with a team\n" +
+		"• `/api_token` - Tokens for CI pipelines and scripts\n" +
+		"• `/users` - Who can use the bot (owners only)\n" +
 		"• `/terminal` - 📟 Access Advanced Terminal\n\n" +
 		"💡 *Quick Start:*\n" +
 		"1. Use `/add_server` to add your first server\n" +
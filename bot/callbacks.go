@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+)
+
+// Telegram rejects callback data longer than 64 bytes
+const maxCallbackData = 64
+
+// Length of the truncated, base64url-encoded callback signature
+const callbackSigLen = 8
+
+// callbackHandler handles a verified inline keyboard press
+type callbackHandler func(wb *WatchtowerBot, cq *tgbotapi.CallbackQuery, arg string)
+
+// callbackRoute is a handler and the access it needs
+type callbackRoute struct {
+	handle callbackHandler
+	need   access.Action
+}
+
+// callbackRoutes maps compact action codes to handlers
+var callbackRoutes = map[string]callbackRoute{
+	"ls":     {(*WatchtowerBot).cbListServers, access.ActionView},
+	"sv":     {(*WatchtowerBot).cbSelectServer, access.ActionView},
+	"up":     {(*WatchtowerBot).cbUpdateServer, access.ActionUpdate},
+	"st":     {(*WatchtowerBot).cbServerStatus, access.ActionView},
+	"hi":     {(*WatchtowerBot).cbServerHistory, access.ActionView},
+	"rm":     {(*WatchtowerBot).cbRemoveServer, access.ActionManage},
+	"cancel": {(*WatchtowerBot).cbCancel, access.ActionView},
+}
+
+// callbackFits reports whether a button for action on arg stays within
+// Telegram's limit. Telegram refuses a whole message if one button is too
+// long, so callers leave such buttons out.
+func callbackFits(action, arg string) bool {
+	return len(action)+len(arg)+2+callbackSigLen <= maxCallbackData
+}
+
+// callbackData encodes "<action>|<arg>|<sig>" for a button shown to userID.
+// The signature binds the data to the user so buttons can't be forged or
+// replayed by somebody else.
+func (wb *WatchtowerBot) callbackData(userID int64, action, arg string) string {
+	payload := action + "|" + arg
+	return payload + "|" + wb.signCallback(userID, payload)
+}
+
+// parseCallback verifies data and splits it into action and argument
+func (wb *WatchtowerBot) parseCallback(userID int64, data string) (action, arg string, ok bool) {
+	// Telegram never delivers more; anything longer wasn't built by us
+	if len(data) > maxCallbackData {
+		return "", "", false
+	}
+	i := strings.LastIndex(data, "|")
+	if i < 0 {
+		return "", "", false
+	}
+	payload, sig := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(wb.signCallback(userID, payload))) {
+		return "", "", false
+	}
+
+	action, arg, _ = strings.Cut(payload, "|")
+	return action, arg, true
+}
+
+func (wb *WatchtowerBot) signCallback(userID int64, payload string) string {
+	mac := hmac.New(sha256.New, wb.callbackKey)
+	mac.Write([]byte(strconv.FormatInt(userID, 10) + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:callbackSigLen]
+}
+
+// button builds an inline button carrying signed callback data. Arguments
+// of unbounded length, such as nicknames, must pass callbackFits first.
+func (wb *WatchtowerBot) button(userID int64, label, action, arg string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(label, wb.callbackData(userID, action, arg))
+}
+
+// handleCallback verifies and dispatches inline keyboard presses
+func (wb *WatchtowerBot) handleCallback(cq *tgbotapi.CallbackQuery) {
+	if cq.Message == nil {
+		wb.answerCallback(cq.ID, "")
+		return
+	}
+
+	action, arg, ok := wb.parseCallback(cq.From.ID, cq.Data)
+	if !ok {
+		log.Printf("🔒 Security: Rejected callback with invalid signature from %d: %q", cq.From.ID, cq.Data)
+		wb.answerCallback(cq.ID, "⚠️ This button has expired")
+		return
+	}
+
+	route, exists := callbackRoutes[action]
+	if !exists {
+		log.Printf("❓ Unknown callback action: %s", action)
+		wb.answerCallback(cq.ID, "")
+		return
+	}
+	if err := wb.access.Check(cq.From.ID, route.need); err != nil {
+		log.Printf("⛔ Denied callback %s to user %d: %v", action, cq.From.ID, err)
+		wb.answerCallback(cq.ID, "⛔ "+err.Error())
+		return
+	}
+
+	// Stop the button's loading spinner; handlers report through the message
+	wb.answerCallback(cq.ID, "")
+	route.handle(wb, cq, arg)
+}
+
+func (wb *WatchtowerBot) answerCallback(callbackID, text string) {
+	if _, err := wb.API.Request(tgbotapi.NewCallback(callbackID, text)); err != nil {
+		log.Printf("❌ Failed to answer callback: %v", err)
+	}
+}
+
+// editMessage replaces the text of a message and removes its inline keyboard
+func (wb *WatchtowerBot) editMessage(chatID int64, messageID int, text string) {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ParseMode = "Markdown"
+
+	if _, err := wb.API.Send(edit); err != nil {
+		log.Printf("❌ Failed to edit message %d in chat %d: %v", messageID, chatID, err)
+	}
+}
+
+// editMessageWithKeyboard replaces the text and inline keyboard of a message
+func (wb *WatchtowerBot) editMessageWithKeyboard(chatID int64, messageID int, text string, markup tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, markup)
+	edit.ParseMode = "Markdown"
+
+	if _, err := wb.API.Send(edit); err != nil {
+		log.Printf("❌ Failed to edit message %d in chat %d: %v", messageID, chatID, err)
+	}
+}
+
+func (wb *WatchtowerBot) deleteMessage(chatID int64, messageID int) {
+	if _, err := wb.API.Request(tgbotapi.NewDeleteMessage(chatID, messageID)); err != nil {
+		log.Printf("⚠️ Failed to delete message %d in chat %d: %v", messageID, chatID, err)
+	}
+}
+
+func (wb *WatchtowerBot) cbRemoveServer(cq *tgbotapi.CallbackQuery, nickname string) {
+	chatID, messageID := cq.Message.Chat.ID, cq.Message.MessageID
+
+	if err := wb.serverManager.RemoveServer(cq.From.ID, nickname); err != nil {
+		wb.editMessage(chatID, messageID, fmt.Sprintf("❌ Error removing server: `%v`", err))
+		return
+	}
+	wb.editMessage(chatID, messageID, fmt.Sprintf("🗑 Server `%s` removed.", nickname))
+}
+
+func (wb *WatchtowerBot) cbCancel(cq *tgbotapi.CallbackQuery, _ string) {
+	wb.editMessage(cq.Message.Chat.ID, cq.Message.MessageID, "✖️ Cancelled.")
+}
@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+func TestCallbackRoundTrip(t *testing.T) {
+	wb, _ := newTestBot(t, time.Minute)
+
+	for _, tc := range []struct{ action, arg string }{
+		{"sv", "home"},
+		{"ls", ""},
+		{"hi", "home|2"}, // the argument may contain the separator
+	} {
+		data := wb.callbackData(testOwner, tc.action, tc.arg)
+		action, arg, ok := wb.parseCallback(testOwner, data)
+		if !ok || action != tc.action || arg != tc.arg {
+			t.Errorf("parseCallback(%q) = %q, %q, %v", data, action, arg, ok)
+		}
+	}
+}
+
+func TestCallbackRejectsForgeries(t *testing.T) {
+	wb, _ := newTestBot(t, time.Minute)
+	data := wb.callbackData(testOwner, "rm", "home")
+	sig := data[strings.LastIndex(data, "|")+1:]
+
+	flipped := []byte(data)
+	flipped[len(flipped)-1] ^= 0x01
+
+	other, _ := newTestBot(t, time.Minute)
+	other.callbackKey = hmacKey("another-token", "callback-data")
+
+	cases := map[string]string{
+		"changed argument":  "rm|vps|" + sig,
+		"changed action":    "up|home|" + sig,
+		"changed signature": string(flipped),
+		"truncated":         data[:len(data)-1],
+		"signature only":    sig,
+		"payload only":      "rm|home",
+		"empty":             "",
+		"other bot token":   other.callbackData(testOwner, "rm", "home"),
+		"oversized":         wb.callbackData(testOwner, "sv", strings.Repeat("x", maxCallbackData)),
+	}
+	for name, forged := range cases {
+		if _, _, ok := wb.parseCallback(testOwner, forged); ok {
+			t.Errorf("%s: accepted %q", name, forged)
+		}
+	}
+
+	// A button signed for one user is useless to another
+	if _, _, ok := wb.parseCallback(7, data); ok {
+		t.Error("accepted data signed for another user")
+	}
+}
+
+func TestHandleCallbackRoutes(t *testing.T) {
+	wb, telegram := newTestBot(t, time.Minute)
+	press := func(data string) {
+		wb.handleCallback(&tgbotapi.CallbackQuery{
+			ID:      "1",
+			From:    &tgbotapi.User{ID: testOwner},
+			Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 1}},
+			Data:    data,
+		})
+	}
+
+	press(wb.callbackData(testOwner, "zz", "home"))
+	press(wb.callbackData(7, "ls", ""))
+
+	answers := telegram.callbackAnswers()
+	if len(answers) != 2 || answers[0] != "" || !strings.Contains(answers[1], "expired") {
+		t.Errorf("unexpected callback answers: %q", answers)
+	}
+	if sent := telegram.messages(); len(sent) != 0 {
+		t.Errorf("unknown or forged buttons must not do anything, sent %q", sent)
+	}
+}
+
+func TestStatusButtonNeverTriggersUpdate(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/v1/metrics" {
+			w.Write([]byte("watchtower_containers_scanned 3\n"))
+		}
+	}))
+	defer watchtower.Close()
+
+	const viewer = 7
+	wb, telegram := newTestBot(t, time.Minute)
+	if err := wb.access.Grant(testOwner, viewer, access.RoleViewer); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if err := wb.serverManager.AddServer(viewer, "home", watchtower.URL, "token"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	wb.handleCallback(&tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &tgbotapi.User{ID: viewer},
+		Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: viewer}},
+		Data:    wb.callbackData(viewer, "st", "home"),
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range paths {
+		if strings.HasSuffix(p, "/v1/update") {
+			t.Errorf("the status button called %s", p)
+		}
+	}
+	if edits := telegram.edited(); len(edits) != 1 || !strings.Contains(edits[0], "🟢") {
+		t.Errorf("expected a status card, got %q", edits)
+	}
+}
+
+func TestOverlongNicknamesGetNoButtons(t *testing.T) {
+	for _, action := range []string{"sv", "up", "st", "hi", "rm"} {
+		if !callbackFits(action, strings.Repeat("n", 32)) {
+			t.Errorf("%s: a valid nickname must fit in a button", action)
+		}
+	}
+
+	// Nicknames were not limited when this server was added
+	legacy := strings.Repeat("n", 60)
+	store := servers.NewJSONStore(filepath.Join(t.TempDir(), "servers.json"))
+	store.UpsertUser(&servers.User{
+		TelegramID: testOwner,
+		Servers: map[string]*servers.ServerConfig{
+			"home": {Nickname: "home", WatchtowerURL: "https://h"},
+			legacy: {Nickname: legacy, WatchtowerURL: "https://l"},
+		},
+	})
+	keys, err := servers.NewKeyring("test-key")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	mgr, err := servers.NewManager(keys, store)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	wb, _ := newTestBot(t, time.Minute)
+	wb.serverManager = mgr
+
+	text, markup, err := wb.serverListKeyboard(testOwner)
+	if err != nil {
+		t.Fatalf("serverListKeyboard: %v", err)
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, b := range row {
+			if len(*b.CallbackData) > maxCallbackData {
+				t.Errorf("button %q carries %d bytes", b.Text, len(*b.CallbackData))
+			}
+		}
+	}
+	if len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 1 || !strings.Contains(text, legacy) {
+		t.Errorf("expected only home as a button and a rename hint, got %q %+v", text, markup.InlineKeyboard)
+	}
+}
@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+)
+
+// How long a multi-step flow waits for the next reply
+const conversationTimeout = 5 * time.Minute
+
+// Step handles one reply in a multi-step flow.
+// It returns the step that handles the next reply, or nil when the flow is done.
+// Steps may keep values between replies in conv.Data.
+type Step func(wb *WatchtowerBot, msg *tgbotapi.Message, conv *Conversation) Step
+
+// Conversation is the per-chat state of a multi-step flow
+type Conversation struct {
+	Name   string
+	UserID int64
+	Need   access.Action // checked on every reply; roles can change mid-flow
+	Data   map[string]string
+
+	step  Step
+	timer *time.Timer
+}
+
+// conversations tracks at most one active flow per chat
+type conversations struct {
+	mu      sync.Mutex
+	byChat  map[int64]*Conversation
+	timeout time.Duration
+}
+
+func newConversations(timeout time.Duration) *conversations {
+	return &conversations{
+		byChat:  make(map[int64]*Conversation),
+		timeout: timeout,
+	}
+}
+
+// startConversation begins a flow in chatID, replacing any active one.
+// The prompt for the first reply must already have been sent.
+func (wb *WatchtowerBot) startConversation(chatID, userID int64, name string, need access.Action, first Step) {
+	conv := &Conversation{
+		Name:   name,
+		UserID: userID,
+		Need:   need,
+		Data:   make(map[string]string),
+		step:   first,
+	}
+
+	c := wb.conversations
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.byChat[chatID]; ok {
+		old.timer.Stop()
+		log.Printf("💬 Replacing %s flow in chat %d with %s", old.Name, chatID, name)
+	}
+	c.byChat[chatID] = conv
+	wb.armTimeout(chatID, conv)
+}
+
+// continueConversation feeds msg to the chat's active flow.
+// It reports whether the message was consumed.
+func (wb *WatchtowerBot) continueConversation(msg *tgbotapi.Message) bool {
+	c := wb.conversations
+	c.mu.Lock()
+	conv, ok := c.byChat[msg.Chat.ID]
+	if !ok || conv.UserID != msg.From.ID {
+		c.mu.Unlock()
+		return false
+	}
+	conv.timer.Stop()
+	c.mu.Unlock()
+
+	// The user may have lost the role the flow needs since it started
+	if !wb.allowed(msg.Chat.ID, msg.From.ID, conv.Need) {
+		c.mu.Lock()
+		if c.byChat[msg.Chat.ID] == conv {
+			delete(c.byChat, msg.Chat.ID)
+		}
+		c.mu.Unlock()
+		log.Printf("💬 Ended %s flow in chat %d: user %d lost %s access", conv.Name, msg.Chat.ID, msg.From.ID, conv.Need)
+		return true
+	}
+
+	next := conv.step(wb, msg, conv)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The step may have started a different flow or the flow may have been cancelled
+	if c.byChat[msg.Chat.ID] != conv {
+		return true
+	}
+	if next == nil {
+		delete(c.byChat, msg.Chat.ID)
+		return true
+	}
+	conv.step = next
+	wb.armTimeout(msg.Chat.ID, conv)
+	return true
+}
+
+// cancelConversation ends the chat's active flow and returns its name
+func (wb *WatchtowerBot) cancelConversation(chatID int64) (string, bool) {
+	c := wb.conversations
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conv, ok := c.byChat[chatID]
+	if !ok {
+		return "", false
+	}
+	conv.timer.Stop()
+	delete(c.byChat, chatID)
+	return conv.Name, true
+}
+
+// armTimeout (re)starts the inactivity timer (Caller must hold c.mu)
+func (wb *WatchtowerBot) armTimeout(chatID int64, conv *Conversation) {
+	c := wb.conversations
+	conv.timer = time.AfterFunc(c.timeout, func() {
+		c.mu.Lock()
+		current := c.byChat[chatID]
+		if current == conv {
+			delete(c.byChat, chatID)
+		}
+		c.mu.Unlock()
+
+		if current == conv {
+			log.Printf("⌛ %s flow in chat %d timed out", conv.Name, chatID)
+			wb.sendMessage(chatID, "⌛ *Timed out* - no reply received. Start again whenever you're ready.")
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+const testOwner = 42
+
+// fakeTelegram answers Bot API calls and records the texts sent or edited
+// and the callback answers given
+type fakeTelegram struct {
+	mu      sync.Mutex
+	sent    []string
+	edits   []string
+	answers []string
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	var result interface{} = true
+	switch method {
+	case "getMe":
+		result = map[string]interface{}{"id": 1, "is_bot": true, "username": "test_bot"}
+	case "sendMessage":
+		f.mu.Lock()
+		f.sent = append(f.sent, r.FormValue("text"))
+		f.mu.Unlock()
+		result = map[string]interface{}{"message_id": 1}
+	case "editMessageText":
+		f.mu.Lock()
+		f.edits = append(f.edits, r.FormValue("text"))
+		f.mu.Unlock()
+		result = map[string]interface{}{"message_id": 1}
+	case "answerCallbackQuery":
+		f.mu.Lock()
+		f.answers = append(f.answers, r.FormValue("text"))
+		f.mu.Unlock()
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func (f *fakeTelegram) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.sent...)
+}
+
+func (f *fakeTelegram) edited() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.edits...)
+}
+
+func (f *fakeTelegram) callbackAnswers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.answers...)
+}
+
+// newTestBot is a bot talking to a fake Telegram, owned by testOwner
+func newTestBot(t *testing.T, timeout time.Duration) (*WatchtowerBot, *fakeTelegram) {
+	t.Helper()
+	telegram := &fakeTelegram{}
+	srv := httptest.NewServer(telegram)
+	t.Cleanup(srv.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("test-token", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient: %v", err)
+	}
+	keys, err := servers.NewKeyring("test-key")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	mgr, err := servers.NewManager(keys, servers.NewJSONStore(filepath.Join(t.TempDir(), "servers.json")))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &WatchtowerBot{
+		API:           api,
+		access:        access.NewController(mgr, testOwner),
+		serverManager: mgr,
+		conversations: newConversations(timeout),
+		callbackKey:   hmacKey("test-token", "callback-data"),
+		inflight:      newInflight(),
+		jobs:          jobs.NewManager(jobs.DefaultRetention),
+		ctx:           ctx,
+		cancel:        cancel,
+	}, telegram
+}
+
+func chatMessage(chatID, userID int64, text string) *tgbotapi.Message {
+	msg := commandMessage(text)
+	msg.Chat = &tgbotapi.Chat{ID: chatID, Type: "private"}
+	msg.From = &tgbotapi.User{ID: userID}
+	return msg
+}
+
+// recordingStep saves each reply under key and continues with next
+func recordingStep(key string, next Step) Step {
+	return func(wb *WatchtowerBot, msg *tgbotapi.Message, conv *Conversation) Step {
+		conv.Data[key] = msg.Text
+		return next
+	}
+}
+
+func (wb *WatchtowerBot) activeConversation(chatID int64) (*Conversation, bool) {
+	wb.conversations.mu.Lock()
+	defer wb.conversations.mu.Unlock()
+	conv, ok := wb.conversations.byChat[chatID]
+	return conv, ok
+}
+
+func TestConversationAdvancesSteps(t *testing.T) {
+	wb, _ := newTestBot(t, time.Minute)
+
+	var data map[string]string
+	last := func(wb *WatchtowerBot, msg *tgbotapi.Message, conv *Conversation) Step {
+		conv.Data["second"] = msg.Text
+		data = conv.Data
+		return nil
+	}
+	wb.startConversation(1, testOwner, "test", access.ActionView, recordingStep("first", last))
+
+	if wb.continueConversation(chatMessage(1, 7, "intruder")) {
+		t.Error("another user's reply must not feed the flow")
+	}
+	if wb.continueConversation(chatMessage(2, testOwner, "elsewhere")) {
+		t.Error("a reply in another chat must not feed the flow")
+	}
+	if !wb.continueConversation(chatMessage(1, testOwner, "a")) {
+		t.Fatal("first reply not consumed")
+	}
+	if !wb.continueConversation(chatMessage(1, testOwner, "b")) {
+		t.Fatal("second reply not consumed")
+	}
+	if data["first"] != "a" || data["second"] != "b" {
+		t.Errorf("unexpected flow data: %v", data)
+	}
+	if _, ok := wb.activeConversation(1); ok {
+		t.Error("a finished flow must be removed")
+	}
+	if wb.continueConversation(chatMessage(1, testOwner, "c")) {
+		t.Error("replies after the flow ended must not be consumed")
+	}
+}
+
+func TestConversationReplacedByNewFlow(t *testing.T) {
+	wb, telegram := newTestBot(t, 50*time.Millisecond)
+
+	wb.startConversation(1, testOwner, "old", access.ActionView, recordingStep("old", nil))
+	wb.startConversation(1, testOwner, "new", access.ActionView, recordingStep("new", recordingStep("again", nil)))
+
+	if !wb.continueConversation(chatMessage(1, testOwner, "x")) {
+		t.Fatal("reply not consumed")
+	}
+	conv, ok := wb.activeConversation(1)
+	if !ok || conv.Name != "new" || conv.Data["new"] != "x" || conv.Data["old"] != "" {
+		t.Fatalf("reply went to the wrong flow: %+v", conv)
+	}
+
+	// Only the new flow's timer may fire
+	time.Sleep(150 * time.Millisecond)
+	timeouts := 0
+	for _, m := range telegram.messages() {
+		if strings.Contains(m, "Timed out") {
+			timeouts++
+		}
+	}
+	if timeouts != 1 {
+		t.Errorf("expected one timeout message, got %d: %v", timeouts, telegram.messages())
+	}
+}
+
+func TestConversationTimeout(t *testing.T) {
+	wb, telegram := newTestBot(t, 100*time.Millisecond)
+	wb.startConversation(1, testOwner, "test", access.ActionView, recordingStep("first", recordingStep("second", nil)))
+
+	// A reply restarts the timer
+	time.Sleep(60 * time.Millisecond)
+	if !wb.continueConversation(chatMessage(1, testOwner, "a")) {
+		t.Fatal("reply before the timeout not consumed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := wb.activeConversation(1); !ok {
+		t.Fatal("the timer must restart after each reply")
+	}
+
+	// The notice is sent once the flow is gone
+	deadline := time.Now().Add(time.Second)
+	for len(telegram.messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("flow did not time out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if sent := telegram.messages(); len(sent) != 1 || !strings.Contains(sent[0], "Timed out") {
+		t.Errorf("expected a timeout notice, got %v", sent)
+	}
+	if wb.continueConversation(chatMessage(1, testOwner, "late")) {
+		t.Error("a reply after the timeout must not be consumed")
+	}
+}
+
+func TestConversationCancelAndInterrupt(t *testing.T) {
+	wb, telegram := newTestBot(t, time.Minute)
+
+	wb.startConversation(1, testOwner, "test", access.ActionView, recordingStep("first", nil))
+	wb.Handle(tgbotapi.Update{Message: chatMessage(1, testOwner, "/cancel")})
+	if _, ok := wb.activeConversation(1); ok {
+		t.Error("/cancel must end the flow")
+	}
+	if sent := telegram.messages(); len(sent) != 1 || !strings.Contains(sent[0], "Cancelled") {
+		t.Errorf("expected a cancel confirmation, got %v", sent)
+	}
+
+	wb.Handle(tgbotapi.Update{Message: chatMessage(1, testOwner, "/cancel")})
+	if sent := telegram.messages(); !strings.Contains(sent[len(sent)-1], "Nothing to cancel") {
+		t.Errorf("expected nothing to cancel, got %v", sent)
+	}
+
+	// Any other command abandons the flow and runs as usual
+	wb.startConversation(1, testOwner, "test", access.ActionView, recordingStep("first", nil))
+	wb.Handle(tgbotapi.Update{Message: chatMessage(1, testOwner, "/help")})
+	if _, ok := wb.activeConversation(1); ok {
+		t.Error("a command must interrupt the flow")
+	}
+
+	// A plain reply from someone else in the chat falls through to the menu
+	wb.startConversation(1, testOwner, "test", access.ActionView, recordingStep("first", nil))
+	if wb.continueConversation(chatMessage(1, 7, "hello")) {
+		t.Error("another user's reply must not feed the flow")
+	}
+	if _, ok := wb.activeConversation(1); !ok {
+		t.Error("another user's reply must not end the flow")
+	}
+}
+
+func TestAddServerWizardValidatesReplies(t *testing.T) {
+	wb, telegram := newTestBot(t, time.Minute)
+	wb.startAddServerWizard(chatMessage(1, testOwner, menuAddServer))
+
+	for _, reply := range []string{"bad name", "home", "https://", "watchtower.local"} {
+		if !wb.continueConversation(chatMessage(1, testOwner, reply)) {
+			t.Fatalf("reply %q not consumed", reply)
+		}
+	}
+	conv, ok := wb.activeConversation(1)
+	if !ok || conv.Data["nickname"] != "home" || conv.Data["url"] != "https://watchtower.local" {
+		t.Fatalf("unexpected wizard state: %+v", conv)
+	}
+
+	sent := telegram.messages()
+	if len(sent) != 5 || !strings.Contains(sent[1], "another nickname") || !strings.Contains(sent[3], "http(s)") {
+		t.Errorf("expected invalid replies to be asked again, got %q", sent)
+	}
+}
+
+func TestConversationRechecksAccess(t *testing.T) {
+	wb, telegram := newTestBot(t, time.Minute)
+	const operator = 7
+	if err := wb.access.Grant(testOwner, operator, access.RoleOperator); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+
+	wb.Handle(tgbotapi.Update{Message: chatMessage(1, operator, "/add_server")})
+	for _, reply := range []string{"home", "https://watchtower.local"} {
+		wb.Handle(tgbotapi.Update{Message: chatMessage(1, operator, reply)})
+	}
+
+	// Demoted while the wizard waits for the token
+	if err := wb.access.Grant(testOwner, operator, access.RoleViewer); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	wb.Handle(tgbotapi.Update{Message: chatMessage(1, operator, "secret-token")})
+
+	if _, ok := wb.activeConversation(1); ok {
+		t.Error("the flow must end once the user lacks its access")
+	}
+	if names, _ := wb.serverManager.ListServers(operator); len(names) != 0 {
+		t.Errorf("a viewer added servers: %v", names)
+	}
+	if sent := telegram.messages(); !strings.Contains(sent[len(sent)-1], "Not allowed") {
+		t.Errorf("expected a denial, got %q", sent)
+	}
+
+	// Removed from the access list altogether
+	var replied bool
+	wb.startConversation(1, operator, "test", access.ActionView, func(wb *WatchtowerBot, msg *tgbotapi.Message, conv *Conversation) Step {
+		replied = true
+		return nil
+	})
+	if err := wb.access.Revoke(testOwner, operator); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if !wb.continueConversation(chatMessage(1, operator, "hello")) || replied {
+		t.Error("a removed user's reply must be swallowed, not handled")
+	}
+	if _, ok := wb.activeConversation(1); ok {
+		t.Error("the flow must end once the user is removed")
+	}
+}
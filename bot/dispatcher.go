@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// dispatcher runs update handlers on a fixed pool of workers.
+// Updates from different chats are handled concurrently; updates from the
+// same chat are handled one at a time in arrival order, so conversation
+// steps and command replies never overtake each other.
+type dispatcher struct {
+	handle func(tgbotapi.Update)
+
+	mu        sync.Mutex
+	pending   map[int64][]tgbotapi.Update
+	scheduled map[int64]bool // chat is queued on ready or being worked on
+	closed    bool
+
+	ready   chan int64
+	queued  sync.WaitGroup // accepted updates not yet handled
+	workers sync.WaitGroup
+}
+
+func newDispatcher(workers int, handle func(tgbotapi.Update)) *dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	d := &dispatcher{
+		handle:    handle,
+		pending:   make(map[int64][]tgbotapi.Update),
+		scheduled: make(map[int64]bool),
+		ready:     make(chan int64, workers),
+	}
+	for i := 0; i < workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Submit queues update for chatID. It reports false once the dispatcher is draining.
+func (d *dispatcher) Submit(chatID int64, update tgbotapi.Update) bool {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return false
+	}
+	d.queued.Add(1)
+	d.pending[chatID] = append(d.pending[chatID], update)
+	schedule := !d.scheduled[chatID]
+	d.scheduled[chatID] = true
+	d.mu.Unlock()
+
+	// Blocks while every worker is busy, which throttles the poller
+	if schedule {
+		d.ready <- chatID
+	}
+	return true
+}
+
+// work handles one chat at a time until its queue is empty
+func (d *dispatcher) work() {
+	defer d.workers.Done()
+	for chatID := range d.ready {
+		for {
+			d.mu.Lock()
+			queue := d.pending[chatID]
+			if len(queue) == 0 {
+				delete(d.pending, chatID)
+				delete(d.scheduled, chatID)
+				d.mu.Unlock()
+				break
+			}
+			update := queue[0]
+			d.pending[chatID] = queue[1:]
+			d.mu.Unlock()
+
+			d.run(chatID, update)
+		}
+	}
+}
+
+// run handles one update; a panicking handler is logged instead of killing the worker
+func (d *dispatcher) run(chatID int64, update tgbotapi.Update) {
+	defer d.queued.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("💥 Handler panic in chat %d (update %d): %v\n%s", chatID, update.UpdateID, r, debug.Stack())
+		}
+	}()
+	d.handle(update)
+}
+
+// Drain stops accepting updates and waits until the queued ones are handled
+// or ctx expires. Workers exit once the queue is empty.
+func (d *dispatcher) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	alreadyClosed := d.closed
+	d.closed = true
+	d.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.queued.Wait()
+		if !alreadyClosed {
+			close(d.ready)
+		}
+		d.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
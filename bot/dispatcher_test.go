@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[int64][]int)
+	d := newDispatcher(4, func(u tgbotapi.Update) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[u.Message.Chat.ID] = append(seen[u.Message.Chat.ID], u.UpdateID)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 20; i++ {
+		for chat := int64(1); chat <= 3; chat++ {
+			d.Submit(chat, tgbotapi.Update{UpdateID: i, Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chat}}})
+		}
+	}
+	if err := d.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	for chat, ids := range seen {
+		if len(ids) != 20 {
+			t.Fatalf("chat %d: expected 20 updates, got %d", chat, len(ids))
+		}
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("chat %d handled out of order: %v", chat, ids)
+			}
+		}
+	}
+}
+
+func TestDispatcherServesChatsConcurrently(t *testing.T) {
+	block := make(chan struct{})
+	handled := make(chan int64, 1)
+	d := newDispatcher(2, func(u tgbotapi.Update) {
+		if u.UpdateID == 1 {
+			<-block
+		}
+		handled <- int64(u.UpdateID)
+	})
+	defer d.Drain(context.Background())
+	defer close(block)
+
+	d.Submit(1, tgbotapi.Update{UpdateID: 1})
+	d.Submit(2, tgbotapi.Update{UpdateID: 2})
+
+	select {
+	case id := <-handled:
+		if id != 2 {
+			t.Fatalf("expected chat 2 to be handled first, got %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow chat blocked other chats")
+	}
+}
+
+func TestDispatcherRecoversFromPanic(t *testing.T) {
+	var mu sync.Mutex
+	var handled []int
+	d := newDispatcher(1, func(u tgbotapi.Update) {
+		if u.UpdateID == 1 {
+			panic("boom")
+		}
+		mu.Lock()
+		handled = append(handled, u.UpdateID)
+		mu.Unlock()
+	})
+
+	d.Submit(1, tgbotapi.Update{UpdateID: 1})
+	d.Submit(1, tgbotapi.Update{UpdateID: 2})
+	if err := d.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if len(handled) != 1 || handled[0] != 2 {
+		t.Errorf("expected update 2 to be handled after the panic, got %v", handled)
+	}
+}
+
+func TestDispatcherDrainRejectsAndTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	d := newDispatcher(1, func(u tgbotapi.Update) { <-release })
+	d.Submit(1, tgbotapi.Update{UpdateID: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Drain(ctx); err == nil {
+		t.Fatal("expected Drain to time out while a handler is blocked")
+	}
+	if d.Submit(1, tgbotapi.Update{UpdateID: 2}) {
+		t.Error("expected Submit to be rejected while draining")
+	}
+
+	close(release)
+	if err := d.Drain(context.Background()); err != nil {
+		t.Fatalf("second Drain: %v", err)
+	}
+}
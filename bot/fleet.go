@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// Fleet updates run at most fleetWorkers servers at once, each bounded by
+// fleetServerTimeout, and refresh the progress message at most every
+// fleetRefreshInterval to stay under Telegram's edit rate limit
+const (
+	fleetWorkers         = 4
+	fleetServerTimeout   = api.DefaultUpdateTimeout
+	fleetRefreshInterval = 2 * time.Second
+)
+
+type fleetState int
+
+const (
+	fleetQueued fleetState = iota
+	fleetRunning
+	fleetDone
+	fleetFailed
+)
+
+// fleetTarget is one server's progress in a fleet update
+type fleetTarget struct {
+	nickname string
+	client   *api.WatchtowerClient
+	state    fleetState
+	result   *api.UpdateResponse
+	err      error
+}
+
+// fleetProgress is shared between the workers and the message refresher
+type fleetProgress struct {
+	// workspace owns the targets; it is fixed when the fleet starts, so
+	// switching workspaces mid-run can't move the history elsewhere
+	workspace string
+
+	mu      sync.Mutex
+	targets []*fleetTarget
+	dirty   bool
+}
+
+func (p *fleetProgress) set(t *fleetTarget, state fleetState, result *api.UpdateResponse, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.state, t.result, t.err = state, result, err
+	p.dirty = true
+}
+
+// takeDirty reports whether anything changed since the last call
+func (p *fleetProgress) takeDirty() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dirty := p.dirty
+	p.dirty = false
+	return dirty
+}
+
+// parseServerList splits "home,vps" or "home vps" into unique nicknames
+func parseServerList(args string) []string {
+	var nicknames []string
+	seen := make(map[string]bool)
+	for _, name := range strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !seen[name] {
+			seen[name] = true
+			nicknames = append(nicknames, name)
+		}
+	}
+	return nicknames
+}
+
+// parseUpdateArgs splits /wt_update arguments into server nicknames and the --force flag
+func parseUpdateArgs(args string) ([]string, bool) {
+	force := false
+	var nicknames []string
+	for _, name := range parseServerList(args) {
+		if name == forceFlag {
+			force = true
+			continue
+		}
+		nicknames = append(nicknames, name)
+	}
+	return nicknames, force
+}
+
+// handleUpdateAll updates every server of the user
+func (wb *WatchtowerBot) handleUpdateAll(message *tgbotapi.Message) {
+	_, force := parseUpdateArgs(message.CommandArguments())
+
+	nicknames, err := wb.serverManager.ListServers(message.From.ID)
+	if err != nil || len(nicknames) == 0 {
+		wb.sendMessage(message.Chat.ID,
+			"❌ No servers configured.\n\n"+
+				"Use **/add_server** to add your first Watchtower server.")
+		return
+	}
+	wb.runFleetUpdate(message, nicknames, force)
+}
+
+// runFleetUpdate triggers updates on nicknames concurrently and reports
+// progress in a single message that is edited as servers finish.
+// Frozen servers are skipped unless force is set.
+func (wb *WatchtowerBot) runFleetUpdate(message *tgbotapi.Message, nicknames []string, force bool) {
+	chatID := message.Chat.ID
+
+	progress := &fleetProgress{workspace: wb.serverManager.WorkspaceID(message.From.ID)}
+	for _, nickname := range nicknames {
+		t := &fleetTarget{nickname: nickname}
+		if err := wb.checkFreeze(message.From.ID, nickname, force); err != nil {
+			t.state, t.err = fleetFailed, err
+			progress.targets = append(progress.targets, t)
+			continue
+		}
+		client, err := wb.serverManager.GetAPIClientIn(progress.workspace, nickname)
+		if err != nil {
+			t.state, t.err = fleetFailed, err
+		} else {
+			t.client = client
+		}
+		progress.targets = append(progress.targets, t)
+	}
+
+	messageID, err := wb.sendTracked(chatID, renderFleet(progress, false))
+	if err != nil {
+		log.Printf("❌ Failed to send fleet update message to chat %d: %v", chatID, err)
+		return
+	}
+	log.Printf("🚀 Fleet update of %d server(s) started in chat %d", len(nicknames), chatID)
+
+	// Run in the background so the bot keeps answering while hosts update
+	ctx, done := wb.requestContext(chatID)
+	wb.goBackground(func() {
+		defer done()
+		wb.driveFleet(ctx, message.From.ID, chatID, messageID, progress)
+	})
+}
+
+// driveFleet runs the fleet's jobs through the worker pool and keeps the
+// progress message up to date until all of them have finished
+func (wb *WatchtowerBot) driveFleet(ctx context.Context, userID, chatID int64, messageID int, progress *fleetProgress) {
+	queue := make(chan *fleetTarget)
+	var workers sync.WaitGroup
+	for i := 0; i < fleetWorkers && i < len(progress.targets); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for t := range queue {
+				wb.updateFleetTarget(ctx, userID, chatID, progress, t)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		for _, t := range progress.targets {
+			if t.client != nil {
+				queue <- t
+			}
+		}
+		close(queue)
+		workers.Wait()
+		close(finished)
+	}()
+
+	ticker := time.NewTicker(fleetRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if progress.takeDirty() {
+				wb.editMessage(chatID, messageID, renderFleet(progress, false))
+			}
+		case <-finished:
+			wb.editMessage(chatID, messageID, renderFleet(progress, true))
+			return
+		}
+	}
+}
+
+// updateFleetTarget runs one server's update as a job so it shows up in /jobs
+func (wb *WatchtowerBot) updateFleetTarget(ctx context.Context, userID, chatID int64, progress *fleetProgress, t *fleetTarget) {
+	progress.set(t, fleetRunning, nil, nil)
+
+	ctx, cancel := context.WithTimeout(ctx, fleetServerTimeout)
+	defer cancel()
+
+	spec := jobs.Spec{
+		UserID:      userID,
+		ChatID:      chatID,
+		Server:      t.nickname,
+		Workspace:   progress.workspace,
+		Source:      servers.SourceFleet,
+		TriggeredBy: userID,
+	}
+	j := wb.jobs.Run(ctx, spec, t.client.TriggerUpdate)
+	wb.recordJob(j)
+	if j.State != jobs.StateSucceeded {
+		log.Printf("❌ Fleet job %s on %s %s: %v", j.ID, t.nickname, j.State, j.Err)
+		progress.set(t, fleetFailed, nil, j.Err)
+		return
+	}
+	progress.set(t, fleetDone, j.Response, nil)
+}
+
+// renderFleet draws one line per server plus a header
+func renderFleet(progress *fleetProgress, final bool) string {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	finished, failed := 0, 0
+	var lines strings.Builder
+	for _, t := range progress.targets {
+		switch t.state {
+		case fleetQueued:
+			lines.WriteString(fmt.Sprintf("⏳ `%s` - queued\n", t.nickname))
+		case fleetRunning:
+			lines.WriteString(fmt.Sprintf("🔄 `%s` - updating...\n", t.nickname))
+		case fleetDone:
+			finished++
+			lines.WriteString(fmt.Sprintf("%s `%s` - %s\n", fleetResultIcon(t.result), t.nickname, summarizeUpdate(t.result)))
+		case fleetFailed:
+			finished++
+			failed++
+			lines.WriteString(fmt.Sprintf("❌ `%s` - %s\n", t.nickname, shortAPIError(t.err)))
+		}
+	}
+
+	var header string
+	if final {
+		header = fmt.Sprintf("🏁 *Fleet update finished* - %d ok, %d failed\n\n", finished-failed, failed)
+	} else {
+		header = fmt.Sprintf("🚀 *Fleet update* (%d/%d done)\n\n", finished, len(progress.targets))
+	}
+	return header + lines.String()
+}
+
+func fleetResultIcon(result *api.UpdateResponse) string {
+	if len(result.Failed) > 0 {
+		return "⚠️"
+	}
+	return "✅"
+}
+
+// summarizeUpdate renders a Watchtower run in one line
+func summarizeUpdate(result *api.UpdateResponse) string {
+	if len(result.Updated) == 0 && len(result.Failed) == 0 {
+		if result.Message != "" {
+			return result.Message
+		}
+		return "nothing to update"
+	}
+
+	var parts []string
+	if len(result.Updated) > 0 {
+		parts = append(parts, fmt.Sprintf("%d updated: `%s`", len(result.Updated), strings.Join(result.Updated, ", ")))
+	}
+	if len(result.Failed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed: `%s`", len(result.Failed), strings.Join(result.Failed, ", ")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sendTracked sends a plain Markdown message and returns its ID for later edits
+func (wb *WatchtowerBot) sendTracked(chatID int64, text string) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+
+	sent, err := wb.API.Send(msg)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
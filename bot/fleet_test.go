@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+func TestParseServerList(t *testing.T) {
+	cases := map[string][]string{
+		"":                nil,
+		"home":            {"home"},
+		"home,vps":        {"home", "vps"},
+		"home vps, edge":  {"home", "vps", "edge"},
+		"home,,home vps ": {"home", "vps"},
+	}
+	for args, want := range cases {
+		if got := parseServerList(args); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseServerList(%q) = %v, want %v", args, got, want)
+		}
+	}
+}
+
+func TestParseUpdateArgsFlagAnywhere(t *testing.T) {
+	nicknames, force := parseUpdateArgs("--force home")
+	if !force || !reflect.DeepEqual(nicknames, []string{"home"}) {
+		t.Errorf("got %v force=%v", nicknames, force)
+	}
+	nicknames, force = parseUpdateArgs("--force")
+	if !force || len(nicknames) != 0 {
+		t.Errorf("got %v force=%v", nicknames, force)
+	}
+}
+
+func TestRenderFleet(t *testing.T) {
+	progress := &fleetProgress{targets: []*fleetTarget{
+		{nickname: "queued"},
+		{nickname: "running", state: fleetRunning},
+		{nickname: "clean", state: fleetDone, result: &api.UpdateResponse{}},
+		{nickname: "partial", state: fleetDone, result: &api.UpdateResponse{Updated: []string{"web"}, Failed: []string{"db"}}},
+		{nickname: "down", state: fleetFailed, err: fmt.Errorf("%w: dial tcp", api.ErrUnavailable)},
+	}}
+
+	text := renderFleet(progress, false)
+	for _, want := range []string{
+		"(3/5 done)",
+		"⏳ `queued` - queued",
+		"🔄 `running` - updating...",
+		"✅ `clean` - nothing to update",
+		"⚠️ `partial` - 1 updated: `web`, 1 failed: `db`",
+		"❌ `down` - ",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("progress message lacks %q:\n%s", want, text)
+		}
+	}
+	if text := renderFleet(progress, true); !strings.HasPrefix(text, "🏁 *Fleet update finished* - 2 ok, 1 failed") {
+		t.Errorf("unexpected final header:\n%s", text)
+	}
+}
+
+func TestDriveFleetLimitsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(30 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		w.Write([]byte(`{"updated": ["web"], "failed": []}`))
+	}))
+	defer watchtower.Close()
+
+	wb, _ := newTestBot(t, time.Minute)
+	progress := &fleetProgress{workspace: wb.serverManager.WorkspaceID(testOwner)}
+	for i := 0; i < fleetWorkers*3; i++ {
+		progress.targets = append(progress.targets, &fleetTarget{
+			nickname: fmt.Sprintf("host%d", i),
+			client:   api.NewWatchtowerClient(watchtower.URL, "token"),
+		})
+	}
+	// A target that failed before the run is never sent to a worker
+	progress.targets = append(progress.targets, &fleetTarget{nickname: "frozen", state: fleetFailed, err: servers.ErrFrozen})
+
+	wb.driveFleet(context.Background(), testOwner, 1, 1, progress)
+
+	if peak > fleetWorkers {
+		t.Errorf("%d updates ran at once, limit is %d", peak, fleetWorkers)
+	}
+	if peak < 2 {
+		t.Errorf("expected updates to run concurrently, peak was %d", peak)
+	}
+	for _, target := range progress.targets {
+		if target.nickname == "frozen" {
+			if target.state != fleetFailed || !errors.Is(target.err, servers.ErrFrozen) {
+				t.Errorf("frozen target changed: %+v", target)
+			}
+		} else if target.state != fleetDone {
+			t.Errorf("%s ended in state %d: %v", target.nickname, target.state, target.err)
+		}
+	}
+}
+
+func TestDriveFleetKeepsStartingWorkspace(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"updated": [], "failed": []}`))
+	}))
+	defer watchtower.Close()
+
+	wb, _ := newTestBot(t, time.Minute)
+	mgr := wb.serverManager
+	if err := mgr.AddServer(testOwner, "home", watchtower.URL, "token"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	progress := &fleetProgress{workspace: mgr.WorkspaceID(testOwner)}
+	progress.targets = []*fleetTarget{{nickname: "home", client: api.NewWatchtowerClient(watchtower.URL, "token")}}
+
+	// The user switches workspace while the fleet is running
+	if _, err := mgr.CreateWorkspace(testOwner, "team"); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	wb.driveFleet(context.Background(), testOwner, 1, 1, progress)
+
+	if entries, _ := mgr.History(testOwner, "home", 10); len(entries) != 0 {
+		t.Errorf("history went to the team workspace: %+v", entries)
+	}
+	if err := mgr.SwitchWorkspace(testOwner, "personal"); err != nil {
+		t.Fatalf("SwitchWorkspace: %v", err)
+	}
+	if entries, _ := mgr.History(testOwner, "home", 10); len(entries) != 1 || entries[0].Source != servers.SourceFleet {
+		t.Errorf("expected the fleet update in the starting workspace, got %+v", entries)
+	}
+}
@@ -0,0 +1,264 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// forceFlag lifts an active freeze for one /wt_update call
+const forceFlag = "--force"
+
+const freezeUsage = "🧊 *Update freezes*\n\n" +
+	"`/freeze add <server|all> until <YYYY-MM-DDTHH:MM> [tz=<zone>] [reason]`\n" +
+	"`/freeze add <server|all> for <48h|3d> [reason]`\n" +
+	"`/freeze add <server|all> daily HH:MM-HH:MM [tz=<zone>] [reason]`\n" +
+	"`/freeze add <server|all> weekly fri,sat HH:MM-HH:MM [tz=<zone>] [reason]`\n" +
+	"`/freeze list`\n" +
+	"`/freeze remove <id>`\n\n" +
+	"While a freeze is active, updates are refused unless you use `/wt_update --force`."
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (wb *WatchtowerBot) handleFreeze(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		wb.sendMessage(message.Chat.ID, freezeUsage)
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		wb.freezeAdd(message, args[1:])
+	case "list":
+		wb.freezeList(message)
+	case "remove":
+		wb.freezeRemove(message, args[1:])
+	default:
+		wb.sendMessage(message.Chat.ID, freezeUsage)
+	}
+}
+
+func (wb *WatchtowerBot) freezeAdd(message *tgbotapi.Message, args []string) {
+	freeze, err := parseFreeze(args, time.Now())
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Invalid freeze: `%v`\n\n%s", err, freezeUsage))
+		return
+	}
+	freeze.CreatedBy = message.From.ID
+
+	freeze, err = wb.serverManager.AddFreeze(message.From.ID, freeze)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error saving freeze: `%v`", err))
+		return
+	}
+
+	log.Printf("🧊 User %d added freeze %s on %s", message.From.ID, freeze.ID, freezeScope(freeze))
+	wb.sendMessage(message.Chat.ID, "✅ *Freeze added*\n\n"+formatFreeze(freeze, time.Now()))
+}
+
+func (wb *WatchtowerBot) freezeList(message *tgbotapi.Message) {
+	freezes := wb.serverManager.ListFreezes(message.From.ID)
+	if len(freezes) == 0 {
+		wb.sendMessage(message.Chat.ID, "📭 No update freezes.\n\nUse `/freeze add` to add one.")
+		return
+	}
+
+	now := time.Now()
+	var response strings.Builder
+	response.WriteString("🧊 *Update freezes*\n")
+	for _, f := range freezes {
+		response.WriteString("\n" + formatFreeze(f, now) + "\n")
+	}
+	wb.sendMessage(message.Chat.ID, response.String())
+}
+
+func (wb *WatchtowerBot) freezeRemove(message *tgbotapi.Message, args []string) {
+	if len(args) != 1 {
+		wb.sendMessage(message.Chat.ID, "❌ *Usage:* `/freeze remove <id>`")
+		return
+	}
+
+	if err := wb.serverManager.RemoveFreeze(message.From.ID, args[0]); err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error removing freeze: `%v`", err))
+		return
+	}
+	log.Printf("🧊 User %d removed freeze %s", message.From.ID, args[0])
+	wb.sendMessage(message.Chat.ID, fmt.Sprintf("🗑 Freeze `%s` removed.", args[0]))
+}
+
+// parseFreeze turns "/freeze add" arguments into a freeze; now anchors "for" and "until"
+func parseFreeze(args []string, now time.Time) (servers.Freeze, error) {
+	var f servers.Freeze
+	var rest []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "tz=") {
+			f.Timezone = strings.TrimPrefix(arg, "tz=")
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) < 3 {
+		return f, errors.New("missing server or period")
+	}
+
+	if rest[0] != "all" {
+		f.Server = rest[0]
+	}
+
+	loc := time.UTC
+	if f.Timezone != "" {
+		l, err := time.LoadLocation(f.Timezone)
+		if err != nil {
+			return f, fmt.Errorf("unknown timezone %q", f.Timezone)
+		}
+		loc = l
+	}
+
+	kind, rest := rest[1], rest[2:]
+	switch kind {
+	case "until":
+		end, err := parseFreezeTime(rest[0], loc)
+		if err != nil {
+			return f, err
+		}
+		f.Start, f.End = now, end
+		rest = rest[1:]
+	case "for":
+		d, err := parseFreezeDuration(rest[0])
+		if err != nil {
+			return f, err
+		}
+		f.Start, f.End = now, now.Add(d)
+		rest = rest[1:]
+	case "daily":
+		f.Window = rest[0]
+		rest = rest[1:]
+	case "weekly":
+		if len(rest) < 2 {
+			return f, errors.New("weekly freezes need days and a window")
+		}
+		for _, name := range strings.Split(strings.ToLower(rest[0]), ",") {
+			day, ok := weekdayNames[name]
+			if !ok {
+				return f, fmt.Errorf("unknown day %q", name)
+			}
+			f.Days = append(f.Days, day)
+		}
+		f.Window = rest[1]
+		rest = rest[2:]
+	default:
+		return f, fmt.Errorf("unknown period %q", kind)
+	}
+
+	f.Reason = strings.Join(rest, " ")
+	if !f.Recurring() && !f.End.After(now) {
+		return f, errors.New("freeze would end in the past")
+	}
+	return f, f.Validate()
+}
+
+func parseFreezeTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected YYYY-MM-DDTHH:MM", s)
+}
+
+// parseFreezeDuration accepts Go durations plus whole days ("3d")
+func parseFreezeDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+func freezeScope(f servers.Freeze) string {
+	if f.Server == "" {
+		return "all servers"
+	}
+	return f.Server
+}
+
+// formatFreeze renders one freeze, marking it if it is active at now
+func formatFreeze(f servers.Freeze, now time.Time) string {
+	var text strings.Builder
+	state := "⚪"
+	if f.ActiveAt(now) {
+		state = "🔴 *active*"
+	}
+	text.WriteString(fmt.Sprintf("🆔 `%s` %s\n🌐 %s\n", f.ID, state, freezeScope(f)))
+
+	if f.Recurring() {
+		days := "daily"
+		if len(f.Days) > 0 {
+			var names []string
+			for _, d := range f.Days {
+				names = append(names, strings.ToLower(d.String()[:3]))
+			}
+			days = strings.Join(names, ",")
+		}
+		tz := f.Timezone
+		if tz == "" {
+			tz = "UTC"
+		}
+		text.WriteString(fmt.Sprintf("🔁 %s `%s` `%s`", days, f.Window, tz))
+	} else {
+		loc := time.UTC
+		if l, err := time.LoadLocation(f.Timezone); err == nil {
+			loc = l
+		}
+		text.WriteString(fmt.Sprintf("📅 until %s", f.End.In(loc).Format("2006-01-02 15:04 MST")))
+	}
+
+	if f.Reason != "" {
+		text.WriteString(fmt.Sprintf("\n📝 `%s`", strings.ReplaceAll(f.Reason, "`", "'")))
+	}
+	return text.String()
+}
+
+// frozenMessage explains why an update was refused
+func frozenMessage(nickname string, err error) string {
+	var frozen *servers.FrozenError
+	if !errors.As(err, &frozen) {
+		return fmt.Sprintf("❌ Update of `%s` refused: `%v`", nickname, err)
+	}
+	return fmt.Sprintf("🧊 *Updates to* `%s` *are frozen*\n\n%s\n\n"+
+		"Use `/wt_update %s %s` to update anyway.",
+		nickname, formatFreeze(frozen.Freeze, time.Now()), nickname, forceFlag)
+}
+
+// checkFreeze applies the freeze policy before an update. A forced update of a
+// frozen server is allowed but logged; otherwise the freeze error is returned.
+func (wb *WatchtowerBot) checkFreeze(userID int64, nickname string, force bool) error {
+	err := wb.serverManager.CheckUpdateAllowed(userID, nickname, time.Now())
+	if err == nil {
+		return nil
+	}
+	if !force {
+		return err
+	}
+	log.Printf("⚠️ User %d forced an update of %s past a freeze: %v", userID, nickname, err)
+	return nil
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseUpdateArgs(t *testing.T) {
+	nicknames, force := parseUpdateArgs("home,vps --force")
+	if !force || !reflect.DeepEqual(nicknames, []string{"home", "vps"}) {
+		t.Errorf("got %v force=%v", nicknames, force)
+	}
+	nicknames, force = parseUpdateArgs("")
+	if force || len(nicknames) != 0 {
+		t.Errorf("got %v force=%v", nicknames, force)
+	}
+}
+
+func TestParseFreeze(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	f, err := parseFreeze([]string{"all", "for", "2d", "release", "week"}, now)
+	if err != nil {
+		t.Fatalf("parseFreeze: %v", err)
+	}
+	if f.Server != "" || !f.Start.Equal(now) || !f.End.Equal(now.Add(48*time.Hour)) || f.Reason != "release week" {
+		t.Errorf("unexpected freeze: %+v", f)
+	}
+
+	f, err = parseFreeze([]string{"home", "until", "2026-05-03T08:00", "tz=Europe/Berlin"}, now)
+	if err != nil {
+		t.Fatalf("parseFreeze: %v", err)
+	}
+	if want := time.Date(2026, 5, 3, 6, 0, 0, 0, time.UTC); f.Server != "home" || !f.End.Equal(want) {
+		t.Errorf("expected home frozen until %s, got %+v", want, f)
+	}
+
+	f, err = parseFreeze([]string{"vps", "weekly", "fri,sat", "22:00-06:00"}, now)
+	if err != nil {
+		t.Fatalf("parseFreeze: %v", err)
+	}
+	if f.Window != "22:00-06:00" || !reflect.DeepEqual(f.Days, []time.Weekday{time.Friday, time.Saturday}) {
+		t.Errorf("unexpected weekly freeze: %+v", f)
+	}
+
+	bad := [][]string{
+		{"home"},
+		{"home", "until", "2026-04-01"},
+		{"home", "for", "-1h"},
+		{"home", "daily", "9-17"},
+		{"home", "weekly", "fry", "22:00-06:00"},
+		{"home", "sometimes", "x"},
+		{"home", "daily", "22:00-06:00", "tz=Nowhere/Land"},
+	}
+	for _, args := range bad {
+		if _, err := parseFreeze(args, now); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
@@ -1,34 +1,32 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+	"github.com/kfilin/watchtower-masterbot/servers"
 )
 
 func (wb *WatchtowerBot) handleAddServer(message *tgbotapi.Message) {
-	// Handle button click
-	if message.Text == "🚀 Add Server" {
-		wb.sendMessage(message.Chat.ID,
-			"📥 *Add a Watchtower Server*\n\n"+
-				"*Usage:* `/add_server <nickname> <watchtower_url> <token>`\n\n"+
-				"*Examples:*\n"+
-				"• `/add_server home https://watchtower.local your_token_here`\n"+
-				"• `/add_server vps https://watchtower.yourserver.com abc123token`\n\n"+
-				"*Parameters:*\n"+
-				"• *nickname* - Easy-to-remember name (home, vps, work)\n"+
-				"• *watchtower_url* - Your Watchtower API endpoint\n"+
-				"• *token* - Watchtower authentication token")
+	args := strings.Fields(message.CommandArguments())
+
+	// Button click or bare command: walk through it step by step
+	if message.Text == menuAddServer || len(args) == 0 {
+		wb.startAddServerWizard(message)
 		return
 	}
 
-	args := strings.Fields(message.CommandArguments())
-
 	if len(args) < 3 {
 		wb.sendMessage(message.Chat.ID,
 			"📥 *Add a Watchtower Server*\n\n"+
+				"Send `/add_server` on its own to be guided step by step, or:\n\n"+
 				"*Usage:* `/add_server <nickname> <watchtower_url> <token>`\n\n"+
 				"*Examples:*\n"+
 				"• `/add_server home https://watchtower.local your_token_here`\n"+
@@ -40,13 +38,14 @@ func (wb *WatchtowerBot) handleAddServer(message *tgbotapi.Message) {
 		return
 	}
 
+	// The command contains the token - don't leave it in the chat history
+	wb.deleteMessage(message.Chat.ID, message.MessageID)
+
 	nickname := args[0]
 	watchtowerURL := args[1]
 	token := args[2]
 
-	if !strings.HasPrefix(watchtowerURL, "http") {
-		watchtowerURL = "https://" + watchtowerURL
-	}
+	watchtowerURL = withScheme(watchtowerURL, "https")
 
 	err := wb.serverManager.AddServer(message.From.ID, nickname, watchtowerURL, token)
 	if err != nil {
@@ -65,46 +64,28 @@ func (wb *WatchtowerBot) handleAddServer(message *tgbotapi.Message) {
 }
 
 func (wb *WatchtowerBot) handleListServers(message *tgbotapi.Message) {
-	serverList, err := wb.serverManager.ListServers(message.From.ID)
+	text, markup, err := wb.serverListKeyboard(message.From.ID)
 	if err != nil {
 		wb.sendMessage(message.Chat.ID, "❌ No servers configured. Use /add_server to add your first server.")
 		return
 	}
 
-	currentServer, err := wb.serverManager.GetCurrentServer(message.From.ID)
-	currentServerName := ""
-	if err == nil {
-		currentServerName = currentServer.Nickname
-	}
-
-	var response strings.Builder
-	response.WriteString("📋 *Your Watchtower Servers*\n\n")
-
-	for i, server := range serverList {
-		indicator := "  "
-		if server == currentServerName {
-			indicator = "📍"
-		}
-		// Fixed alignment - consistent spacing with monospace
-		response.WriteString(fmt.Sprintf("%s `%s`\n", indicator, server))
+	msg := tgbotapi.NewMessage(message.Chat.ID, text+
+		"\n\n🚀 *Quick Actions:*\n"+
+		"• Use `/server <name>` to switch active server\n"+
+		"• Use `/wt_update` to trigger container updates\n"+
+		"• Use `/add_server` to add more servers")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = markup
 
-		if i >= 9 {
-			response.WriteString("\n... and more")
-			break
-		}
+	if _, err := wb.API.Send(msg); err != nil {
+		log.Printf("❌ Failed to send server list: %v", err)
 	}
-
-	response.WriteString("\n\n🚀 *Quick Actions:*\n")
-	response.WriteString("• Use `/server <name>` to switch active server\n")
-	response.WriteString("• Use `/wt_update` to trigger container updates\n")
-	response.WriteString("• Use `/add_server` to add more servers")
-
-	wb.sendMessage(message.Chat.ID, response.String())
 }
 
 func (wb *WatchtowerBot) handleSwitchServer(message *tgbotapi.Message) {
 	// Handle button click
-	if message.Text == "🔄 Switch Server" {
+	if message.Text == menuSwitchServer {
 		currentServer, err := wb.serverManager.GetCurrentServer(message.From.ID)
 		if err != nil {
 			wb.sendMessage(message.Chat.ID,
@@ -155,8 +136,135 @@ func (wb *WatchtowerBot) handleSwitchServer(message *tgbotapi.Message) {
 			"Use **/wt_update** to trigger updates or **/servers** to switch again.", targetServer))
 }
 
+func (wb *WatchtowerBot) handleRemoveServer(message *tgbotapi.Message) {
+	nickname := strings.TrimSpace(message.CommandArguments())
+	if nickname == "" {
+		wb.sendMessage(message.Chat.ID,
+			"🗑 *Remove a Server*\n\n"+
+				"*Usage:* `/remove_server <server_name>`\n\n"+
+				"Use `/servers` to see your available servers.")
+		return
+	}
+
+	names, _ := wb.serverManager.ListServers(message.From.ID)
+	if !contains(names, nickname) {
+		wb.sendMessage(message.Chat.ID,
+			fmt.Sprintf("❌ Server `%s` not found.\n\n"+
+				"Use **/servers** to see your available servers.", nickname))
+		return
+	}
+	if !callbackFits("rm", nickname) {
+		wb.sendMessage(message.Chat.ID, renameForButtons(nickname))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID,
+		fmt.Sprintf("⚠️ *Remove server* `%s`*?*\n\n"+
+			"The stored URL and token will be deleted. This cannot be undone.", nickname))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			wb.button(message.From.ID, "🗑 Remove", "rm", nickname),
+			wb.button(message.From.ID, "✖️ Cancel", "cancel", ""),
+		),
+	)
+
+	if _, err := wb.API.Send(msg); err != nil {
+		log.Printf("❌ Failed to send remove confirmation: %v", err)
+	}
+}
+
+func (wb *WatchtowerBot) handleRenameServer(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 {
+		wb.sendMessage(message.Chat.ID,
+			"✏️ *Rename a Server*\n\n"+
+				"*Usage:* `/rename_server <old_name> <new_name>`\n\n"+
+				"*Example:* `/rename_server home homelab`")
+		return
+	}
+
+	if err := wb.serverManager.RenameServer(message.From.ID, args[0], args[1]); err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error renaming server: `%v`", err))
+		return
+	}
+
+	wb.sendMessage(message.Chat.ID,
+		fmt.Sprintf("✅ Server `%s` renamed to `%s`.", args[0], args[1]))
+}
+
+func (wb *WatchtowerBot) handleEditServer(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 3 || (args[1] != "url" && args[1] != "token" && args[1] != "agent") {
+		wb.sendMessage(message.Chat.ID,
+			"🛠 *Edit a Server*\n\n"+
+				"*Usage:*\n"+
+				"• `/edit_server <name> url <watchtower_url>`\n"+
+				"• `/edit_server <name> token <token>`\n"+
+				"• `/edit_server <name> agent <docker_api_url|none>`\n\n"+
+				"*Example:* `/edit_server home url https://watchtower.local`\n\n"+
+				"💡 The *agent* is an optional Docker Engine API endpoint (e.g. a read-only "+
+				"docker-socket-proxy) used by `/containers`.")
+		return
+	}
+
+	nickname, field, value := args[0], args[1], args[2]
+
+	var err error
+	switch field {
+	case "url":
+		value = withScheme(value, "https")
+		err = wb.serverManager.UpdateServerURL(message.From.ID, nickname, value)
+	case "agent":
+		if value == "none" {
+			value = ""
+		} else {
+			value = withScheme(value, "http")
+		}
+		err = wb.serverManager.UpdateServerAgentURL(message.From.ID, nickname, value)
+		if value == "" {
+			value = "none"
+		}
+	case "token":
+		// Don't leave the new token sitting in the chat history
+		wb.deleteMessage(message.Chat.ID, message.MessageID)
+		err = wb.serverManager.UpdateServerToken(message.From.ID, nickname, value)
+		value = "••••••••"
+	}
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error updating server: `%v`", err))
+		return
+	}
+
+	wb.sendMessage(message.Chat.ID,
+		fmt.Sprintf("✅ *Server %s updated*\n\n🔧 *%s:* `%s`", nickname, field, value))
+}
+
+func (wb *WatchtowerBot) handleCancel(message *tgbotapi.Message) {
+	// In-flight requests were already aborted when /cancel arrived
+	_, cancelled := wb.cancelConversation(message.Chat.ID)
+	if !cancelled && wb.takeAborted(message.Chat.ID) == 0 {
+		wb.sendMessage(message.Chat.ID, "🤷 Nothing to cancel.")
+		return
+	}
+	wb.sendMessage(message.Chat.ID, "✖️ Cancelled.")
+}
+
 func (wb *WatchtowerBot) handleUpdate(message *tgbotapi.Message) {
+	// "/wt_update home,vps" updates the named servers instead of the active one
+	nicknames, force := parseUpdateArgs(message.CommandArguments())
+	if len(nicknames) > 0 {
+		wb.runFleetUpdate(message, nicknames, force)
+		return
+	}
+
 	currentServer, err := wb.serverManager.GetCurrentServer(message.From.ID)
+	if errors.Is(err, servers.ErrWrongKey) {
+		wb.sendMessage(message.Chat.ID,
+			fmt.Sprintf("🔐 *Cannot decrypt the server token*\n\n`%v`\n\n"+
+				"Check that `ENCRYPTION_KEY` matches the key the server was added with.", err))
+		return
+	}
 	if err != nil {
 		wb.sendMessage(message.Chat.ID,
 			"❌ No active server configured.\n\n"+
@@ -164,14 +272,10 @@ func (wb *WatchtowerBot) handleUpdate(message *tgbotapi.Message) {
 		return
 	}
 
-	// Send immediate feedback
-	wb.sendMessage(message.Chat.ID,
-		fmt.Sprintf("🚀 *Triggering container update...*\n\n"+
-			"🌐 Server: `%s`\n"+
-			"📡 URL: %s\n\n"+
-			"⏱️ *This may take 2-5 minutes...*\n"+
-			"I'll notify you when complete.",
-			currentServer.Nickname, currentServer.WatchtowerURL))
+	if err := wb.checkFreeze(message.From.ID, currentServer.Nickname, force); err != nil {
+		wb.sendMessage(message.Chat.ID, frozenMessage(currentServer.Nickname, err))
+		return
+	}
 
 	client, err := wb.serverManager.GetAPIClient(message.From.ID)
 	if err != nil {
@@ -180,14 +284,32 @@ func (wb *WatchtowerBot) handleUpdate(message *tgbotapi.Message) {
 		return
 	}
 
-	updateResponse, err := client.TriggerUpdate()
-	if err != nil {
-		wb.sendMessage(message.Chat.ID,
-			fmt.Sprintf("❌ Failed to trigger update: %v", err))
-		return
+	// The scan runs in the background; the result is posted when it finishes
+	chatID := message.Chat.ID
+	spec := jobs.Spec{
+		UserID:      message.From.ID,
+		ChatID:      chatID,
+		Server:      currentServer.Nickname,
+		Workspace:   wb.serverManager.WorkspaceID(message.From.ID),
+		Source:      servers.SourceManual,
+		TriggeredBy: message.From.ID,
 	}
+	job := wb.startUpdateJob(spec, client, func(j jobs.Job) {
+		wb.sendMessage(chatID, formatJobResult(j)+"\n\n🔍 *Use `/servers` to manage your servers*")
+	})
+
+	wb.sendMessage(chatID,
+		fmt.Sprintf("🚀 *Triggering container update...*\n\n"+
+			"🌐 Server: `%s`\n"+
+			"📡 URL: %s\n"+
+			"🆔 Job: `%s`\n\n"+
+			"⏱️ *This may take 2-5 minutes...*\n"+
+			"I'll notify you when complete. Check on it with `/job %s`, or send /cancel to abort.",
+			currentServer.Nickname, currentServer.WatchtowerURL, job.ID, job.ID))
+}
 
-	// Build response EXACTLY as requested
+// formatUpdateResult renders the updated/failed containers of a Watchtower run
+func formatUpdateResult(updateResponse *api.UpdateResponse) string {
 	var response strings.Builder
 	response.WriteString("✅ *Update Triggered Successfully!*\n\n")
 	response.WriteString("📋 *Result:* Watchtower is checking for updates\n\n")
@@ -196,6 +318,12 @@ func (wb *WatchtowerBot) handleUpdate(message *tgbotapi.Message) {
 	updatedCount := len(updateResponse.Updated)
 	failedCount := len(updateResponse.Failed)
 
+	// Watchtower may only acknowledge the run without naming containers
+	if updatedCount == 0 && failedCount == 0 && updateResponse.Message != "" {
+		response.WriteString(fmt.Sprintf("ℹ️ %s\n", updateResponse.Message))
+		return response.String()
+	}
+
 	response.WriteString(fmt.Sprintf("🔄 *Containers updated:* `%d`\n", updatedCount))
 
 	if updatedCount > 0 {
@@ -211,11 +339,170 @@ func (wb *WatchtowerBot) handleUpdate(message *tgbotapi.Message) {
 		response.WriteString(fmt.Sprintf("💥 *Failed container(s):* `%s`\n", failedNames))
 	}
 
-	response.WriteString("\n🔍 *Use `/servers` to manage your servers*")
+	return response.String()
+}
+
+func (wb *WatchtowerBot) handleContainers(message *tgbotapi.Message) {
+	nickname := strings.TrimSpace(message.CommandArguments())
+	if nickname == "" {
+		currentServer, err := wb.serverManager.GetCurrentServer(message.From.ID)
+		if err != nil {
+			wb.sendMessage(message.Chat.ID,
+				"❌ No active server configured.\n\n"+
+					"Use **/add_server** to add your first Watchtower server.")
+			return
+		}
+		nickname = currentServer.Nickname
+	}
+
+	client, err := wb.serverManager.GetAPIClientFor(message.From.ID, nickname)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Failed to create API client: `%v`", err))
+		return
+	}
+
+	ctx, done := wb.requestContext(message.Chat.ID)
+	defer done()
+
+	containers, err := client.GetContainers(ctx)
+	if errors.Is(err, api.ErrNoInventory) {
+		wb.sendMessage(message.Chat.ID,
+			fmt.Sprintf("📦 *No container inventory for* `%s`\n\n"+
+				"Watchtower's metrics don't list individual containers on this host.\n"+
+				"Point the bot at a Docker Engine API endpoint (e.g. a read-only docker-socket-proxy):\n"+
+				"`/edit_server %s agent http://host:2375`", nickname, nickname))
+		return
+	}
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, describeAPIError("list containers", err))
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("📦 *Containers on* `%s` (%d)\n\n", nickname, len(containers)))
+	for _, ct := range containers {
+		response.WriteString(fmt.Sprintf("• `%s` - %s\n   🖼 `%s`\n", ct.Name, ct.Status, ct.Image))
+		if ct.Digest != "" {
+			response.WriteString(fmt.Sprintf("   🔖 `%s`\n", shortDigest(ct.Digest)))
+		}
+	}
+	if len(containers) > 0 {
+		response.WriteString(fmt.Sprintf("\n🕒 *Checked:* %s", containers[0].LastChecked.Format("2006-01-02 15:04:05")))
+	}
 
 	wb.sendMessage(message.Chat.ID, response.String())
 }
 
+func (wb *WatchtowerBot) handleMetrics(message *tgbotapi.Message) {
+	nickname := strings.TrimSpace(message.CommandArguments())
+	if nickname == "" {
+		currentServer, err := wb.serverManager.GetCurrentServer(message.From.ID)
+		if err != nil {
+			wb.sendMessage(message.Chat.ID,
+				"❌ No active server configured.\n\n"+
+					"Use **/add_server** to add your first Watchtower server.")
+			return
+		}
+		nickname = currentServer.Nickname
+	}
+
+	client, err := wb.serverManager.GetAPIClientFor(message.From.ID, nickname)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Failed to create API client: `%v`", err))
+		return
+	}
+
+	ctx, done := wb.requestContext(message.Chat.ID)
+	defer done()
+
+	metrics, err := client.GetMetrics(ctx)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, describeAPIError("fetch metrics", err))
+		return
+	}
+
+	stats := metrics.WatchtowerStats()
+	snap := servers.MetricsSnapshot{
+		Scanned:      stats.Scanned,
+		Updated:      stats.Updated,
+		Failed:       stats.Failed,
+		ScansTotal:   stats.ScansTotal,
+		ScansSkipped: stats.ScansSkipped,
+		TakenAt:      time.Now(),
+	}
+
+	// Saving the snapshot changes the server's stored state, so roles that
+	// may only view get deltas against the last saved snapshot instead
+	var previous *servers.MetricsSnapshot
+	if wb.access.Check(message.From.ID, access.ActionManage) == nil {
+		if previous, err = wb.serverManager.RecordMetrics(message.From.ID, nickname, snap); err != nil {
+			log.Printf("⚠️ Failed to save metrics snapshot for %s: %v", nickname, err)
+		}
+	} else if server, err := wb.serverManager.GetServer(message.From.ID, nickname); err == nil {
+		previous = server.LastMetrics
+	}
+
+	wb.sendMessage(message.Chat.ID, formatMetrics(nickname, snap, previous))
+}
+
+// formatMetrics renders a metrics snapshot with deltas against the previous one
+func formatMetrics(nickname string, snap servers.MetricsSnapshot, previous *servers.MetricsSnapshot) string {
+	var before servers.MetricsSnapshot
+	if previous != nil {
+		before = *previous
+	}
+	delta := func(now, then int) string {
+		if previous == nil {
+			return ""
+		}
+		return formatDelta(now - then)
+	}
+
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("📈 *Watchtower metrics for* `%s`\n\n", nickname))
+	response.WriteString("*Last scan:*\n")
+	response.WriteString(fmt.Sprintf("🔍 Scanned: `%d`%s\n", snap.Scanned, delta(snap.Scanned, before.Scanned)))
+	response.WriteString(fmt.Sprintf("🔄 Updated: `%d`%s\n", snap.Updated, delta(snap.Updated, before.Updated)))
+	response.WriteString(fmt.Sprintf("❌ Failed: `%d`%s\n\n", snap.Failed, delta(snap.Failed, before.Failed)))
+
+	response.WriteString("*Since Watchtower started:*\n")
+	if previous != nil && snap.ScansTotal < before.ScansTotal {
+		// Counters reset when Watchtower restarts; a negative delta means nothing
+		response.WriteString(fmt.Sprintf("🔁 Scans: `%d` (restarted)\n", snap.ScansTotal))
+		response.WriteString(fmt.Sprintf("⏭ Skipped: `%d`\n", snap.ScansSkipped))
+	} else {
+		response.WriteString(fmt.Sprintf("🔁 Scans: `%d`%s\n", snap.ScansTotal, delta(snap.ScansTotal, before.ScansTotal)))
+		response.WriteString(fmt.Sprintf("⏭ Skipped: `%d`%s\n", snap.ScansSkipped, delta(snap.ScansSkipped, before.ScansSkipped)))
+	}
+
+	if previous != nil {
+		response.WriteString(fmt.Sprintf("\n📊 Changes since %s (%s ago)",
+			previous.TakenAt.Format("Jan 02 15:04"), snap.TakenAt.Sub(previous.TakenAt).Round(time.Minute)))
+	} else {
+		response.WriteString("\n📊 First snapshot - run `/metrics` again to see changes")
+	}
+	return response.String()
+}
+
+func formatDelta(d int) string {
+	switch {
+	case d > 0:
+		return fmt.Sprintf(" (+%d)", d)
+	case d < 0:
+		return fmt.Sprintf(" (%d)", d)
+	}
+	return " (±0)"
+}
+
+// shortDigest abbreviates "sha256:abcdef..." for display
+func shortDigest(digest string) string {
+	algo, hash, ok := strings.Cut(digest, ":")
+	if !ok || len(hash) <= 12 {
+		return digest
+	}
+	return algo + ":" + hash[:12]
+}
+
 func (wb *WatchtowerBot) handleTerminal(message *tgbotapi.Message) {
 	if wb.webAppURL == "" {
 		wb.sendMessage(message.Chat.ID, "❌ *Retro Terminal* is not configured.\n\n"+
@@ -240,3 +527,21 @@ func (wb *WatchtowerBot) handleTerminal(message *tgbotapi.Message) {
 		log.Printf("❌ Failed to send terminal message: %v", err)
 	}
 }
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+// withScheme prefixes raw with scheme unless it names one; servers.ValidateURL
+// still decides whether the result is usable
+func withScheme(raw, scheme string) string {
+	if strings.Contains(raw, "://") {
+		return raw
+	}
+	return scheme + "://" + raw
+}
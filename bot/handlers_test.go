@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+func TestWithScheme(t *testing.T) {
+	tests := []struct {
+		raw, want string
+		valid     bool
+	}{
+		{"watchtower.local", "https://watchtower.local", true},
+		{"http://watchtower.local:8080", "http://watchtower.local:8080", true},
+		{"httpbin.org", "https://httpbin.org", true},
+		{"ftp://watchtower.local", "ftp://watchtower.local", false},
+		{"https://", "https://", false},
+	}
+	for _, tt := range tests {
+		got := withScheme(tt.raw, "https")
+		if got != tt.want {
+			t.Errorf("withScheme(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+		if err := servers.ValidateURL(got); (err == nil) != tt.valid || (err != nil && !errors.Is(err, servers.ErrInvalidURL)) {
+			t.Errorf("ValidateURL(%q) = %v, want valid=%v", got, err, tt.valid)
+		}
+	}
+}
+
+func TestMetricsSnapshotNeedsManage(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("watchtower_containers_scanned 3\n"))
+	}))
+	defer watchtower.Close()
+
+	const viewer = 7
+	wb, telegram := newTestBot(t, time.Minute)
+	if err := wb.access.Grant(testOwner, viewer, access.RoleViewer); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	for _, userID := range []int64{testOwner, viewer} {
+		if err := wb.serverManager.AddServer(userID, "home", watchtower.URL, "token"); err != nil {
+			t.Fatalf("AddServer: %v", err)
+		}
+		wb.Handle(tgbotapi.Update{Message: chatMessage(userID, userID, "/metrics")})
+	}
+
+	if server, _ := wb.serverManager.GetServer(testOwner, "home"); server.LastMetrics == nil || server.LastMetrics.Scanned != 3 {
+		t.Errorf("the owner's snapshot was not saved: %+v", server.LastMetrics)
+	}
+	if server, _ := wb.serverManager.GetServer(viewer, "home"); server.LastMetrics != nil {
+		t.Errorf("a viewer's /metrics must not save a snapshot: %+v", server.LastMetrics)
+	}
+	if sent := telegram.messages(); len(sent) != 2 || !strings.Contains(sent[1], "Scanned: `3`") {
+		t.Errorf("expected metrics for both users, got %q", sent)
+	}
+}
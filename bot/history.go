@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// /history shows historyDefaultLimit entries unless asked for more, up to historyMaxLimit
+const (
+	historyDefaultLimit = 10
+	historyMaxLimit     = 50
+)
+
+// recordJob stores a finished job in the owner's update history
+func (wb *WatchtowerBot) recordJob(j jobs.Job) {
+	entry := servers.HistoryEntry{
+		Server:      j.Server,
+		Source:      j.Source,
+		TriggeredBy: j.TriggeredBy,
+		JobID:       j.ID,
+		Started:     j.Started,
+		Duration:    j.Duration(),
+		Status:      string(j.State),
+		Message:     j.Message,
+		Error:       j.Error,
+	}
+	if j.Response != nil {
+		entry.Updated = j.Response.Updated
+		entry.Failed = j.Response.Failed
+	}
+	if _, err := wb.serverManager.RecordHistory(j.Workspace, entry); err != nil {
+		log.Printf("❌ Failed to record job %s in history: %v", j.ID, err)
+	}
+}
+
+// recordReport stores a session report Watchtower sent on its own
+func (wb *WatchtowerBot) recordReport(workspaceID string, nickname string, report *api.Report) {
+	entry := servers.HistoryEntry{
+		Server:  nickname,
+		Source:  servers.SourceWebhook,
+		Started: time.Now(),
+		Status:  servers.HistoryStatusReported,
+		Message: fmt.Sprintf("%d scanned, %d updated, %d failed", report.Scanned, report.Updated, report.Failed),
+	}
+	for _, c := range report.Containers {
+		switch c.Status {
+		case "updated":
+			entry.Updated = append(entry.Updated, c.Name)
+		case "failed":
+			entry.Failed = append(entry.Failed, c.Name)
+		}
+	}
+	if _, err := wb.serverManager.RecordHistory(workspaceID, entry); err != nil {
+		log.Printf("❌ Failed to record Watchtower report for %s in history: %v", nickname, err)
+	}
+}
+
+// handleHistory shows "/history [server] [n]"
+func (wb *WatchtowerBot) handleHistory(message *tgbotapi.Message) {
+	server, limit, err := parseHistoryArgs(message.CommandArguments())
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ %v\n\n*Usage:* `/history [server] [n]`", err))
+		return
+	}
+
+	entries, err := wb.serverManager.History(message.From.ID, server, limit)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error loading history: `%v`", err))
+		return
+	}
+	if len(entries) == 0 {
+		wb.sendMessage(message.Chat.ID, "📭 No updates recorded yet.\n\nStart one with `/wt_update`.")
+		return
+	}
+
+	var response strings.Builder
+	if server != "" {
+		response.WriteString(fmt.Sprintf("📜 *Update history of* `%s`\n", server))
+	} else {
+		response.WriteString("📜 *Update history*\n")
+	}
+	for _, e := range entries {
+		response.WriteString("\n" + formatHistoryEntry(e) + "\n")
+	}
+	wb.sendMessage(message.Chat.ID, response.String())
+}
+
+// parseHistoryArgs reads an optional server name and an optional count, in any order
+func parseHistoryArgs(args string) (string, int, error) {
+	server, limit := "", historyDefaultLimit
+	for _, arg := range strings.Fields(args) {
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n < 1 || n > historyMaxLimit {
+				return "", 0, fmt.Errorf("count must be between 1 and %d", historyMaxLimit)
+			}
+			limit = n
+			continue
+		}
+		if server != "" {
+			return "", 0, fmt.Errorf("unexpected argument %q", arg)
+		}
+		server = arg
+	}
+	return server, limit, nil
+}
+
+func formatHistoryEntry(e servers.HistoryEntry) string {
+	icon := "✅"
+	switch {
+	case e.Status == string(jobs.StateFailed):
+		icon = "❌"
+	case e.Status == string(jobs.StateCancelled):
+		icon = "✖️"
+	case len(e.Failed) > 0:
+		icon = "⚠️"
+	case e.Status == servers.HistoryStatusReported:
+		icon = "📬"
+	}
+
+	origin := e.Source
+	if e.TriggeredBy != 0 {
+		origin += fmt.Sprintf(" by `%d`", e.TriggeredBy)
+	}
+	line := fmt.Sprintf("%s `%s` · %s · %s", icon, e.Server, e.Started.UTC().Format("2006-01-02 15:04 UTC"), origin)
+	if e.Duration > 0 {
+		line += " · " + e.Duration.Round(time.Second).String()
+	}
+
+	if len(e.Updated) > 0 {
+		line += fmt.Sprintf("\n   🔄 `%s`", strings.Join(e.Updated, ", "))
+	}
+	if len(e.Failed) > 0 {
+		line += fmt.Sprintf("\n   ❌ `%s`", strings.Join(e.Failed, ", "))
+	}
+	if e.Error != "" {
+		line += fmt.Sprintf("\n   `%s`", strings.ReplaceAll(e.Error, "`", "'"))
+	} else if len(e.Updated) == 0 && len(e.Failed) == 0 {
+		if e.Message != "" {
+			line += "\n   " + e.Message
+		} else {
+			line += "\n   Nothing to update"
+		}
+	}
+	return line
+}
@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+func TestParseHistoryArgs(t *testing.T) {
+	cases := []struct {
+		args   string
+		server string
+		limit  int
+	}{
+		{"", "", historyDefaultLimit},
+		{"home", "home", historyDefaultLimit},
+		{"5", "", 5},
+		{"home 20", "home", 20},
+		{"20 home", "home", 20},
+	}
+	for _, c := range cases {
+		server, limit, err := parseHistoryArgs(c.args)
+		if err != nil || server != c.server || limit != c.limit {
+			t.Errorf("parseHistoryArgs(%q) = %q, %d, %v", c.args, server, limit, err)
+		}
+	}
+
+	for _, bad := range []string{"0", "51", "home vps"} {
+		if _, _, err := parseHistoryArgs(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestAcceptedUpdateRecordsNoContainers(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer watchtower.Close()
+
+	wb, _ := newTestBot(t, time.Minute)
+	if err := wb.serverManager.AddServer(testOwner, "home", watchtower.URL, "token"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	spec := jobs.Spec{UserID: testOwner, ChatID: 1, Server: "home", Workspace: wb.serverManager.WorkspaceID(testOwner), Source: servers.SourceManual}
+	done := make(chan jobs.Job, 1)
+	wb.startUpdateJob(spec, api.NewWatchtowerClient(watchtower.URL, "token"), func(j jobs.Job) { done <- j })
+
+	j := <-done
+	if j.State != jobs.StateSucceeded || len(j.Results) != 0 || j.Message == "" {
+		t.Errorf("expected a message-only job, got %+v", j)
+	}
+	entries, err := wb.serverManager.History(testOwner, "home", 10)
+	if err != nil || len(entries) != 1 || len(entries[0].Updated) != 0 {
+		t.Fatalf("expected one entry without containers, got %+v (%v)", entries, err)
+	}
+	if line := formatHistoryEntry(entries[0]); !strings.Contains(line, j.Message) {
+		t.Errorf("history line lacks Watchtower's message: %s", line)
+	}
+}
@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/hooks"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+)
+
+// reportLogLines caps how many log lines of a report are forwarded
+const reportLogLines = 10
+
+const hookUsage = "📬 *Watchtower webhooks*\n\n" +
+	"`/hook enable <server>` - Create the webhook, or rotate its secret\n" +
+	"`/hook disable <server>` - Stop accepting reports\n\n" +
+	"Watchtower then posts its scan reports here, including updates it runs on its own schedule."
+
+func (wb *WatchtowerBot) handleHook(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 {
+		wb.sendMessage(message.Chat.ID, hookUsage)
+		return
+	}
+
+	nickname := args[1]
+	switch args[0] {
+	case "enable":
+		id, secret, err := wb.serverManager.EnableHook(message.From.ID, nickname)
+		if err != nil {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error enabling webhook: `%v`", err))
+			return
+		}
+		log.Printf("📬 User %d enabled the webhook of %s", message.From.ID, nickname)
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("✅ *Webhook enabled for* `%s`\n\n"+
+			"Set this on the Watchtower container:\n\n"+
+			"`WATCHTOWER_NOTIFICATION_URL=%s`\n"+
+			"`WATCHTOWER_NOTIFICATION_REPORT=true`\n\n"+
+			"🔐 The secret is shown only once. Run `/hook enable %s` again to rotate it.",
+			nickname, wb.hookNotificationURL(id, secret), nickname))
+	case "disable":
+		if err := wb.serverManager.DisableHook(message.From.ID, nickname); err != nil {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error disabling webhook: `%v`", err))
+			return
+		}
+		log.Printf("📬 User %d disabled the webhook of %s", message.From.ID, nickname)
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("🗑 Webhook for `%s` disabled.", nickname))
+	default:
+		wb.sendMessage(message.Chat.ID, hookUsage)
+	}
+}
+
+// hookNotificationURL builds the shoutrrr generic URL for a webhook. The host
+// is taken from WEBAPP_URL, which is served by the same HTTP server.
+func (wb *WatchtowerBot) hookNotificationURL(id, secret string) string {
+	host, scheme := "<bot-host>", "https"
+	if u, err := url.Parse(wb.webAppURL); err == nil && u.Host != "" {
+		host = u.Host
+		scheme = u.Scheme
+	}
+	return fmt.Sprintf("generic+%s://%s%s%s?secret=%s", scheme, host, hooks.PathPrefix, id, secret)
+}
+
+// NotifyWatchtowerReport forwards a webhook report to every member of the
+// workspace owning the server. It is the hooks.NotifyFunc wired up in main.
+func (wb *WatchtowerBot) NotifyWatchtowerReport(workspaceID string, nickname string, report *api.Report) {
+	// Plain log notifications (startup banners and the like) are not updates
+	if report.HasSummary {
+		wb.recordReport(workspaceID, nickname, report)
+	}
+
+	text := formatReport(nickname, report)
+	for _, userID := range wb.serverManager.WorkspaceMembers(workspaceID) {
+		if err := wb.access.Check(userID, access.ActionView); err != nil {
+			log.Printf("⛔ Dropped Watchtower report for %s: user %d: %v", nickname, userID, err)
+			continue
+		}
+		wb.sendMessage(userID, text)
+	}
+}
+
+func formatReport(nickname string, report *api.Report) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📬 *Watchtower report* from `%s`\n", nickname))
+
+	if report.HasSummary {
+		text.WriteString(fmt.Sprintf("\n🔍 %d scanned · ✅ %d updated · ❌ %d failed\n",
+			report.Scanned, report.Updated, report.Failed))
+	}
+
+	for _, c := range report.Containers {
+		// Fresh containers are the common case and only add noise
+		if c.Status == "fresh" {
+			continue
+		}
+		icon := "⚠️"
+		switch c.Status {
+		case "updated":
+			icon = "✅"
+		case "failed":
+			icon = "❌"
+		case "skipped":
+			icon = "⏭"
+		}
+		line := fmt.Sprintf("%s `%s` (%s)", icon, c.Name, c.Status)
+		if c.Detail != "" {
+			line += fmt.Sprintf(": `%s`", strings.ReplaceAll(c.Detail, "`", "'"))
+		}
+		text.WriteString("\n" + line)
+	}
+
+	if len(report.Logs) > 0 {
+		logs := report.Logs
+		if len(logs) > reportLogLines {
+			logs = append(logs[:reportLogLines:reportLogLines], fmt.Sprintf("... %d more", len(report.Logs)-reportLogLines))
+		}
+		text.WriteString("\n\n```\n" + strings.ReplaceAll(strings.Join(logs, "\n"), "`", "'") + "\n```")
+	}
+	return text.String()
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+)
+
+// How many jobs /jobs lists
+const jobsListLimit = 10
+
+// startUpdateJob triggers an update on client in the background.
+// The job is aborted by /cancel in spec.ChatID or when the bot stops. Its
+// final state is recorded in the update history and passed to onDone.
+func (wb *WatchtowerBot) startUpdateJob(spec jobs.Spec, client *api.WatchtowerClient, onDone func(jobs.Job)) jobs.Job {
+	ctx, done := wb.requestContext(spec.ChatID)
+
+	job := wb.jobs.Start(ctx, spec, client.TriggerUpdate, func(j jobs.Job) {
+		done()
+		log.Printf("🏁 Job %s on %s %s after %s", j.ID, j.Server, j.State, j.Duration().Round(time.Second))
+		wb.recordJob(j)
+		onDone(j)
+	})
+	log.Printf("🚀 Job %s: %s update of %s started for user %d", job.ID, spec.Source, spec.Server, spec.UserID)
+	return job
+}
+
+func (wb *WatchtowerBot) handleJobs(message *tgbotapi.Message) {
+	list := wb.jobs.List(message.From.ID, jobsListLimit)
+	if len(list) == 0 {
+		wb.sendMessage(message.Chat.ID, "📭 No update jobs yet.\n\nStart one with `/wt_update`.")
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString("🗂 *Recent update jobs*\n\n")
+	for _, j := range list {
+		response.WriteString(fmt.Sprintf("%s `%s` on `%s` - %s, %s\n",
+			jobStateIcon(j.State), j.ID, j.Server, j.State, formatJobTiming(j)))
+	}
+	response.WriteString("\nUse `/job <id>` for details.")
+	wb.sendMessage(message.Chat.ID, response.String())
+}
+
+func (wb *WatchtowerBot) handleJob(message *tgbotapi.Message) {
+	id := strings.TrimSpace(message.CommandArguments())
+	if id == "" {
+		wb.sendMessage(message.Chat.ID, "❌ *Usage:* `/job <id>`\n\nSee `/jobs` for recent job IDs.")
+		return
+	}
+
+	j, ok := wb.jobs.Get(id)
+	if !ok || j.UserID != message.From.ID {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Job `%s` not found.\n\nSee `/jobs` for recent job IDs.", id))
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("%s *Job* `%s`\n\n", jobStateIcon(j.State), j.ID))
+	response.WriteString(fmt.Sprintf("🌐 *Server:* `%s`\n", j.Server))
+	response.WriteString(fmt.Sprintf("📌 *State:* %s\n", j.State))
+	response.WriteString(fmt.Sprintf("🕒 *Started:* %s\n", j.Started.Format("2006-01-02 15:04:05")))
+	if j.State.Done() {
+		response.WriteString(fmt.Sprintf("🏁 *Ended:* %s (%s)\n", j.Ended.Format("2006-01-02 15:04:05"), j.Duration().Round(time.Second)))
+	} else {
+		response.WriteString(fmt.Sprintf("⏱️ *Running for:* %s\n", j.Duration().Round(time.Second)))
+	}
+	if j.Error != "" {
+		response.WriteString(fmt.Sprintf("\n💥 *Error:* %s\n", shortAPIError(j.Err)))
+	}
+	if len(j.Results) > 0 {
+		response.WriteString("\n📦 *Containers:*\n")
+		for _, r := range j.Results {
+			response.WriteString(fmt.Sprintf("• `%s` - %s\n", r.Container, r.Status))
+		}
+	} else if j.State == jobs.StateSucceeded {
+		response.WriteString("\n📦 *Containers:* none updated\n")
+	}
+	wb.sendMessage(message.Chat.ID, response.String())
+}
+
+// formatJobResult renders the completion message of an update job
+func formatJobResult(j jobs.Job) string {
+	footer := fmt.Sprintf("\n🆔 Job `%s` on `%s` (%s)", j.ID, j.Server, j.Duration().Round(time.Second))
+	switch j.State {
+	case jobs.StateSucceeded:
+		return formatUpdateResult(j.Response) + footer
+	case jobs.StateCancelled:
+		return "✖️ *Update aborted*\n" + footer
+	}
+	return describeAPIError("trigger update", j.Err) + "\n" + footer
+}
+
+func formatJobTiming(j jobs.Job) string {
+	if j.State.Done() {
+		return fmt.Sprintf("%s (%s)", j.Started.Format("Jan 02 15:04"), j.Duration().Round(time.Second))
+	}
+	return fmt.Sprintf("running for %s", j.Duration().Round(time.Second))
+}
+
+func jobStateIcon(state jobs.State) string {
+	switch state {
+	case jobs.StateRunning:
+		return "🔄"
+	case jobs.StateSucceeded:
+		return "✅"
+	case jobs.StateCancelled:
+		return "✖️"
+	}
+	return "❌"
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// inflight tracks cancellable Watchtower calls so /cancel can abort them
+type inflight struct {
+	mu      sync.Mutex
+	next    uint64
+	byChat  map[int64]map[uint64]context.CancelFunc
+	aborted map[int64]int
+}
+
+func newInflight() *inflight {
+	return &inflight{
+		byChat:  make(map[int64]map[uint64]context.CancelFunc),
+		aborted: make(map[int64]int),
+	}
+}
+
+// requestContext returns a context for a Watchtower call made on behalf of
+// chatID. It is cancelled by /cancel in that chat or when the bot stops.
+// The returned function must be called once the call is done.
+func (wb *WatchtowerBot) requestContext(chatID int64) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(wb.ctx)
+
+	r := wb.inflight
+	r.mu.Lock()
+	r.next++
+	id := r.next
+	if r.byChat[chatID] == nil {
+		r.byChat[chatID] = make(map[uint64]context.CancelFunc)
+	}
+	r.byChat[chatID][id] = cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.byChat[chatID], id)
+		if len(r.byChat[chatID]) == 0 {
+			delete(r.byChat, chatID)
+		}
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// abortRequests cancels every in-flight call for chatID and returns how many were running
+func (wb *WatchtowerBot) abortRequests(chatID int64) int {
+	r := wb.inflight
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.byChat[chatID])
+	for _, cancel := range r.byChat[chatID] {
+		cancel()
+	}
+	delete(r.byChat, chatID)
+	if n > 0 {
+		r.aborted[chatID] += n
+	}
+	return n
+}
+
+// takeAborted returns and resets the number of calls aborted in chatID since the last call
+func (wb *WatchtowerBot) takeAborted(chatID int64) int {
+	r := wb.inflight
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.aborted[chatID]
+	delete(r.aborted, chatID)
+	return n
+}
+
+// describeAPIError renders a Watchtower call failure for chat.
+// action reads like "trigger update" and is used for errors without a better hint.
+func describeAPIError(action string, err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "✖️ *Aborted* - the request was cancelled."
+	case errors.Is(err, api.ErrUnauthorized):
+		return "🔑 *Authentication failed*\n\nWatchtower rejected the token. Update it with `/edit_server <name> token <new>`."
+	case errors.Is(err, api.ErrTimeout):
+		return "⏱️ *Watchtower did not answer in time*\n\nThe run may still be in progress on the host."
+	case errors.Is(err, api.ErrUnavailable):
+		return fmt.Sprintf("📡 *Watchtower unavailable*\n\n`%v`", err)
+	}
+	return fmt.Sprintf("❌ Failed to %s: `%v`", action, err)
+}
+
+// shortAPIError renders a Watchtower call failure in a few words
+func shortAPIError(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "aborted"
+	case errors.Is(err, api.ErrUnauthorized):
+		return "authentication failed"
+	case errors.Is(err, api.ErrTimeout):
+		return "no answer in time (may still be running)"
+	case errors.Is(err, api.ErrUnavailable):
+		return "unavailable"
+	case errors.Is(err, servers.ErrFrozen):
+		return "frozen, skipped"
+	}
+	return fmt.Sprintf("`%v`", err)
+}
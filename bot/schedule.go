@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+	"github.com/kfilin/watchtower-masterbot/scheduler"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+const scheduleUsage = "⏰ *Scheduled updates*\n\n" +
+	"`/schedule set <server> <cron> [tz=<zone>] [window=HH:MM-HH:MM]`\n" +
+	"`/schedule show [server]`\n" +
+	"`/schedule clear <server>`\n\n" +
+	"*Examples:*\n" +
+	"`/schedule set home 0 4 * * *  tz=Europe/Berlin`\n" +
+	"`/schedule set vps @daily window=02:00-05:00`"
+
+func (wb *WatchtowerBot) handleSchedule(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		wb.sendMessage(message.Chat.ID, scheduleUsage)
+		return
+	}
+
+	switch args[0] {
+	case "set":
+		wb.scheduleSet(message, args[1:])
+	case "show":
+		wb.scheduleShow(message, args[1:])
+	case "clear":
+		wb.scheduleClear(message, args[1:])
+	default:
+		wb.sendMessage(message.Chat.ID, scheduleUsage)
+	}
+}
+
+func (wb *WatchtowerBot) scheduleSet(message *tgbotapi.Message, args []string) {
+	if len(args) < 2 {
+		wb.sendMessage(message.Chat.ID, scheduleUsage)
+		return
+	}
+
+	nickname := args[0]
+	sched := servers.UpdateSchedule{}
+	var cronFields []string
+	for _, arg := range args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "tz="):
+			sched.Timezone = strings.TrimPrefix(arg, "tz=")
+		case strings.HasPrefix(arg, "window="):
+			sched.Window = strings.TrimPrefix(arg, "window=")
+		default:
+			cronFields = append(cronFields, arg)
+		}
+	}
+	sched.Cron = strings.Join(cronFields, " ")
+
+	plan, err := scheduler.Compile(sched)
+	if err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Invalid schedule: `%v`\n\n%s", err, scheduleUsage))
+		return
+	}
+	sched.NextRun = plan.Next(time.Now())
+
+	if err := wb.serverManager.SetSchedule(message.From.ID, nickname, &sched); err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error saving schedule: `%v`", err))
+		return
+	}
+
+	log.Printf("⏰ User %d scheduled %s: %q tz=%q window=%q", message.From.ID, nickname, sched.Cron, sched.Timezone, sched.Window)
+	wb.sendMessage(message.Chat.ID, fmt.Sprintf("✅ *Schedule saved for* `%s`\n\n%s", nickname, formatSchedule(sched)))
+}
+
+func (wb *WatchtowerBot) scheduleShow(message *tgbotapi.Message, args []string) {
+	workspaceID := wb.serverManager.WorkspaceID(message.From.ID)
+	var found []servers.ScheduledServer
+	for _, entry := range wb.serverManager.ScheduledServers() {
+		if entry.Workspace == workspaceID && (len(args) == 0 || entry.Nickname == args[0]) {
+			found = append(found, entry)
+		}
+	}
+
+	if len(found) == 0 {
+		wb.sendMessage(message.Chat.ID, "📭 No scheduled updates.\n\nUse `/schedule set` to add one.")
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString("⏰ *Scheduled updates*\n")
+	for _, entry := range found {
+		response.WriteString(fmt.Sprintf("\n🌐 `%s`\n%s", entry.Nickname, formatSchedule(entry.Schedule)))
+	}
+	wb.sendMessage(message.Chat.ID, response.String())
+}
+
+func (wb *WatchtowerBot) scheduleClear(message *tgbotapi.Message, args []string) {
+	if len(args) != 1 {
+		wb.sendMessage(message.Chat.ID, "❌ *Usage:* `/schedule clear <server>`")
+		return
+	}
+
+	if err := wb.serverManager.SetSchedule(message.From.ID, args[0], nil); err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error clearing schedule: `%v`", err))
+		return
+	}
+	wb.sendMessage(message.Chat.ID, fmt.Sprintf("🗑 Schedule for `%s` cleared.", args[0]))
+}
+
+// formatSchedule renders a schedule with its times in the schedule's timezone
+func formatSchedule(sched servers.UpdateSchedule) string {
+	loc := time.UTC
+	if l, err := time.LoadLocation(sched.Timezone); err == nil {
+		loc = l
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🕒 *Cron:* `%s` (`%s`)\n", sched.Cron, loc))
+	if sched.Window != "" {
+		text.WriteString(fmt.Sprintf("🪟 *Window:* %s\n", sched.Window))
+	}
+	if !sched.NextRun.IsZero() {
+		text.WriteString(fmt.Sprintf("⏭ *Next run:* %s\n", sched.NextRun.In(loc).Format("2006-01-02 15:04 MST")))
+	}
+	if !sched.LastRun.IsZero() {
+		text.WriteString(fmt.Sprintf("⏮ *Last run:* %s\n", sched.LastRun.In(loc).Format("2006-01-02 15:04 MST")))
+	}
+	return text.String()
+}
+
+// RunScheduledUpdate is the scheduler's FireFunc: it starts an update job
+// and reports the result in the schedule owner's private chat
+func (wb *WatchtowerBot) RunScheduledUpdate(entry servers.ScheduledServer) {
+	userID, nickname := entry.UserID, entry.Nickname
+	chatID := userID
+
+	// A schedule runs with its owner's current access, so revoked users' schedules stop
+	if err := wb.access.Check(userID, access.ActionUpdate); err != nil {
+		log.Printf("⛔ Scheduled update of %s for user %d skipped: %v", nickname, userID, err)
+		return
+	}
+	// ... and so do the schedules of users who have left the workspace
+	if !wb.serverManager.IsWorkspaceMember(entry.Workspace, userID) {
+		log.Printf("⛔ Scheduled update of %s skipped: user %d is not a member of workspace %s", nickname, userID, entry.Workspace)
+		return
+	}
+
+	// Schedules never override a freeze; the run is skipped and the next one stands
+	if err := wb.serverManager.CheckUpdateAllowedIn(entry.Workspace, nickname, time.Now()); err != nil {
+		log.Printf("🧊 Scheduled update of %s for user %d skipped: %v", nickname, userID, err)
+		wb.sendMessage(chatID, "⏰ *Scheduled update skipped*\n\n"+frozenMessage(nickname, err))
+		return
+	}
+
+	client, err := wb.serverManager.GetAPIClientIn(entry.Workspace, nickname)
+	if err != nil {
+		log.Printf("❌ Scheduled update of %s for user %d: %v", nickname, userID, err)
+		wb.sendMessage(chatID, fmt.Sprintf("⏰ ❌ Scheduled update of `%s` could not start: `%v`", nickname, err))
+		return
+	}
+
+	spec := jobs.Spec{UserID: userID, ChatID: chatID, Server: nickname, Workspace: entry.Workspace, Source: servers.SourceSchedule}
+	wb.startUpdateJob(spec, client, func(j jobs.Job) {
+		wb.sendMessage(chatID, "⏰ *Scheduled update*\n\n"+formatJobResult(j))
+	})
+}
@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+func TestScheduledUpdateSkipsFormerMembers(t *testing.T) {
+	called := make(chan string, 1)
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case called <- r.URL.Path:
+		default:
+		}
+	}))
+	defer watchtower.Close()
+
+	const former = 7
+	wb, telegram := newTestBot(t, time.Minute)
+	if err := wb.access.Grant(testOwner, former, access.RoleOperator); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	mgr := wb.serverManager
+	if _, err := mgr.CreateWorkspace(testOwner, "ops"); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	if err := mgr.AddServer(testOwner, "home", watchtower.URL, "token"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+
+	// A schedule left over from somebody who is no longer in the workspace
+	wb.RunScheduledUpdate(servers.ScheduledServer{Workspace: "ops", UserID: former, Nickname: "home"})
+
+	// The update runs as a background job, so give it a moment to show up
+	select {
+	case path := <-called:
+		t.Errorf("a former member's schedule called %s", path)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if sent := telegram.messages(); len(sent) != 0 {
+		t.Errorf("a former member must not get reports, sent %q", sent)
+	}
+}
@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// Buttons per row in the /servers keyboard
+const serversPerRow = 2
+
+// serverListKeyboard renders the user's servers as inline buttons
+func (wb *WatchtowerBot) serverListKeyboard(userID int64) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	serverList, err := wb.serverManager.ListServers(userID)
+	if err != nil || len(serverList) == 0 {
+		return "", nil, fmt.Errorf("no servers configured")
+	}
+
+	currentServerName := ""
+	if current, err := wb.serverManager.GetCurrentServer(userID); err == nil {
+		currentServerName = current.Nickname
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	var tooLong []string
+	for _, server := range serverList {
+		if !callbackFits("sv", server) {
+			tooLong = append(tooLong, server)
+			continue
+		}
+		label := server
+		if server == currentServerName {
+			label = "📍 " + server
+		}
+		row = append(row, wb.button(userID, label, "sv", server))
+		if len(row) == serversPerRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	text := "📋 *Your Watchtower Servers*\n\n" +
+		"Tap a server to make it active and see its actions.\n" +
+		"📍 marks the active server."
+	if len(tooLong) > 0 {
+		text += "\n\n" + renameForButtons(tooLong...)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text, &markup, nil
+}
+
+// serverCard renders a single server with its action buttons
+func (wb *WatchtowerBot) serverCard(userID int64, nickname, status string) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	server, err := wb.serverManager.GetServer(userID, nickname)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📍 *Now managing:* `%s`\n", server.Nickname))
+	text.WriteString(fmt.Sprintf("🌐 *URL:* `%s`\n", server.WatchtowerURL))
+	if status != "" {
+		text.WriteString("\n" + status)
+	}
+
+	back := tgbotapi.NewInlineKeyboardRow(wb.button(userID, "⬅️ All servers", "ls", ""))
+	if !callbackFits("up", nickname) {
+		text.WriteString("\n\n" + renameForButtons(nickname))
+		return text.String(), tgbotapi.NewInlineKeyboardMarkup(back), nil
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			wb.button(userID, "🚀 Update now", "up", nickname),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			wb.button(userID, "📊 Status", "st", nickname),
+			wb.button(userID, "📜 History", "hi", nickname),
+		),
+		back,
+	)
+	return text.String(), markup, nil
+}
+
+// renameForButtons asks for shorter nicknames for servers whose names don't
+// fit in a button, typically ones added before nicknames were limited
+func renameForButtons(nicknames ...string) string {
+	return fmt.Sprintf("⚠️ *Too long for buttons:* `%s`\n"+
+		"Use `/rename_server <old_name> <new_name>` to shorten it.", strings.Join(nicknames, "`, `"))
+}
+
+// showServerCard edits the callback's message into the server card
+func (wb *WatchtowerBot) showServerCard(cq *tgbotapi.CallbackQuery, nickname, status string) {
+	chatID, messageID := cq.Message.Chat.ID, cq.Message.MessageID
+
+	text, markup, err := wb.serverCard(cq.From.ID, nickname, status)
+	if err != nil {
+		wb.editMessage(chatID, messageID, fmt.Sprintf("❌ `%v`", err))
+		return
+	}
+	wb.editMessageWithKeyboard(chatID, messageID, text, markup)
+}
+
+func (wb *WatchtowerBot) cbListServers(cq *tgbotapi.CallbackQuery, _ string) {
+	chatID, messageID := cq.Message.Chat.ID, cq.Message.MessageID
+
+	text, markup, err := wb.serverListKeyboard(cq.From.ID)
+	if err != nil {
+		wb.editMessage(chatID, messageID, "❌ No servers configured. Use /add_server to add your first server.")
+		return
+	}
+	wb.editMessageWithKeyboard(chatID, messageID, text, *markup)
+}
+
+func (wb *WatchtowerBot) cbSelectServer(cq *tgbotapi.CallbackQuery, nickname string) {
+	if err := wb.serverManager.SwitchServer(cq.From.ID, nickname); err != nil {
+		wb.editMessage(cq.Message.Chat.ID, cq.Message.MessageID,
+			fmt.Sprintf("❌ Server `%s` not found.\n\nUse **/servers** to see your available servers.", nickname))
+		return
+	}
+	wb.showServerCard(cq, nickname, "")
+}
+
+func (wb *WatchtowerBot) cbUpdateServer(cq *tgbotapi.CallbackQuery, nickname string) {
+	if err := wb.checkFreeze(cq.From.ID, nickname, false); err != nil {
+		wb.showServerCard(cq, nickname, frozenMessage(nickname, err))
+		return
+	}
+
+	client, err := wb.serverManager.GetAPIClientFor(cq.From.ID, nickname)
+	if err != nil {
+		wb.showServerCard(cq, nickname, fmt.Sprintf("❌ Failed to create API client: `%v`", err))
+		return
+	}
+
+	spec := jobs.Spec{
+		UserID:      cq.From.ID,
+		ChatID:      cq.Message.Chat.ID,
+		Server:      nickname,
+		Workspace:   wb.serverManager.WorkspaceID(cq.From.ID),
+		Source:      servers.SourceButton,
+		TriggeredBy: cq.From.ID,
+	}
+	job := wb.startUpdateJob(spec, client, func(j jobs.Job) {
+		wb.showServerCard(cq, nickname, formatJobResult(j))
+	})
+	wb.showServerCard(cq, nickname, fmt.Sprintf(
+		"🚀 *Triggering container update...*\n⏱️ This may take 2-5 minutes.\n🆔 Job: `%s`", job.ID))
+}
+
+func (wb *WatchtowerBot) cbServerStatus(cq *tgbotapi.CallbackQuery, nickname string) {
+	client, err := wb.serverManager.GetAPIClientFor(cq.From.ID, nickname)
+	if err != nil {
+		wb.showServerCard(cq, nickname, fmt.Sprintf("❌ Failed to create API client: `%v`", err))
+		return
+	}
+
+	ctx, done := wb.requestContext(cq.Message.Chat.ID)
+	defer done()
+
+	// Only read endpoints here: Watchtower runs a scan for any request to
+	// /v1/update, and this button just needs view access
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		wb.showServerCard(cq, nickname, fmt.Sprintf("🔴 *Status:* unreachable\n`%v`", err))
+		return
+	}
+
+	wb.showServerCard(cq, nickname, fmt.Sprintf(
+		"🟢 *Status:* %s\n🏷 *Version:* `%s`\n🕒 *Checked:* %s",
+		status.Status, status.Version, time.Now().Format("15:04:05")))
+}
+
+func (wb *WatchtowerBot) cbServerHistory(cq *tgbotapi.CallbackQuery, nickname string) {
+	entries, err := wb.serverManager.History(cq.From.ID, nickname, 5)
+	if err != nil {
+		wb.showServerCard(cq, nickname, fmt.Sprintf("📜 *History unavailable*\n`%v`", err))
+		return
+	}
+	if len(entries) == 0 {
+		wb.showServerCard(cq, nickname, "📜 *History:* no updates recorded yet")
+		return
+	}
+
+	var history strings.Builder
+	history.WriteString("📜 *Recent updates:*\n")
+	for _, e := range entries {
+		history.WriteString("\n" + formatHistoryEntry(e) + "\n")
+	}
+	history.WriteString(fmt.Sprintf("\nMore with `/history %s 20`", nickname))
+	wb.showServerCard(cq, nickname, history.String())
+}
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+)
+
+const usersUsage = "👥 *Access list*\n\n" +
+	"`/users` - List users and their roles\n" +
+	"`/users add <telegram id> [owner|operator|viewer]` - Grant access (viewer by default)\n" +
+	"`/users role <telegram id> <role>` - Change a role\n" +
+	"`/users remove <telegram id>` - Revoke access\n\n" +
+	"*Roles:* owners manage users; operators manage servers and run updates; viewers only look."
+
+// commandActions is the access each command needs. Commands whose
+// subcommands differ are resolved in messageAction.
+var commandActions = map[string]access.Action{
+	"add_server":    access.ActionManage,
+	"remove_server": access.ActionManage,
+	"rename_server": access.ActionManage,
+	"edit_server":   access.ActionManage,
+	"wt_update":     access.ActionUpdate,
+	"wt_update_all": access.ActionUpdate,
+	"users":         access.ActionAdmin,
+}
+
+// messageAction is the access a message needs; anything not listed is read-only
+func messageAction(msg *tgbotapi.Message) access.Action {
+	if msg.Text == menuAddServer {
+		return access.ActionManage
+	}
+
+	cmd := msg.Command()
+	if action, ok := commandActions[cmd]; ok {
+		return action
+	}
+
+	sub := ""
+	if args := strings.Fields(msg.CommandArguments()); len(args) > 0 {
+		sub = args[0]
+	}
+	switch {
+	case cmd == "schedule" && (sub == "set" || sub == "clear"),
+		cmd == "freeze" && (sub == "add" || sub == "remove"),
+		cmd == "hook" && sub != "",
+		cmd == "workspace" && (sub == "new" || sub == "add" || sub == "remove"):
+		return access.ActionManage
+	}
+	return access.ActionView
+}
+
+// allowed checks userID's access and tells them in chatID if it is denied
+func (wb *WatchtowerBot) allowed(chatID, userID int64, action access.Action) bool {
+	err := wb.access.Check(userID, action)
+	if err == nil {
+		return true
+	}
+
+	log.Printf("⛔ Denied %s to user %d: %v", action, userID, err)
+	wb.sendMessage(chatID, fmt.Sprintf("⛔ *Not allowed:* %v.\n\nAsk an owner for a different role.", err))
+	return false
+}
+
+func (wb *WatchtowerBot) handleUsers(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || args[0] == "list" {
+		wb.usersList(message)
+		return
+	}
+
+	if len(args) < 2 {
+		wb.sendMessage(message.Chat.ID, usersUsage)
+		return
+	}
+	userID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || userID <= 0 {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ `%s` is not a Telegram user ID.\n\n%s", args[1], usersUsage))
+		return
+	}
+
+	switch {
+	case args[0] == "add" && len(args) <= 3:
+		role := access.RoleViewer
+		if len(args) == 3 {
+			if role, err = access.ParseRole(args[2]); err != nil {
+				wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ `%v`", err))
+				return
+			}
+		}
+		if _, exists := wb.access.Role(userID); exists && !wb.access.Open() {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ `%d` already has access. Use `/users role` to change it.", userID))
+			return
+		}
+		wb.usersGrant(message, userID, role, "added as")
+	case args[0] == "role" && len(args) == 3:
+		role, err := access.ParseRole(args[2])
+		if err != nil {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ `%v`", err))
+			return
+		}
+		if _, exists := wb.access.Role(userID); !exists || wb.access.Open() {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ `%d` has no access yet. Use `/users add` first.", userID))
+			return
+		}
+		wb.usersGrant(message, userID, role, "is now")
+	case args[0] == "remove" && len(args) == 2:
+		if err := wb.access.Revoke(message.From.ID, userID); err != nil {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error removing user: `%v`", err))
+			return
+		}
+		log.Printf("👥 User %d revoked access of %d", message.From.ID, userID)
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("🗑 `%d` no longer has access.", userID))
+	default:
+		wb.sendMessage(message.Chat.ID, usersUsage)
+	}
+}
+
+func (wb *WatchtowerBot) usersGrant(message *tgbotapi.Message, userID int64, role access.Role, verb string) {
+	if err := wb.access.Grant(message.From.ID, userID, role); err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error updating access: `%v`", err))
+		return
+	}
+	log.Printf("👥 User %d set role of %d to %s", message.From.ID, userID, role)
+	wb.sendMessage(message.Chat.ID, fmt.Sprintf("✅ `%d` %s *%s*.", userID, verb, role))
+}
+
+func (wb *WatchtowerBot) usersList(message *tgbotapi.Message) {
+	var response strings.Builder
+	response.WriteString("👥 *Access list*\n\n")
+	if wb.access.Open() {
+		response.WriteString("⚠️ Access is open to everybody. Set `ADMIN_USER_ID` or add a user to restrict it.\n")
+	}
+	for _, e := range wb.access.Members() {
+		line := fmt.Sprintf("%s `%d` - %s", roleIcon(access.Role(e.Role)), e.UserID, e.Role)
+		if e.Bootstrap {
+			line += " (`ADMIN_USER_ID`)"
+		}
+		if e.UserID == message.From.ID {
+			line += " - you"
+		}
+		response.WriteString(line + "\n")
+	}
+	response.WriteString("\n" + usersUsage)
+	wb.sendMessage(message.Chat.ID, response.String())
+}
+
+func roleIcon(role access.Role) string {
+	switch role {
+	case access.RoleOwner:
+		return "👑"
+	case access.RoleOperator:
+		return "🛠"
+	}
+	return "👁"
+}
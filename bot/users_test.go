@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+)
+
+func commandMessage(text string) *tgbotapi.Message {
+	msg := &tgbotapi.Message{Text: text}
+	if text != "" && text[0] == '/' {
+		end := len(text)
+		for i, r := range text {
+			if r == ' ' {
+				end = i
+				break
+			}
+		}
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: end}}
+	}
+	return msg
+}
+
+func TestMessageAction(t *testing.T) {
+	cases := map[string]access.Action{
+		"/servers":                      access.ActionView,
+		"/history home 5":               access.ActionView,
+		"/schedule":                     access.ActionView,
+		"/schedule show home":           access.ActionView,
+		"/schedule set home @daily":     access.ActionManage,
+		"/freeze list":                  access.ActionView,
+		"/freeze add all for 2h":        access.ActionManage,
+		"/hook":                         access.ActionView,
+		"/hook enable home":             access.ActionManage,
+		"/wt_update":                    access.ActionUpdate,
+		"/wt_update_all --force":        access.ActionUpdate,
+		"/edit_server home url https:x": access.ActionManage,
+		"/users":                        access.ActionAdmin,
+		"/workspace":                    access.ActionView,
+		"/workspace use ops":            access.ActionView,
+		"/workspace add 42":             access.ActionManage,
+		menuAddServer:                   access.ActionManage,
+		menuListServers:                 access.ActionView,
+		"some wizard reply":             access.ActionView,
+	}
+	for text, want := range cases {
+		if got := messageAction(commandMessage(text)); got != want {
+			t.Errorf("messageAction(%q) = %s, want %s", text, got, want)
+		}
+	}
+}
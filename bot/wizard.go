@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// startAddServerWizard asks for nickname, URL and token one message at a time
+func (wb *WatchtowerBot) startAddServerWizard(message *tgbotapi.Message) {
+	wb.sendMessage(message.Chat.ID,
+		"📥 *Add a Watchtower Server* (1/3)\n\n"+
+			"Send a *nickname* for the server - an easy-to-remember name like `home`, `vps` or `work`.\n\n"+
+			"Send /cancel at any time to stop.")
+	wb.startConversation(message.Chat.ID, message.From.ID, "add_server", access.ActionManage, addServerNickname)
+}
+
+func addServerNickname(wb *WatchtowerBot, msg *tgbotapi.Message, conv *Conversation) Step {
+	nickname := strings.TrimSpace(msg.Text)
+	if err := servers.ValidateNickname(nickname); err != nil {
+		wb.sendMessage(msg.Chat.ID, fmt.Sprintf("❌ `%v`\n\nPlease send another nickname.", err))
+		return addServerNickname
+	}
+
+	existing, _ := wb.serverManager.ListServers(msg.From.ID)
+	if contains(existing, nickname) {
+		wb.sendMessage(msg.Chat.ID, fmt.Sprintf("❌ You already have a server called `%s`.\n\nPlease send another nickname.", nickname))
+		return addServerNickname
+	}
+
+	conv.Data["nickname"] = nickname
+	wb.sendMessage(msg.Chat.ID,
+		fmt.Sprintf("🌐 *Add a Watchtower Server* (2/3)\n\n"+
+			"Send the *Watchtower URL* for `%s`.\n\n"+
+			"*Example:* `https://watchtower.yourserver.com`", nickname))
+	return addServerURL
+}
+
+func addServerURL(wb *WatchtowerBot, msg *tgbotapi.Message, conv *Conversation) Step {
+	watchtowerURL := strings.TrimSpace(msg.Text)
+	if watchtowerURL == "" || strings.ContainsAny(watchtowerURL, " \n") {
+		wb.sendMessage(msg.Chat.ID, "❌ That doesn't look like a URL.\n\nPlease send the Watchtower URL.")
+		return addServerURL
+	}
+	watchtowerURL = withScheme(watchtowerURL, "https")
+	if err := servers.ValidateURL(watchtowerURL); err != nil {
+		wb.sendMessage(msg.Chat.ID, fmt.Sprintf("❌ `%s`: %v\n\nPlease send the Watchtower URL.", watchtowerURL, err))
+		return addServerURL
+	}
+
+	conv.Data["url"] = watchtowerURL
+	wb.sendMessage(msg.Chat.ID,
+		"🔑 *Add a Watchtower Server* (3/3)\n\n"+
+			"Send the *Watchtower token* (`WATCHTOWER_HTTP_API_TOKEN`).\n\n"+
+			"🔒 I'll delete your message as soon as I've read it.")
+	return addServerToken
+}
+
+func addServerToken(wb *WatchtowerBot, msg *tgbotapi.Message, conv *Conversation) Step {
+	token := strings.TrimSpace(msg.Text)
+
+	// Don't leave the token sitting in the chat history
+	wb.deleteMessage(msg.Chat.ID, msg.MessageID)
+
+	if token == "" {
+		wb.sendMessage(msg.Chat.ID, "❌ The token can't be empty.\n\nPlease send the Watchtower token.")
+		return addServerToken
+	}
+
+	nickname, watchtowerURL := conv.Data["nickname"], conv.Data["url"]
+	wb.sendMessage(msg.Chat.ID, fmt.Sprintf("📡 Testing connection to `%s`...", watchtowerURL))
+
+	ctx, done := wb.requestContext(msg.Chat.ID)
+	defer done()
+
+	client := api.NewWatchtowerClient(watchtowerURL, token)
+	if err := client.TestConnection(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		log.Printf("❌ Connection test for %s failed: %v", watchtowerURL, err)
+		wb.sendMessage(msg.Chat.ID,
+			fmt.Sprintf("❌ *Connection test failed*\n\n`%v`\n\n"+
+				"Send the token again to retry, or /cancel and start over to change the URL.", err))
+		return addServerToken
+	}
+
+	if err := wb.serverManager.AddServer(msg.From.ID, nickname, watchtowerURL, token); err != nil {
+		wb.sendMessage(msg.Chat.ID, fmt.Sprintf("❌ Error adding server: `%v`", err))
+		return nil
+	}
+
+	wb.sendMessage(msg.Chat.ID,
+		fmt.Sprintf("✅ *Server %s added successfully!*\n\n"+
+			"🌐 *URL:* `%s`\n"+
+			"🔑 *Token:* `••••••••`\n"+
+			"📡 *Connection:* OK\n\n"+
+			"Use `/server %s` to switch to this server or `/servers` to see all servers",
+			nickname, watchtowerURL, nickname))
+	return nil
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+const workspaceUsage = "🏢 *Workspaces*\n\n" +
+	"`/workspace` - List your workspaces\n" +
+	"`/workspace new <name>` - Create a team workspace and switch to it\n" +
+	"`/workspace use <name|personal>` - Switch workspace\n" +
+	"`/workspace add <telegram id>` - Share the current workspace\n" +
+	"`/workspace remove <telegram id>` - Remove a member\n\n" +
+	"Servers, schedules, freezes and history belong to a workspace; every member sees the same servers."
+
+func (wb *WatchtowerBot) handleWorkspace(message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || args[0] == "list" {
+		wb.workspaceList(message)
+		return
+	}
+	if len(args) != 2 {
+		wb.sendMessage(message.Chat.ID, workspaceUsage)
+		return
+	}
+
+	userID := message.From.ID
+	switch args[0] {
+	case "new":
+		ws, err := wb.serverManager.CreateWorkspace(userID, args[1])
+		if err != nil {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error creating workspace: `%v`", err))
+			return
+		}
+		log.Printf("🏢 User %d created workspace %s", userID, ws.ID)
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("✅ Workspace `%s` created and selected.\n\n"+
+			"Add servers with `/add_server` and teammates with `/workspace add <telegram id>`.", ws.Name))
+	case "use":
+		if err := wb.serverManager.SwitchWorkspace(userID, args[1]); err != nil {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error switching workspace: `%v`", err))
+			return
+		}
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("🔄 Now working in `%s`.", args[1]))
+	case "add", "remove":
+		memberID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || memberID <= 0 {
+			wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ `%s` is not a Telegram user ID.\n\n%s", args[1], workspaceUsage))
+			return
+		}
+		if args[0] == "add" {
+			wb.workspaceAdd(message, memberID)
+		} else {
+			wb.workspaceRemove(message, memberID)
+		}
+	default:
+		wb.sendMessage(message.Chat.ID, workspaceUsage)
+	}
+}
+
+func (wb *WatchtowerBot) workspaceAdd(message *tgbotapi.Message, memberID int64) {
+	// Membership only shares servers; using the bot still needs a role
+	if _, exists := wb.access.Role(memberID); !exists && !wb.access.Open() {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ `%d` has no access to the bot. Ask an owner to `/users add` them first.", memberID))
+		return
+	}
+	if err := wb.serverManager.AddWorkspaceMember(message.From.ID, memberID); err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error adding member: `%v`", err))
+		return
+	}
+
+	name := wb.serverManager.WorkspaceID(message.From.ID)
+	log.Printf("🏢 User %d added %d to workspace %s", message.From.ID, memberID, name)
+	wb.sendMessage(message.Chat.ID, fmt.Sprintf("✅ `%d` is now a member of `%s`.", memberID, name))
+	wb.sendMessage(memberID, fmt.Sprintf("🏢 You were added to workspace `%s`.\n\nUse `/workspace use %s` to switch to it.", name, name))
+}
+
+func (wb *WatchtowerBot) workspaceRemove(message *tgbotapi.Message, memberID int64) {
+	name := wb.serverManager.WorkspaceID(message.From.ID)
+	if err := wb.serverManager.RemoveWorkspaceMember(message.From.ID, memberID); err != nil {
+		wb.sendMessage(message.Chat.ID, fmt.Sprintf("❌ Error removing member: `%v`", err))
+		return
+	}
+	log.Printf("🏢 User %d removed %d from workspace %s", message.From.ID, memberID, name)
+	wb.sendMessage(message.Chat.ID, fmt.Sprintf("🗑 `%d` is no longer a member of `%s`.", memberID, name))
+}
+
+func (wb *WatchtowerBot) workspaceList(message *tgbotapi.Message) {
+	current := wb.serverManager.WorkspaceID(message.From.ID)
+	list := wb.serverManager.Workspaces(message.From.ID)
+	if len(list) == 0 {
+		wb.sendMessage(message.Chat.ID, "📭 No workspaces yet.\n\n"+
+			"Your personal workspace is created with your first server. Use `/workspace new <name>` for a team.")
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString("🏢 *Your workspaces*\n\n")
+	for _, ws := range list {
+		marker := "▫️"
+		if ws.ID == current {
+			marker = "✅"
+		}
+		name := ws.Name
+		if ws.Personal() {
+			name = servers.PersonalWorkspaceName
+		}
+		response.WriteString(fmt.Sprintf("%s `%s` - %d server(s)", marker, name, len(ws.Servers)))
+		if !ws.Personal() {
+			response.WriteString(fmt.Sprintf(", %d member(s)", len(ws.Members)))
+		}
+		response.WriteString("\n")
+	}
+	response.WriteString("\nSwitch with `/workspace use <name>`.")
+	wb.sendMessage(message.Chat.ID, response.String())
+}
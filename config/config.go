@@ -4,26 +4,57 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	TelegramToken string
-	AdminID       int64
-	HealthPort    string
-	EncryptionKey string
-	WebAppURL     string
+	TelegramToken  string
+	AdminID        int64
+	HealthPort     string
+	EncryptionKey  string
+	RetiredKeys    []string
+	Environment    string
+	WebAppURL      string
+	StorageBackend string
+	DataDir        string
+	// BotWorkers is how many chats the bot serves concurrently
+	BotWorkers int
+	// ShutdownTimeout bounds how long SIGTERM waits for in-flight work
+	ShutdownTimeout time.Duration
+	// HistoryRetention and HistoryMaxAge limit each user's update history (0 = no limit)
+	HistoryRetention int
+	HistoryMaxAge    time.Duration
+	// WebAppAuthMaxAge is how old Telegram WebApp initData may be
+	WebAppAuthMaxAge time.Duration
+	// WebAppSessionTTL is how long a terminal session lasts between refreshes
+	WebAppSessionTTL time.Duration
 }
 
 func Load() *Config {
 	return &Config{
-		TelegramToken: getEnv("TELEGRAM_BOT_TOKEN", ""),
-		AdminID:       getEnvAsInt("ADMIN_USER_ID", 0),
-		HealthPort:    getEnv("HEALTH_PORT", "8080"),
-		EncryptionKey: getEnv("ENCRYPTION_KEY", ""),
-		WebAppURL:     getEnv("WEBAPP_URL", ""),
+		TelegramToken:    getEnv("TELEGRAM_BOT_TOKEN", ""),
+		AdminID:          getEnvAsInt("ADMIN_USER_ID", 0),
+		HealthPort:       getEnv("HEALTH_PORT", "8080"),
+		EncryptionKey:    getEnv("ENCRYPTION_KEY", ""),
+		RetiredKeys:      getEnvAsList("ENCRYPTION_KEYS_RETIRED"),
+		Environment:      getEnv("APP_ENV", "development"),
+		WebAppURL:        getEnv("WEBAPP_URL", ""),
+		StorageBackend:   getEnv("STORAGE_BACKEND", "json"),
+		DataDir:          getEnv("DATA_DIR", "/app/data"),
+		BotWorkers:       int(getEnvAsInt("BOT_WORKERS", 4)),
+		ShutdownTimeout:  getEnvAsDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		HistoryRetention: int(getEnvAsInt("HISTORY_RETENTION", 500)),
+		HistoryMaxAge:    getEnvAsDuration("HISTORY_MAX_AGE", 0),
+		WebAppAuthMaxAge: getEnvAsDuration("WEBAPP_AUTH_MAX_AGE", time.Hour),
+		WebAppSessionTTL: getEnvAsDuration("WEBAPP_SESSION_TTL", 15*time.Minute),
 	}
 }
 
+// IsProduction reports whether APP_ENV=production
+func (c *Config) IsProduction() bool {
+	return strings.EqualFold(c.Environment, "production")
+}
+
 func getEnv(key, defaultVal string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return strings.TrimSpace(value)
@@ -42,3 +73,21 @@ func getEnvAsInt(key string, defaultVal int64) int64 {
 	}
 	return val
 }
+
+func getEnvAsDuration(key string, defaultVal time.Duration) time.Duration {
+	val, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil || val <= 0 {
+		return defaultVal
+	}
+	return val
+}
+
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
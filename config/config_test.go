@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -40,3 +41,72 @@ func TestLoadConfigMissingToken(t *testing.T) {
 		os.Setenv("TELEGRAM_BOT_TOKEN", originalToken)
 	}
 }
+
+func TestLoadConfigDataDir(t *testing.T) {
+	os.Unsetenv("DATA_DIR")
+	if cfg := Load(); cfg.DataDir != "/app/data" {
+		t.Errorf("Expected default DataDir '/app/data', got '%s'", cfg.DataDir)
+	}
+
+	os.Setenv("DATA_DIR", "/tmp/wt-data")
+	defer os.Unsetenv("DATA_DIR")
+	if cfg := Load(); cfg.DataDir != "/tmp/wt-data" {
+		t.Errorf("Expected DataDir '/tmp/wt-data', got '%s'", cfg.DataDir)
+	}
+}
+
+func TestLoadConfigRetiredKeys(t *testing.T) {
+	os.Setenv("ENCRYPTION_KEYS_RETIRED", " old-key-1, ,old-key-2 ")
+	defer os.Unsetenv("ENCRYPTION_KEYS_RETIRED")
+
+	cfg := Load()
+	if len(cfg.RetiredKeys) != 2 || cfg.RetiredKeys[0] != "old-key-1" || cfg.RetiredKeys[1] != "old-key-2" {
+		t.Errorf("Expected [old-key-1 old-key-2], got %q", cfg.RetiredKeys)
+	}
+}
+
+func TestConfigIsProduction(t *testing.T) {
+	os.Setenv("APP_ENV", "Production")
+	defer os.Unsetenv("APP_ENV")
+
+	if !Load().IsProduction() {
+		t.Error("Expected APP_ENV=Production to enable production mode")
+	}
+
+	os.Unsetenv("APP_ENV")
+	if Load().IsProduction() {
+		t.Error("Expected development mode by default")
+	}
+}
+
+func TestLoadConfigConcurrency(t *testing.T) {
+	os.Unsetenv("BOT_WORKERS")
+	os.Unsetenv("SHUTDOWN_TIMEOUT")
+	if cfg := Load(); cfg.BotWorkers != 4 || cfg.ShutdownTimeout != 10*time.Second {
+		t.Errorf("Expected defaults 4 workers / 10s, got %d / %s", cfg.BotWorkers, cfg.ShutdownTimeout)
+	}
+
+	os.Setenv("BOT_WORKERS", "8")
+	os.Setenv("SHUTDOWN_TIMEOUT", "30s")
+	defer os.Unsetenv("BOT_WORKERS")
+	defer os.Unsetenv("SHUTDOWN_TIMEOUT")
+	if cfg := Load(); cfg.BotWorkers != 8 || cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("Expected 8 workers / 30s, got %d / %s", cfg.BotWorkers, cfg.ShutdownTimeout)
+	}
+}
+
+func TestLoadConfigHistory(t *testing.T) {
+	os.Unsetenv("HISTORY_RETENTION")
+	os.Unsetenv("HISTORY_MAX_AGE")
+	if cfg := Load(); cfg.HistoryRetention != 500 || cfg.HistoryMaxAge != 0 {
+		t.Errorf("Expected defaults 500 entries / no age limit, got %d / %s", cfg.HistoryRetention, cfg.HistoryMaxAge)
+	}
+
+	os.Setenv("HISTORY_RETENTION", "50")
+	os.Setenv("HISTORY_MAX_AGE", "720h")
+	defer os.Unsetenv("HISTORY_RETENTION")
+	defer os.Unsetenv("HISTORY_MAX_AGE")
+	if cfg := Load(); cfg.HistoryRetention != 50 || cfg.HistoryMaxAge != 720*time.Hour {
+		t.Errorf("Expected 50 entries / 720h, got %d / %s", cfg.HistoryRetention, cfg.HistoryMaxAge)
+	}
+}
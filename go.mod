@@ -4,4 +4,10 @@ go 1.21
 
 require github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.2-0.20221020003552-4126fa611266
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/joho/godotenv v1.5.1
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/crypto v0.25.0
+)
+
+require golang.org/x/sys v0.22.0 // indirect
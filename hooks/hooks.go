@@ -0,0 +1,87 @@
+// Package hooks receives Watchtower notifications sent through shoutrrr's
+// generic webhook and hands them to the bot.
+package hooks
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+)
+
+// PathPrefix is where Watchtower posts its reports: PathPrefix + "<server-id>"
+const PathPrefix = "/hooks/watchtower/"
+
+// SecretHeader carries the webhook secret; the "secret" query parameter works too
+const SecretHeader = "X-Hook-Secret"
+
+// maxBodySize bounds a report; session reports with logs stay well below it
+const maxBodySize = 1 << 20
+
+// Verifier resolves a webhook ID and secret to the owning workspace and server
+type Verifier interface {
+	VerifyHook(id, secret string) (workspaceID string, nickname string, err error)
+}
+
+// NotifyFunc forwards a parsed report to the members of the server's workspace
+type NotifyFunc func(workspaceID string, nickname string, report *api.Report)
+
+// Receiver handles POST /hooks/watchtower/<server-id>
+type Receiver struct {
+	verifier Verifier
+	notify   NotifyFunc
+}
+
+func NewReceiver(verifier Verifier, notify NotifyFunc) *Receiver {
+	return &Receiver{verifier: verifier, notify: notify}
+}
+
+func (rc *Receiver) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(PathPrefix, rc.handleReport)
+}
+
+func (rc *Receiver) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	secret := r.Header.Get(SecretHeader)
+	if secret == "" {
+		secret = r.URL.Query().Get("secret")
+	}
+	workspaceID, nickname, err := rc.verifier.VerifyHook(id, secret)
+	if err != nil {
+		log.Printf("🚫 Rejected Watchtower webhook %s from %s: %v", id, r.RemoteAddr, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "report too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read report", http.StatusBadRequest)
+		return
+	}
+
+	report := api.ParseReport(body, r.Header.Get("Content-Type"))
+	log.Printf("📬 Watchtower report for %s (workspace %s): %d scanned, %d updated, %d failed",
+		nickname, workspaceID, report.Scanned, report.Updated, report.Failed)
+	rc.notify(workspaceID, nickname, report)
+
+	w.WriteHeader(http.StatusNoContent)
+}
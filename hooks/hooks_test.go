@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+)
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) VerifyHook(id, secret string) (string, string, error) {
+	if id == "abc123" && secret == "s3cret" {
+		return "ops", "home", nil
+	}
+	return "", "", errors.New("denied")
+}
+
+type notification struct {
+	workspaceID string
+	nickname    string
+	report      *api.Report
+}
+
+func newTestMux(got *[]notification) *http.ServeMux {
+	mux := http.NewServeMux()
+	NewReceiver(fakeVerifier{}, func(workspaceID string, nickname string, report *api.Report) {
+		*got = append(*got, notification{workspaceID, nickname, report})
+	}).RegisterHandlers(mux)
+	return mux
+}
+
+func TestReceiverForwardsReport(t *testing.T) {
+	var got []notification
+	mux := newTestMux(&got)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, PathPrefix+"abc123?secret=s3cret", strings.NewReader("2 Scanned, 1 Updated, 0 Failed\n")),
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, PathPrefix+"abc123", strings.NewReader("2 Scanned, 1 Updated, 0 Failed\n"))
+			r.Header.Set(SecretHeader, "s3cret")
+			return r
+		}(),
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(got))
+	}
+	if n := got[0]; n.workspaceID != "ops" || n.nickname != "home" || n.report.Updated != 1 {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+}
+
+func TestReceiverRejects(t *testing.T) {
+	var got []notification
+	mux := newTestMux(&got)
+
+	cases := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"wrong secret", http.MethodPost, PathPrefix + "abc123?secret=nope", http.StatusUnauthorized},
+		{"no secret", http.MethodPost, PathPrefix + "abc123", http.StatusUnauthorized},
+		{"unknown id", http.MethodPost, PathPrefix + "zzz?secret=s3cret", http.StatusUnauthorized},
+		{"get", http.MethodGet, PathPrefix + "abc123?secret=s3cret", http.StatusMethodNotAllowed},
+		{"no id", http.MethodPost, PathPrefix, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(c.method, c.target, strings.NewReader("x")))
+		if rr.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, rr.Code)
+		}
+	}
+	if len(got) != 0 {
+		t.Errorf("rejected requests must not notify, got %d", len(got))
+	}
+}
+
+func TestReceiverLimitsBody(t *testing.T) {
+	var got []notification
+	mux := newTestMux(&got)
+
+	body := strings.NewReader(strings.Repeat("x", maxBodySize+1))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, PathPrefix+"abc123?secret=s3cret", body))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rr.Code)
+	}
+}
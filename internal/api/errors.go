@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Sentinel errors returned (wrapped) by WatchtowerClient methods.
+// Use errors.Is to test for them.
+var (
+	// ErrUnauthorized means Watchtower rejected the API token
+	ErrUnauthorized = errors.New("authentication failed - check your token")
+	// ErrUnavailable means Watchtower could not be reached or is not serving requests
+	ErrUnavailable = errors.New("watchtower service unavailable")
+	// ErrTimeout means no answer arrived before the deadline; for updates the
+	// scan may still be running on the host
+	ErrTimeout = errors.New("watchtower did not respond in time")
+)
+
+// classifyTransportError maps errors from http.Client.Do to sentinels.
+// Cancellation by the caller is passed through untouched; timeouts keep the
+// original error in the chain, so context.DeadlineExceeded still matches.
+func classifyTransportError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+// classifyStatus maps HTTP error statuses to sentinels, or returns nil
+func classifyStatus(code int) error {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w (status %d)", ErrUnauthorized, code)
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return fmt.Errorf("%w (status %d)", ErrUnavailable, code)
+	case http.StatusGatewayTimeout:
+		return fmt.Errorf("%w (status %d)", ErrTimeout, code)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoInventory means neither a Docker agent nor per-container metrics are available
+var ErrNoInventory = errors.New("no container inventory available: configure a Docker agent URL for this server")
+
+// dockerContainer is the subset of GET /containers/json used for inventory
+type dockerContainer struct {
+	ID      string   `json:"Id"`
+	Names   []string `json:"Names"`
+	Image   string   `json:"Image"`
+	ImageID string   `json:"ImageID"`
+	State   string   `json:"State"`
+	Status  string   `json:"Status"`
+}
+
+// dockerImage is the subset of GET /images/json used to resolve digests
+type dockerImage struct {
+	ID          string   `json:"Id"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+// getAgentContainers lists running containers through the Docker Engine API
+func (c *WatchtowerClient) getAgentContainers(ctx context.Context) ([]ContainerStatus, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
+
+	var containers []dockerContainer
+	if err := c.getAgentJSON(ctx, "/containers/json", &containers); err != nil {
+		return nil, err
+	}
+
+	// Digests are optional: a proxy may block /images
+	digests := make(map[string]string)
+	var images []dockerImage
+	if err := c.getAgentJSON(ctx, "/images/json", &images); err == nil {
+		for _, img := range images {
+			if len(img.RepoDigests) > 0 {
+				_, digest, _ := strings.Cut(img.RepoDigests[0], "@")
+				digests[img.ID] = digest
+			}
+		}
+	}
+
+	checked := time.Now()
+	result := make([]ContainerStatus, 0, len(containers))
+	for _, ct := range containers {
+		name := ct.ID
+		if len(ct.Names) > 0 {
+			name = strings.TrimPrefix(ct.Names[0], "/")
+		}
+		digest := digests[ct.ImageID]
+		if digest == "" {
+			digest = ct.ImageID
+		}
+
+		result = append(result, ContainerStatus{
+			ID:          shortID(ct.ID),
+			Name:        name,
+			Image:       ct.Image,
+			Digest:      digest,
+			Status:      ct.State,
+			LastChecked: checked,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (c *WatchtowerClient) getAgentJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(c.AgentURL, "/")+endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("User-Agent", "WatchtowerMasterBot/1.0")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker agent request failed: %w", classifyTransportError(ctx, err))
+	}
+	defer resp.Body.Close()
+
+	if err := classifyStatus(resp.StatusCode); err != nil {
+		return fmt.Errorf("docker agent: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("docker agent returned status: %d", resp.StatusCode)
+	}
+
+	body, err := readBody(ctx, resp)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode docker agent response: %v", err)
+	}
+	return nil
+}
+
+// containersFromMetrics builds an inventory from series carrying a container
+// label (e.g. watchtower_container_info{container="web",image="nginx:1.25"})
+func containersFromMetrics(metrics *Metrics, checked time.Time) []ContainerStatus {
+	byName := make(map[string]*ContainerStatus)
+	for _, family := range metrics.Families {
+		for _, sample := range family.Samples {
+			labels := sample.Labels
+			name := labels["container"]
+			if name == "" {
+				name = labels["container_name"]
+			}
+			if name == "" {
+				continue
+			}
+
+			ct, ok := byName[name]
+			if !ok {
+				ct = &ContainerStatus{Name: name, Status: "monitored", LastChecked: checked}
+				byName[name] = ct
+			}
+			if v := labels["image"]; v != "" {
+				ct.Image = v
+			}
+			if v := labels["digest"]; v != "" {
+				ct.Digest = v
+			}
+			if v := labels["id"]; v != "" {
+				ct.ID = shortID(v)
+			}
+		}
+	}
+
+	result := make([]ContainerStatus, 0, len(byName))
+	for _, ct := range byName {
+		result = append(result, *ct)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
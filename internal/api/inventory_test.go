@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetContainersFromAgent(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			fmt.Fprint(w, `[
+				{"Id":"aaaaaaaaaaaaaaaa","Names":["/web"],"Image":"nginx:1.25","ImageID":"sha256:img1","State":"running"},
+				{"Id":"bbbbbbbbbbbbbbbb","Names":["/db"],"Image":"postgres:16","ImageID":"sha256:img2","State":"exited"}
+			]`)
+		case "/images/json":
+			fmt.Fprint(w, `[{"Id":"sha256:img1","RepoDigests":["nginx@sha256:deadbeef"]}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer agent.Close()
+
+	client := NewWatchtowerClient("http://unused.invalid", "token")
+	client.AgentURL = agent.URL
+
+	containers, err := client.GetContainers(context.Background())
+	if err != nil {
+		t.Fatalf("GetContainers: %v", err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("expected 2 containers, got %d", len(containers))
+	}
+
+	db, web := containers[0], containers[1]
+	if web.Name != "web" || web.Image != "nginx:1.25" || web.Digest != "sha256:deadbeef" || web.Status != "running" {
+		t.Errorf("unexpected web container: %+v", web)
+	}
+	if db.ID != "bbbbbbbbbbbb" || db.Digest != "sha256:img2" {
+		t.Errorf("expected image ID fallback for db digest, got %+v", db)
+	}
+}
+
+func TestGetContainersFromMetrics(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "# HELP watchtower_containers_scanned Number of containers scanned\n"+
+			"watchtower_containers_scanned 2\n"+
+			`watchtower_container_info{container="web",image="nginx:1.25"} 1`+"\n")
+	}))
+	defer watchtower.Close()
+
+	containers, err := NewWatchtowerClient(watchtower.URL, "token").GetContainers(context.Background())
+	if err != nil {
+		t.Fatalf("GetContainers: %v", err)
+	}
+	if len(containers) != 1 || containers[0].Name != "web" || containers[0].Image != "nginx:1.25" {
+		t.Errorf("unexpected inventory: %+v", containers)
+	}
+}
+
+func TestGetContainersWithoutInventory(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "watchtower_containers_scanned 2\n")
+	}))
+	defer watchtower.Close()
+
+	if _, err := NewWatchtowerClient(watchtower.URL, "token").GetContainers(context.Background()); err != ErrNoInventory {
+		t.Errorf("expected ErrNoInventory, got %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricType is the TYPE of a metric family in the text exposition format
+type MetricType string
+
+const (
+	MetricCounter   MetricType = "counter"
+	MetricGauge     MetricType = "gauge"
+	MetricHistogram MetricType = "histogram"
+	MetricSummary   MetricType = "summary"
+	MetricUntyped   MetricType = "untyped"
+)
+
+// Sample is a single series value.
+// Name is the full sample name, e.g. "http_duration_seconds_bucket" for a histogram bucket.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	// Timestamp is zero when the exposition didn't carry one
+	Timestamp time.Time
+}
+
+// MetricFamily groups the samples sharing a metric name with its metadata
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Samples []Sample
+}
+
+// Metrics is a parsed Prometheus text exposition
+type Metrics struct {
+	Families map[string]*MetricFamily
+}
+
+// Watchtower's own metric names
+const (
+	MetricContainersScanned = "watchtower_containers_scanned"
+	MetricContainersUpdated = "watchtower_containers_updated"
+	MetricContainersFailed  = "watchtower_containers_failed"
+	MetricScansTotal        = "watchtower_scans_total"
+	MetricScansSkipped      = "watchtower_scans_skipped"
+)
+
+// WatchtowerStats are the numbers Watchtower reports about its scans.
+// The container counts describe the most recent scan; the scan counts are
+// running totals since Watchtower started.
+type WatchtowerStats struct {
+	Scanned      int
+	Updated      int
+	Failed       int
+	ScansTotal   int
+	ScansSkipped int
+}
+
+// ParseMetrics reads the Prometheus text exposition format (version 0.0.4)
+func ParseMetrics(r io.Reader) (*Metrics, error) {
+	m := &Metrics{Families: make(map[string]*MetricFamily)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var err error
+		if strings.HasPrefix(line, "#") {
+			err = m.parseComment(line)
+		} else {
+			err = m.parseSample(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("metrics line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseComment handles "# HELP name text" and "# TYPE name type"; other comments are ignored
+func (m *Metrics) parseComment(line string) error {
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), " ", 3)
+	if len(fields) < 3 || (fields[0] != "HELP" && fields[0] != "TYPE") {
+		return nil
+	}
+
+	family := m.family(fields[1])
+	switch fields[0] {
+	case "HELP":
+		family.Help = unescapeHelp(fields[2])
+	case "TYPE":
+		switch t := MetricType(strings.TrimSpace(fields[2])); t {
+		case MetricCounter, MetricGauge, MetricHistogram, MetricSummary, MetricUntyped:
+			family.Type = t
+		default:
+			return fmt.Errorf("unknown metric type %q", t)
+		}
+	}
+	return nil
+}
+
+// parseSample handles `name{k="v",...} value [timestamp]`
+func (m *Metrics) parseSample(line string) error {
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return fmt.Errorf("malformed sample %q", line)
+	}
+	sample := Sample{Name: line[:nameEnd], Labels: make(map[string]string)}
+
+	rest := line[nameEnd:]
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		rest, err = parseLabels(rest[1:], sample.Labels)
+		if err != nil {
+			return err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return fmt.Errorf("malformed sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %s", fields[0], sample.Name)
+	}
+	sample.Value = value
+	if len(fields) == 2 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q for %s", fields[1], sample.Name)
+		}
+		sample.Timestamp = time.UnixMilli(ms)
+	}
+
+	family := m.family(m.familyName(sample.Name))
+	family.Samples = append(family.Samples, sample)
+	return nil
+}
+
+// parseLabels reads `k="v",...}` into labels and returns what follows the brace
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("malformed label set")
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if !strings.HasPrefix(s, `"`) {
+			return "", fmt.Errorf("label %s: value must be quoted", key)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return "", fmt.Errorf("label %s: unterminated value", key)
+		}
+		labels[key] = value.String()
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return "", fmt.Errorf("label %s: expected ',' or '}'", key)
+		}
+	}
+}
+
+func unescapeHelp(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(s)
+}
+
+// familyName maps histogram/summary sample names to their declared family
+func (m *Metrics) familyName(sample string) string {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base := strings.TrimSuffix(sample, suffix)
+		if base == sample {
+			continue
+		}
+		if f, ok := m.Families[base]; ok && (f.Type == MetricHistogram || f.Type == MetricSummary) {
+			return base
+		}
+	}
+	return sample
+}
+
+func (m *Metrics) family(name string) *MetricFamily {
+	f, ok := m.Families[name]
+	if !ok {
+		f = &MetricFamily{Name: name, Type: MetricUntyped}
+		m.Families[name] = f
+	}
+	return f
+}
+
+// Family returns the named family, or nil
+func (m *Metrics) Family(name string) *MetricFamily {
+	return m.Families[name]
+}
+
+// Names returns the family names in sorted order
+func (m *Metrics) Names() []string {
+	names := make([]string, 0, len(m.Families))
+	for name := range m.Families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Value sums the samples named exactly name across all label sets.
+// It reports false when there are none.
+func (m *Metrics) Value(name string) (float64, bool) {
+	f := m.Families[m.familyName(name)]
+	if f == nil {
+		return 0, false
+	}
+
+	var sum float64
+	found := false
+	for _, s := range f.Samples {
+		if s.Name == name {
+			sum += s.Value
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// WatchtowerStats extracts Watchtower's scan metrics; missing series read as zero
+func (m *Metrics) WatchtowerStats() WatchtowerStats {
+	count := func(name string) int {
+		v, _ := m.Value(name)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0
+		}
+		return int(v)
+	}
+	return WatchtowerStats{
+		Scanned:      count(MetricContainersScanned),
+		Updated:      count(MetricContainersUpdated),
+		Failed:       count(MetricContainersFailed),
+		ScansTotal:   count(MetricScansTotal),
+		ScansSkipped: count(MetricScansSkipped),
+	}
+}
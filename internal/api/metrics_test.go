@@ -0,0 +1,131 @@
+package api
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const watchtowerExposition = `# HELP watchtower_containers_scanned Number of containers scanned for changes by watchtower during the last scan
+# TYPE watchtower_containers_scanned gauge
+watchtower_containers_scanned 7
+# HELP watchtower_containers_updated Number of containers updated by watchtower during the last scan
+# TYPE watchtower_containers_updated gauge
+watchtower_containers_updated 2
+# TYPE watchtower_containers_failed gauge
+watchtower_containers_failed 1
+# HELP watchtower_scans_total Number of scans since the watchtower started
+# TYPE watchtower_scans_total counter
+watchtower_scans_total 42
+# TYPE watchtower_scans_skipped counter
+watchtower_scans_skipped 3
+# HELP http_request_duration_seconds Request latency
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1",path="/v1/update"} 5
+http_request_duration_seconds_bucket{le="+Inf",path="/v1/update"} 6
+http_request_duration_seconds_sum{path="/v1/update"} 1.5
+http_request_duration_seconds_count{path="/v1/update"} 6
+go_info{version="go1.21.5"} 1 1700000000000
+`
+
+func TestParseMetricsFamilies(t *testing.T) {
+	m, err := ParseMetrics(strings.NewReader(watchtowerExposition))
+	if err != nil {
+		t.Fatalf("ParseMetrics: %v", err)
+	}
+
+	scanned := m.Family(MetricContainersScanned)
+	if scanned == nil || scanned.Type != MetricGauge || !strings.HasPrefix(scanned.Help, "Number of containers") {
+		t.Fatalf("unexpected scanned family: %+v", scanned)
+	}
+	if f := m.Family(MetricScansTotal); f == nil || f.Type != MetricCounter {
+		t.Fatalf("expected counter for %s, got %+v", MetricScansTotal, f)
+	}
+
+	hist := m.Family("http_request_duration_seconds")
+	if hist == nil || hist.Type != MetricHistogram || len(hist.Samples) != 4 {
+		t.Fatalf("expected histogram with 4 samples, got %+v", hist)
+	}
+	if m.Family("http_request_duration_seconds_bucket") != nil {
+		t.Error("histogram buckets should not form their own family")
+	}
+	if hist.Samples[1].Value != 6 || hist.Samples[1].Labels["le"] != "+Inf" {
+		t.Errorf("unexpected +Inf bucket: %+v", hist.Samples[1])
+	}
+	if v, ok := m.Value("http_request_duration_seconds_count"); !ok || v != 6 {
+		t.Errorf("histogram count: got %v, %v", v, ok)
+	}
+
+	info := m.Family("go_info")
+	if info == nil || info.Type != MetricUntyped || len(info.Samples) != 1 {
+		t.Fatalf("unexpected go_info family: %+v", info)
+	}
+	if got := info.Samples[0]; got.Labels["version"] != "go1.21.5" || !got.Timestamp.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("unexpected go_info sample: %+v", got)
+	}
+}
+
+func TestParseMetricsKeepsLabelledSeriesApart(t *testing.T) {
+	m, err := ParseMetrics(strings.NewReader(
+		`requests_total{code="200",path="/a,b"} 3` + "\n" +
+			`requests_total{code="500",path="say \"hi\""} 1` + "\n"))
+	if err != nil {
+		t.Fatalf("ParseMetrics: %v", err)
+	}
+
+	samples := m.Family("requests_total").Samples
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 series, got %d", len(samples))
+	}
+	if samples[0].Labels["path"] != "/a,b" || samples[1].Labels["path"] != `say "hi"` {
+		t.Errorf("labels not unescaped: %+v", samples)
+	}
+	if v, _ := m.Value("requests_total"); v != 4 {
+		t.Errorf("expected summed value 4, got %v", v)
+	}
+}
+
+func TestParseMetricsSpecialValues(t *testing.T) {
+	m, err := ParseMetrics(strings.NewReader("a +Inf\nb NaN\n"))
+	if err != nil {
+		t.Fatalf("ParseMetrics: %v", err)
+	}
+	if v, _ := m.Value("a"); !math.IsInf(v, 1) {
+		t.Errorf("expected +Inf, got %v", v)
+	}
+	if v, _ := m.Value("b"); !math.IsNaN(v) {
+		t.Errorf("expected NaN, got %v", v)
+	}
+}
+
+func TestParseMetricsRejectsMalformedInput(t *testing.T) {
+	for _, input := range []string{
+		"metric_without_value\n",
+		"metric abc\n",
+		`metric{label=unquoted} 1` + "\n",
+		`metric{label="open} 1` + "\n",
+		"# TYPE metric sideways\n",
+	} {
+		if _, err := ParseMetrics(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestWatchtowerStats(t *testing.T) {
+	m, err := ParseMetrics(strings.NewReader(watchtowerExposition))
+	if err != nil {
+		t.Fatalf("ParseMetrics: %v", err)
+	}
+
+	want := WatchtowerStats{Scanned: 7, Updated: 2, Failed: 1, ScansTotal: 42, ScansSkipped: 3}
+	if got := m.WatchtowerStats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	empty, _ := ParseMetrics(strings.NewReader(""))
+	if got := empty.WatchtowerStats(); got != (WatchtowerStats{}) {
+		t.Errorf("expected zero stats for empty exposition, got %+v", got)
+	}
+}
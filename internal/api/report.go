@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Report is a Watchtower notification received through shoutrrr's generic
+// webhook. Session reports (WATCHTOWER_NOTIFICATION_REPORT=true) fill the
+// counts and containers; any other lines end up in Logs.
+type Report struct {
+	Title string
+	// HasSummary is set when the "N Scanned, N Updated, N Failed" line was found
+	HasSummary bool
+	Scanned    int
+	Updated    int
+	Failed     int
+	Containers []ReportContainer
+	Logs       []string
+}
+
+// ReportContainer is one "- name (image): ..." line of a session report
+type ReportContainer struct {
+	Name  string
+	Image string
+	// Status is updated, failed, skipped, fresh or stale
+	Status string
+	Detail string
+}
+
+var (
+	reportSummaryPattern   = regexp.MustCompile(`^(\d+) Scanned, (\d+) Updated, (\d+) Failed$`)
+	reportContainerPattern = regexp.MustCompile(`^- (\S+) \((.*)\): (.*)$`)
+)
+
+// ParseReport reads a webhook body, either plain text or shoutrrr's JSON
+// template ({"title": ..., "message": ...})
+func ParseReport(body []byte, contentType string) *Report {
+	report := &Report{}
+	text := string(body)
+
+	trimmed := bytes.TrimSpace(body)
+	if strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("{")) {
+		var payload struct {
+			Title   string `json:"title"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(trimmed, &payload); err == nil {
+			report.Title = payload.Title
+			text = payload.Message
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "Logs:" {
+			continue
+		}
+
+		if m := reportSummaryPattern.FindStringSubmatch(line); m != nil {
+			report.HasSummary = true
+			report.Scanned, _ = strconv.Atoi(m[1])
+			report.Updated, _ = strconv.Atoi(m[2])
+			report.Failed, _ = strconv.Atoi(m[3])
+			continue
+		}
+
+		if m := reportContainerPattern.FindStringSubmatch(line); m != nil {
+			report.Containers = append(report.Containers, parseReportContainer(m[1], m[2], m[3]))
+			continue
+		}
+
+		report.Logs = append(report.Logs, line)
+	}
+	return report
+}
+
+// parseReportContainer interprets the text after "name (image): ". Updated
+// containers read "abc updated to def"; the others start with their state,
+// e.g. "Fresh" or "Failed: <error>".
+func parseReportContainer(name, image, rest string) ReportContainer {
+	c := ReportContainer{Name: name, Image: image, Detail: rest}
+	if strings.Contains(rest, " updated to ") {
+		c.Status = "updated"
+		return c
+	}
+
+	state, detail, _ := strings.Cut(rest, ":")
+	c.Status = strings.ToLower(strings.TrimSpace(state))
+	c.Detail = strings.TrimSpace(detail)
+	return c
+}
@@ -0,0 +1,60 @@
+package api
+
+import "testing"
+
+const sampleReport = `3 Scanned, 1 Updated, 1 Failed
+- web (nginx:latest): 1a2b3c4d5e6f updated to 6f5e4d3c2b1a
+- db (postgres:16): Fresh
+- cache (redis:7): Failed: pull access denied
+
+Logs:
+2026-05-01T04:00:00Z [info] Session done
+`
+
+func TestParseReportText(t *testing.T) {
+	r := ParseReport([]byte(sampleReport), "text/plain")
+
+	if !r.HasSummary || r.Scanned != 3 || r.Updated != 1 || r.Failed != 1 {
+		t.Fatalf("unexpected summary: %+v", r)
+	}
+	if len(r.Containers) != 3 {
+		t.Fatalf("expected 3 containers, got %+v", r.Containers)
+	}
+
+	want := []ReportContainer{
+		{Name: "web", Image: "nginx:latest", Status: "updated", Detail: "1a2b3c4d5e6f updated to 6f5e4d3c2b1a"},
+		{Name: "db", Image: "postgres:16", Status: "fresh"},
+		{Name: "cache", Image: "redis:7", Status: "failed", Detail: "pull access denied"},
+	}
+	for i, c := range want {
+		if r.Containers[i] != c {
+			t.Errorf("container %d: got %+v, want %+v", i, r.Containers[i], c)
+		}
+	}
+	if len(r.Logs) != 1 || r.Logs[0] != "2026-05-01T04:00:00Z [info] Session done" {
+		t.Errorf("unexpected logs: %q", r.Logs)
+	}
+}
+
+func TestParseReportJSON(t *testing.T) {
+	body := `{"title":"Watchtower updates on host","message":"1 Scanned, 0 Updated, 0 Failed\n- db (postgres:16): Fresh\n"}`
+	r := ParseReport([]byte(body), "application/json")
+
+	if r.Title != "Watchtower updates on host" {
+		t.Errorf("unexpected title %q", r.Title)
+	}
+	if !r.HasSummary || r.Scanned != 1 || len(r.Containers) != 1 {
+		t.Errorf("unexpected report: %+v", r)
+	}
+}
+
+func TestParseReportPlainNotification(t *testing.T) {
+	r := ParseReport([]byte("Watchtower 1.7.1\nUsing notifications of type: generic\n"), "")
+
+	if r.HasSummary || len(r.Containers) != 0 {
+		t.Errorf("expected no report data, got %+v", r)
+	}
+	if len(r.Logs) != 2 {
+		t.Errorf("expected lines to be kept as logs, got %q", r.Logs)
+	}
+}
@@ -1,7 +1,7 @@
 package api
 
 import (
-	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -13,8 +13,11 @@ import (
 )
 
 type WatchtowerClient struct {
-	BaseURL    string
-	Token      string
+	BaseURL string
+	Token   string
+	// AgentURL is an optional Docker Engine API endpoint (e.g. a read-only
+	// docker-socket-proxy) on the same host, used for container inventory
+	AgentURL   string
 	HTTPClient *http.Client
 }
 
@@ -22,6 +25,7 @@ type ContainerStatus struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
 	Image       string    `json:"image"`
+	Digest      string    `json:"digest,omitempty"`
 	Status      string    `json:"status"`
 	LastChecked time.Time `json:"last_checked"`
 }
@@ -51,9 +55,12 @@ type UpdateJob struct {
 	} `json:"results"`
 }
 
-type MetricsResponse struct {
-	Data map[string]string
-}
+// Per-call deadlines applied when the caller's context has none
+const (
+	DefaultRequestTimeout = 60 * time.Second
+	// Watchtower answers /v1/update only once the scan is complete
+	DefaultUpdateTimeout = 5 * time.Minute
+)
 
 func NewWatchtowerClient(baseURL, token string) *WatchtowerClient {
 	transport := &http.Transport{
@@ -72,20 +79,31 @@ func NewWatchtowerClient(baseURL, token string) *WatchtowerClient {
 		},
 	}
 
+	// No client-wide timeout: every call is bounded by its context
 	return &WatchtowerClient{
 		BaseURL: baseURL,
 		Token:   token,
 		HTTPClient: &http.Client{
-			Timeout:   60 * time.Second,
 			Transport: transport,
 		},
 	}
 }
 
-func (c *WatchtowerClient) doRequest(method, endpoint string) (*http.Response, error) {
+// withDefaultTimeout bounds ctx by d unless the caller already set a deadline
+func withDefaultTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// doRequest sends an authenticated request to Watchtower.
+// Transport failures and well-known error statuses are mapped to ErrUnauthorized,
+// ErrUnavailable and ErrTimeout; other statuses are left to the caller.
+func (c *WatchtowerClient) doRequest(ctx context.Context, method, endpoint string) (*http.Response, error) {
 	url := fmt.Sprintf("%s%s", c.BaseURL, endpoint)
 
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -94,40 +112,59 @@ func (c *WatchtowerClient) doRequest(method, endpoint string) (*http.Response, e
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "WatchtowerMasterBot/1.0")
 
-	return c.HTTPClient.Do(req)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, classifyTransportError(ctx, err)
+	}
+	if err := classifyStatus(resp.StatusCode); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
 }
 
-func (c *WatchtowerClient) GetContainers() ([]ContainerStatus, error) {
-	return []ContainerStatus{}, nil
+// readBody reads a response body, reporting a deadline hit mid-read as ErrTimeout
+func readBody(ctx context.Context, resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, classifyTransportError(ctx, ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	return body, nil
 }
 
-func (c *WatchtowerClient) TriggerUpdateWithTimeout(timeout time.Duration) (*UpdateResponse, error) {
-	// Create a custom client with longer timeout just for updates
-	customClient := &http.Client{
-		Timeout:   timeout,
-		Transport: c.HTTPClient.Transport,
+// GetContainers returns the containers running on the host.
+// The Docker agent is preferred when configured since it knows every container;
+// otherwise per-container series in Watchtower's metrics are used.
+func (c *WatchtowerClient) GetContainers(ctx context.Context) ([]ContainerStatus, error) {
+	if c.AgentURL != "" {
+		return c.getAgentContainers(ctx)
 	}
 
-	url := fmt.Sprintf("%s%s", c.BaseURL, "/v1/update")
-	req, err := http.NewRequest("POST", url, nil)
+	metrics, err := c.GetMetrics(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
-	req.Header.Set("Content-Type", "application/json")
+	containers := containersFromMetrics(metrics, time.Now())
+	if len(containers) == 0 {
+		return nil, ErrNoInventory
+	}
+	return containers, nil
+}
 
-	resp, err := customClient.Do(req)
+// TriggerUpdate runs a Watchtower scan and waits for its result.
+// ErrTimeout means the deadline passed before Watchtower answered; the scan
+// itself may still be running on the host. Cancelling ctx aborts the wait.
+func (c *WatchtowerClient) TriggerUpdate(ctx context.Context) (*UpdateResponse, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultUpdateTimeout)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "POST", "/v1/update")
 	if err != nil {
-		// Check if it's a timeout - this might mean the update is processing
-		if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "deadline") {
-			return &UpdateResponse{
-				Updated: []string{},
-				Failed:  []string{},
-				Message: "Update triggered successfully (processing in background)",
-			}, nil
-		}
-		return nil, fmt.Errorf("API request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -135,14 +172,9 @@ func (c *WatchtowerClient) TriggerUpdateWithTimeout(timeout time.Duration) (*Upd
 	switch resp.StatusCode {
 	case http.StatusOK:
 		// Read the response body first to check if it's empty
-		body, err := io.ReadAll(resp.Body)
+		body, err := readBody(ctx, resp)
 		if err != nil {
-			// If we can't read the body but got 200 OK, treat as success
-			return &UpdateResponse{
-				Updated: []string{},
-				Failed:  []string{},
-				Message: "Update triggered successfully (empty response)",
-			}, nil
+			return nil, err
 		}
 
 		// If body is empty, treat as successful trigger
@@ -167,8 +199,9 @@ func (c *WatchtowerClient) TriggerUpdateWithTimeout(timeout time.Duration) (*Upd
 		return &updateResp, nil
 
 	case http.StatusAccepted:
+		// No containers are known yet; only the message describes the outcome
 		return &UpdateResponse{
-			Updated: []string{"Update accepted and processing"},
+			Updated: []string{},
 			Failed:  []string{},
 			Message: "Update queued and processing in background",
 		}, nil
@@ -180,22 +213,6 @@ func (c *WatchtowerClient) TriggerUpdateWithTimeout(timeout time.Duration) (*Upd
 			Message: "Update triggered successfully (no content)",
 		}, nil
 
-	case http.StatusBadGateway:
-		return nil, fmt.Errorf("watchtower service unavailable (502 Bad Gateway)")
-
-	case http.StatusGatewayTimeout:
-		return &UpdateResponse{
-			Updated: []string{},
-			Failed:  []string{},
-			Message: "Update triggered (gateway timeout but likely processing)",
-		}, nil
-
-	case http.StatusServiceUnavailable:
-		return nil, fmt.Errorf("watchtower service temporarily unavailable (503)")
-
-	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("authentication failed - check your token")
-
 	default:
 		// For any 2xx status, treat as success
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
@@ -209,22 +226,39 @@ func (c *WatchtowerClient) TriggerUpdateWithTimeout(timeout time.Duration) (*Upd
 	}
 }
 
-// Keep the original method for backward compatibility
-func (c *WatchtowerClient) TriggerUpdate() (*UpdateResponse, error) {
-	return c.TriggerUpdateWithTimeout(5 * time.Minute) // 5 minute timeout for updates
-}
+// GetStatus summarises Watchtower's metrics endpoint
+func (c *WatchtowerClient) GetStatus(ctx context.Context) (*WatchtowerStatus, error) {
+	metrics, err := c.GetMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-func (c *WatchtowerClient) GetStatus() (*WatchtowerStatus, error) {
-	return &WatchtowerStatus{
-		Version: "1.7.1",
-		Status:  "running",
-	}, nil
+	status := &WatchtowerStatus{
+		Version:    "unknown",
+		Status:     "running",
+		Containers: metrics.WatchtowerStats().Scanned,
+	}
+	for _, name := range metrics.Names() {
+		if !strings.HasPrefix(name, "watchtower_") {
+			continue
+		}
+		for _, sample := range metrics.Families[name].Samples {
+			if v, ok := sample.Labels["version"]; ok {
+				status.Version = v
+			}
+		}
+	}
+	return status, nil
 }
 
-func (c *WatchtowerClient) TestConnection() error {
-	resp, err := c.doRequest("GET", "/v1/update")
+// TestConnection checks that Watchtower is reachable and accepts the token
+func (c *WatchtowerClient) TestConnection(ctx context.Context) error {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", "/v1/update")
 	if err != nil {
-		return fmt.Errorf("connection test failed: %v", err)
+		return fmt.Errorf("connection test failed: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -236,10 +270,13 @@ func (c *WatchtowerClient) TestConnection() error {
 }
 
 // GetUpdateJobs gets recent update jobs
-func (c *WatchtowerClient) GetUpdateJobs(limit int) ([]UpdateJob, error) {
-	resp, err := c.doRequest("GET", fmt.Sprintf("/v1/update?limit=%d", limit))
+func (c *WatchtowerClient) GetUpdateJobs(ctx context.Context, limit int) ([]UpdateJob, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/update?limit=%d", limit))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get update jobs: %v", err)
+		return nil, fmt.Errorf("failed to get update jobs: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -247,10 +284,9 @@ func (c *WatchtowerClient) GetUpdateJobs(limit int) ([]UpdateJob, error) {
 		return nil, fmt.Errorf("API returned status: %d", resp.StatusCode)
 	}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(ctx, resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		return nil, err
 	}
 
 	var response struct {
@@ -265,10 +301,13 @@ func (c *WatchtowerClient) GetUpdateJobs(limit int) ([]UpdateJob, error) {
 }
 
 // GetUpdateJob gets specific update job details
-func (c *WatchtowerClient) GetUpdateJob(jobID string) (*UpdateJob, error) {
-	resp, err := c.doRequest("GET", fmt.Sprintf("/v1/update/%s", jobID))
+func (c *WatchtowerClient) GetUpdateJob(ctx context.Context, jobID string) (*UpdateJob, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/update/%s", jobID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get update job: %v", err)
+		return nil, fmt.Errorf("failed to get update job: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -276,10 +315,9 @@ func (c *WatchtowerClient) GetUpdateJob(jobID string) (*UpdateJob, error) {
 		return nil, fmt.Errorf("API returned status: %d", resp.StatusCode)
 	}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(ctx, resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		return nil, err
 	}
 
 	var job UpdateJob
@@ -290,11 +328,14 @@ func (c *WatchtowerClient) GetUpdateJob(jobID string) (*UpdateJob, error) {
 	return &job, nil
 }
 
-// GetMetrics gets Prometheus metrics
-func (c *WatchtowerClient) GetMetrics() (*MetricsResponse, error) {
-	resp, err := c.doRequest("GET", "/v1/metrics")
+// GetMetrics fetches and parses Watchtower's Prometheus metrics
+func (c *WatchtowerClient) GetMetrics(ctx context.Context) (*Metrics, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", "/v1/metrics")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get metrics: %v", err)
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -302,21 +343,12 @@ func (c *WatchtowerClient) GetMetrics() (*MetricsResponse, error) {
 		return nil, fmt.Errorf("API returned status: %d", resp.StatusCode)
 	}
 
-	metricsData := make(map[string]string)
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.HasPrefix(line, "#") && strings.Contains(line, " ") {
-			parts := strings.Split(line, " ")
-			if len(parts) >= 2 {
-				metricsData[parts[0]] = parts[1]
-			}
+	metrics, err := ParseMetrics(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, classifyTransportError(ctx, ctx.Err())
 		}
+		return nil, fmt.Errorf("failed to parse metrics: %v", err)
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error scanning metrics response: %v", err)
-	}
-
-	return &MetricsResponse{Data: metricsData}, nil
+	return metrics, nil
 }
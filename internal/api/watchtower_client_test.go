@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorStatusesMapToSentinels(t *testing.T) {
+	cases := map[int]error{
+		http.StatusUnauthorized:       ErrUnauthorized,
+		http.StatusBadGateway:         ErrUnavailable,
+		http.StatusServiceUnavailable: ErrUnavailable,
+		http.StatusGatewayTimeout:     ErrTimeout,
+	}
+	for code, want := range cases {
+		watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+
+		_, err := NewWatchtowerClient(watchtower.URL, "token").TriggerUpdate(context.Background())
+		if !errors.Is(err, want) {
+			t.Errorf("status %d: got %v, want %v", code, err, want)
+		}
+		watchtower.Close()
+	}
+}
+
+func TestAcceptedUpdateNamesNoContainers(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer watchtower.Close()
+
+	resp, err := NewWatchtowerClient(watchtower.URL, "token").TriggerUpdate(context.Background())
+	if err != nil {
+		t.Fatalf("TriggerUpdate: %v", err)
+	}
+	if len(resp.Updated) != 0 || len(resp.Failed) != 0 || resp.Message == "" {
+		t.Errorf("expected a message-only response, got %+v", resp)
+	}
+}
+
+func TestUnreachableIsUnavailable(t *testing.T) {
+	watchtower := httptest.NewServer(http.NotFoundHandler())
+	url := watchtower.URL
+	watchtower.Close()
+
+	err := NewWatchtowerClient(url, "token").TestConnection(context.Background())
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+}
+
+func TestDeadlineIsTimeout(t *testing.T) {
+	release := make(chan struct{})
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer watchtower.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := NewWatchtowerClient(watchtower.URL, "token").TriggerUpdate(ctx)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded kept in the chain", err)
+	}
+}
+
+func TestCancelAbortsRequest(t *testing.T) {
+	release := make(chan struct{})
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer watchtower.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := NewWatchtowerClient(watchtower.URL, "token").TriggerUpdate(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("cancellation reported as %v", err)
+	}
+}
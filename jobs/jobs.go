@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+)
+
+// State is the lifecycle stage of a job
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Done reports whether the job has finished
+func (s State) Done() bool {
+	return s != StateRunning
+}
+
+// Result is one container's outcome, mirroring api.UpdateJob results
+type Result struct {
+	Container string `json:"container"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Job is a background Watchtower update on one server
+type Job struct {
+	ID          string    `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Workspace   string    `json:"workspace,omitempty"`
+	ChatID      int64     `json:"chat_id"`
+	Server      string    `json:"server"`
+	Source      string    `json:"source,omitempty"`
+	TriggeredBy int64     `json:"triggered_by,omitempty"`
+	State       State     `json:"state"`
+	Started     time.Time `json:"started"`
+	Ended       time.Time `json:"ended"`
+	Results     []Result  `json:"results"`
+	Message     string    `json:"message,omitempty"`
+	Error       string    `json:"error,omitempty"`
+
+	// Response is the raw Watchtower answer of a succeeded job
+	Response *api.UpdateResponse `json:"-"`
+	// Err is the failure of a failed or cancelled job
+	Err error `json:"-"`
+}
+
+// Duration is how long the job ran, or has been running
+func (j Job) Duration() time.Duration {
+	if j.Ended.IsZero() {
+		return time.Since(j.Started)
+	}
+	return j.Ended.Sub(j.Started)
+}
+
+// Spec describes who started a job and what it targets
+type Spec struct {
+	UserID int64
+	ChatID int64
+	Server string
+	// Workspace owns Server; history is recorded there
+	Workspace string
+	// Source says what started the job, e.g. servers.SourceManual
+	Source string
+	// TriggeredBy is the user who started the job, 0 for scheduled runs
+	TriggeredBy int64
+}
+
+// RunFunc performs the update; it must stop when ctx is cancelled
+type RunFunc func(ctx context.Context) (*api.UpdateResponse, error)
+
+// DefaultRetention is how many finished jobs a Manager remembers
+const DefaultRetention = 100
+
+// Manager runs jobs and keeps their state in memory
+type Manager struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	finished  []string // IDs of finished jobs, oldest first
+	retention int
+	wg        sync.WaitGroup
+}
+
+func NewManager(retention int) *Manager {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Manager{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+	}
+}
+
+// Start runs the job in the background and returns its initial state.
+// onDone, if set, receives the final state once the job has finished.
+func (m *Manager) Start(ctx context.Context, spec Spec, run RunFunc, onDone func(Job)) Job {
+	job := m.register(spec)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		final := m.execute(ctx, job.ID, run)
+		if onDone != nil {
+			onDone(final)
+		}
+	}()
+	return job
+}
+
+// Run runs the job in the calling goroutine and returns its final state.
+// The job is visible through Get and List while it runs.
+func (m *Manager) Run(ctx context.Context, spec Spec, run RunFunc) Job {
+	job := m.register(spec)
+	m.wg.Add(1)
+	defer m.wg.Done()
+	return m.execute(ctx, job.ID, run)
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return snapshot(job), true
+}
+
+// List returns up to limit of userID's jobs, newest first (limit <= 0 means all)
+func (m *Manager) List(userID int64, limit int) []Job {
+	m.mu.Lock()
+	var list []Job
+	for _, job := range m.jobs {
+		if job.UserID == userID {
+			list = append(list, snapshot(job))
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.After(list[j].Started) })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// Wait blocks until every running job has finished
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Manager) register(spec Spec) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := &Job{
+		ID:          m.newID(),
+		UserID:      spec.UserID,
+		Workspace:   spec.Workspace,
+		ChatID:      spec.ChatID,
+		Server:      spec.Server,
+		Source:      spec.Source,
+		TriggeredBy: spec.TriggeredBy,
+		State:       StateRunning,
+		Started:     time.Now(),
+	}
+	m.jobs[job.ID] = job
+	return snapshot(job)
+}
+
+func (m *Manager) execute(ctx context.Context, id string, run RunFunc) Job {
+	response, err := run(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := m.jobs[id]
+	job.Ended = time.Now()
+	switch {
+	case err == nil:
+		job.State = StateSucceeded
+		job.Response = response
+		job.Message = response.Message
+		job.Results = results(response)
+	case errors.Is(err, context.Canceled):
+		job.State = StateCancelled
+		job.Err = err
+		job.Error = err.Error()
+	default:
+		job.State = StateFailed
+		job.Err = err
+		job.Error = err.Error()
+	}
+
+	m.finished = append(m.finished, id)
+	for len(m.finished) > m.retention {
+		delete(m.jobs, m.finished[0])
+		m.finished = m.finished[1:]
+	}
+	return snapshot(job)
+}
+
+// newID returns a short random ID that is easy to type (Caller must hold lock)
+func (m *Manager) newID() string {
+	for {
+		b := make([]byte, 3)
+		if _, err := rand.Read(b); err != nil {
+			panic("jobs: crypto/rand failed: " + err.Error())
+		}
+		id := hex.EncodeToString(b)
+		if _, taken := m.jobs[id]; !taken {
+			return id
+		}
+	}
+}
+
+// results flattens Watchtower's updated/failed lists into per-container results
+func results(response *api.UpdateResponse) []Result {
+	var list []Result
+	for _, name := range response.Updated {
+		list = append(list, Result{Container: name, Status: "updated"})
+	}
+	for _, name := range response.Failed {
+		list = append(list, Result{Container: name, Status: "failed"})
+	}
+	return list
+}
+
+// snapshot copies a job so callers can't race with the runner (Caller must hold lock)
+func snapshot(job *Job) Job {
+	c := *job
+	c.Results = append([]Result(nil), job.Results...)
+	return c
+}
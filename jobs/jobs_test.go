@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+)
+
+func TestStartRunsInBackground(t *testing.T) {
+	m := NewManager(0)
+	release := make(chan struct{})
+	done := make(chan Job, 1)
+
+	job := m.Start(context.Background(), Spec{UserID: 1, ChatID: 10, Server: "home"},
+		func(ctx context.Context) (*api.UpdateResponse, error) {
+			<-release
+			return &api.UpdateResponse{Updated: []string{"web"}, Failed: []string{"db"}}, nil
+		},
+		func(j Job) { done <- j })
+
+	if job.State != StateRunning || job.ID == "" {
+		t.Fatalf("expected running job with ID, got %+v", job)
+	}
+	if got, ok := m.Get(job.ID); !ok || got.State != StateRunning {
+		t.Fatalf("Get while running: %+v, %v", got, ok)
+	}
+
+	close(release)
+	final := <-done
+	if final.State != StateSucceeded || final.Ended.IsZero() {
+		t.Fatalf("unexpected final state: %+v", final)
+	}
+	want := []Result{{Container: "web", Status: "updated"}, {Container: "db", Status: "failed"}}
+	if len(final.Results) != 2 || final.Results[0] != want[0] || final.Results[1] != want[1] {
+		t.Errorf("unexpected results: %+v", final.Results)
+	}
+}
+
+func TestRunRecordsFailureAndCancellation(t *testing.T) {
+	m := NewManager(0)
+
+	failed := m.Run(context.Background(), Spec{UserID: 1, Server: "home"},
+		func(ctx context.Context) (*api.UpdateResponse, error) {
+			return nil, api.ErrUnavailable
+		})
+	if failed.State != StateFailed || !errors.Is(failed.Err, api.ErrUnavailable) || failed.Error == "" {
+		t.Errorf("expected failed job, got %+v", failed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := m.Run(ctx, Spec{UserID: 1, Server: "home"},
+		func(ctx context.Context) (*api.UpdateResponse, error) {
+			return nil, ctx.Err()
+		})
+	if cancelled.State != StateCancelled {
+		t.Errorf("expected cancelled job, got %+v", cancelled)
+	}
+}
+
+func TestListIsPerUserNewestFirst(t *testing.T) {
+	m := NewManager(0)
+	ok := func(ctx context.Context) (*api.UpdateResponse, error) { return &api.UpdateResponse{}, nil }
+
+	first := m.Run(context.Background(), Spec{UserID: 1, Server: "a"}, ok)
+	time.Sleep(time.Millisecond)
+	second := m.Run(context.Background(), Spec{UserID: 1, Server: "b"}, ok)
+	m.Run(context.Background(), Spec{UserID: 2, Server: "c"}, ok)
+
+	list := m.List(1, 0)
+	if len(list) != 2 || list[0].ID != second.ID || list[1].ID != first.ID {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+	if limited := m.List(1, 1); len(limited) != 1 || limited[0].ID != second.ID {
+		t.Errorf("unexpected limited list: %+v", limited)
+	}
+}
+
+func TestRetentionDropsOldestFinished(t *testing.T) {
+	m := NewManager(2)
+	ok := func(ctx context.Context) (*api.UpdateResponse, error) { return &api.UpdateResponse{}, nil }
+
+	oldest := m.Run(context.Background(), Spec{UserID: 1}, ok)
+	m.Run(context.Background(), Spec{UserID: 1}, ok)
+	m.Run(context.Background(), Spec{UserID: 1}, ok)
+
+	if _, ok := m.Get(oldest.ID); ok {
+		t.Error("expected oldest job to be evicted")
+	}
+	if n := len(m.List(1, 0)); n != 2 {
+		t.Errorf("expected 2 retained jobs, got %d", n)
+	}
+}
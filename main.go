@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -9,9 +10,13 @@ import (
 	"net/http"
 
 	"github.com/joho/godotenv"
+	"github.com/kfilin/watchtower-masterbot/access"
 	"github.com/kfilin/watchtower-masterbot/bot"
 	"github.com/kfilin/watchtower-masterbot/config"
 	"github.com/kfilin/watchtower-masterbot/health"
+	"github.com/kfilin/watchtower-masterbot/hooks"
+	"github.com/kfilin/watchtower-masterbot/scheduler"
+	"github.com/kfilin/watchtower-masterbot/servers"
 	"github.com/kfilin/watchtower-masterbot/web"
 )
 
@@ -22,23 +27,60 @@ func main() {
 	// 1. Load Config
 	cfg := config.Load()
 
+	// Offline maintenance subcommands
+	if len(os.Args) > 1 && os.Args[1] == "rotate-key" {
+		os.Exit(runRotateKey(cfg, os.Args[2:]))
+	}
+
 	// 2. Initialize Bot (Graceful Error Handling)
-	encryptionKey := os.Getenv("ENCRYPTION_KEY")
+	encryptionKey := cfg.EncryptionKey
 	if encryptionKey == "" {
+		if cfg.IsProduction() {
+			log.Println("❌ ENCRYPTION_KEY is required when APP_ENV=production - refusing to start")
+			os.Exit(1)
+		}
 		encryptionKey = "default-encryption-key-change-in-production"
 		log.Println("⚠️  Using default encryption key - set ENCRYPTION_KEY for production")
 	}
 
-	botInstance, err := bot.NewBot(cfg.TelegramToken, cfg.AdminID, encryptionKey, cfg.WebAppURL)
+	keys, err := servers.NewKeyring(encryptionKey, cfg.RetiredKeys...)
+	if err != nil {
+		log.Printf("❌ Invalid encryption keys: %v", err)
+		os.Exit(1)
+	}
+
+	store, err := servers.OpenStore(cfg.StorageBackend, cfg.DataDir)
+	if err != nil {
+		log.Printf("❌ Failed to open %s storage in %s: %v", cfg.StorageBackend, cfg.DataDir, err)
+		os.Exit(1)
+	}
+	mgr, err := servers.NewManager(keys, store)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		os.Exit(1)
+	}
+	defer mgr.Close()
+	mgr.SetHistoryRetention(cfg.HistoryRetention, cfg.HistoryMaxAge)
+
+	acl := access.NewController(mgr, cfg.AdminID)
+	if acl.Open() {
+		log.Println("⚠️  ADMIN_USER_ID is not set and the access list is empty - everybody has owner access")
+	}
+
+	botInstance, err := bot.NewBot(cfg.TelegramToken, acl, mgr, cfg.WebAppURL, cfg.BotWorkers)
 
 	// 3. Start Health & Web Server
 	log.Printf("🏥 Starting Health & Web Server on port %s...", cfg.HealthPort)
 
+	var webServer *web.WebServer
 	registerWeb := func(mux *http.ServeMux) {
 		if err == nil {
-			webServer := web.NewServer(botInstance.GetManager(), cfg.AdminID, cfg.TelegramToken)
+			webServer = web.NewServer(mgr, acl, cfg.TelegramToken, cfg.WebAppAuthMaxAge, cfg.WebAppSessionTTL)
 			webServer.RegisterHandlers(mux)
 			log.Println("⚡ Retro Terminal TWA registered at /terminal")
+
+			hooks.NewReceiver(mgr, botInstance.NotifyWatchtowerReport).RegisterHandlers(mux)
+			log.Printf("📬 Watchtower webhooks registered at %s<server-id>", hooks.PathPrefix)
 		}
 	}
 
@@ -68,12 +110,26 @@ func main() {
 	// 4. Start Bot (only if initialization succeeded)
 	health.SetBotStatus("running")
 	go botInstance.Start()
+
+	// Bot-owned update schedules (see /schedule)
+	schedCtx, stopScheduler := context.WithCancel(context.Background())
+	sched := scheduler.New(mgr, botInstance.RunScheduledUpdate, scheduler.SystemClock{})
+	go sched.Run(schedCtx)
 	log.Printf("✅ Telegram bot started successfully! Health endpoints available at: http://localhost:%s/health", cfg.HealthPort)
 
 	// 5. Keep Alive
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
-	log.Println("🛑 Shutting down...")
+	log.Printf("🛑 Shutting down, draining for up to %s...", cfg.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Let queued messages and running update jobs finish before exiting
+	stopScheduler()
+	botInstance.Stop(ctx)
+	if webServer != nil {
+		webServer.Close()
+	}
 	health.Shutdown()
 }
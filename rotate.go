@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/kfilin/watchtower-masterbot/config"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// runRotateKey implements the "rotate-key" subcommand.
+// It re-encrypts every stored token with ENCRYPTION_KEY, reading existing
+// records with the retired keys. Stop the bot before running it.
+func runRotateKey(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	retired := fs.String("retired", strings.Join(cfg.RetiredKeys, ","),
+		"comma-separated retired keys (defaults to ENCRYPTION_KEYS_RETIRED)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if cfg.EncryptionKey == "" {
+		log.Println("❌ Set ENCRYPTION_KEY to the new primary key before rotating")
+		return 1
+	}
+
+	var retiredKeys []string
+	for _, k := range strings.Split(*retired, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			retiredKeys = append(retiredKeys, k)
+		}
+	}
+	if len(retiredKeys) == 0 {
+		log.Println("⚠️  No retired keys given - only records in outdated formats will be rewritten")
+	}
+
+	keys, err := servers.NewKeyring(cfg.EncryptionKey, retiredKeys...)
+	if err != nil {
+		log.Printf("❌ Invalid encryption keys: %v", err)
+		return 1
+	}
+
+	store, err := servers.OpenStore(cfg.StorageBackend, cfg.DataDir)
+	if err != nil {
+		log.Printf("❌ Failed to open %s storage in %s (is the bot still running?): %v", cfg.StorageBackend, cfg.DataDir, err)
+		return 1
+	}
+	mgr, err := servers.NewManager(keys, store)
+	if err != nil {
+		store.Close()
+		log.Printf("❌ %v", err)
+		return 1
+	}
+	defer mgr.Close()
+
+	n, err := mgr.RotateKeys()
+	if err != nil {
+		log.Printf("❌ Key rotation aborted after %d token(s): %v", n, err)
+		return 1
+	}
+
+	log.Printf("🔐 Re-encrypted %d token(s) with key %s", n, keys.PrimaryID())
+	log.Println("💡 Retired keys can now be removed from ENCRYPTION_KEYS_RETIRED")
+	return 0
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, loc *time.Location, value string) time.Time {
+	t.Helper()
+	ts, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatalf("parse %q: %v", value, err)
+	}
+	return ts
+}
+
+func TestCronNext(t *testing.T) {
+	cases := []struct {
+		expr, from, want string
+	}{
+		{"*/15 * * * *", "2026-03-10 10:07", "2026-03-10 10:15"},
+		{"0 4 * * *", "2026-03-10 04:00", "2026-03-11 04:00"},
+		{"30 2 * * mon-fri", "2026-03-13 03:00", "2026-03-16 02:30"}, // Fri -> Mon
+		{"0 0 1 * *", "2026-01-31 12:00", "2026-02-01 00:00"},
+		{"0 12 * jun,dec 0", "2026-03-10 00:00", "2026-06-07 12:00"}, // first Sunday of June
+		{"0 9 13 * 5", "2026-03-01 00:00", "2026-03-06 09:00"},       // dom OR dow: Friday 6th
+		{"@hourly", "2026-03-10 10:59", "2026-03-10 11:00"},
+		{"0 0 * * 7", "2026-03-10 00:00", "2026-03-15 00:00"}, // 7 is Sunday
+		{"5/20 * * * *", "2026-03-10 10:26", "2026-03-10 10:45"},
+	}
+	for _, tc := range cases {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tc.expr, err)
+		}
+		got := c.Next(mustTime(t, time.UTC, tc.from))
+		if want := mustTime(t, time.UTC, tc.want); !got.Equal(want) {
+			t.Errorf("%q after %s: got %s, want %s", tc.expr, tc.from, got.Format("2006-01-02 15:04 Mon"), tc.want)
+		}
+	}
+}
+
+func TestCronNextAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	c, _ := ParseCron("0 4 * * *")
+
+	// Clocks jump from 02:00 to 03:00 on 2026-03-29
+	got := c.Next(mustTime(t, berlin, "2026-03-28 05:00"))
+	if want := mustTime(t, berlin, "2026-03-29 04:00"); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got.Hour() != 4 {
+		t.Errorf("expected local 04:00, got %s", got)
+	}
+}
+
+func TestCronHalfHourZone(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	c, _ := ParseCron("0 3 * * *")
+	got := c.Next(mustTime(t, kolkata, "2026-03-10 01:10"))
+	if want := mustTime(t, kolkata, "2026-03-10 03:00"); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"@often",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestCronImpossibleDate(t *testing.T) {
+	c, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("ParseCron: %v", err)
+	}
+	if got := c.Next(time.Now()); !got.IsZero() {
+		t.Errorf("expected no run for Feb 30, got %s", got)
+	}
+}
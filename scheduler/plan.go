@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// Window is a daily time range such as 02:00-05:00, end exclusive.
+// A window may cross midnight (e.g. 23:00-01:00).
+type Window struct {
+	start, end int // minutes since midnight
+}
+
+// ParseWindow parses "HH:MM-HH:MM"
+func ParseWindow(s string) (*Window, error) {
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("window %q: expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(a)
+	if err != nil {
+		return nil, fmt.Errorf("window %q: %w", s, err)
+	}
+	end, err := parseClock(b)
+	if err != nil {
+		return nil, fmt.Errorf("window %q: %w", s, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("window %q is empty", s)
+	}
+	return &Window{start: start, end: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains reports whether t's wall clock falls inside the window
+func (w *Window) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+func (w *Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+// Plan is a compiled servers.UpdateSchedule
+type Plan struct {
+	Cron     *Cron
+	Location *time.Location
+	// Window is nil when runs are allowed at any time
+	Window *Window
+}
+
+// How many cron matches Next inspects looking for one inside the window
+const maxWindowProbes = 10000
+
+// Compile validates a schedule and resolves its timezone
+func Compile(sched servers.UpdateSchedule) (*Plan, error) {
+	cron, err := ParseCron(sched.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Cron: cron, Location: time.UTC}
+	if sched.Timezone != "" {
+		loc, err := time.LoadLocation(sched.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", sched.Timezone)
+		}
+		plan.Location = loc
+	}
+	if sched.Window != "" {
+		if plan.Window, err = ParseWindow(sched.Window); err != nil {
+			return nil, err
+		}
+	}
+
+	if plan.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs inside window %s", sched.Cron, sched.Window)
+	}
+	return plan, nil
+}
+
+// Next returns the first run strictly after t that satisfies the cron
+// expression and the window, or the zero time if there is none
+func (p *Plan) Next(t time.Time) time.Time {
+	next := t.In(p.Location)
+	for i := 0; i < maxWindowProbes; i++ {
+		next = p.Cron.Next(next)
+		if next.IsZero() || p.InWindow(next) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// InWindow reports whether t is inside the maintenance window, if any
+func (p *Plan) InWindow(t time.Time) bool {
+	return p.Window == nil || p.Window.Contains(t.In(p.Location))
+}
@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// Clock tells the scheduler the time; tests substitute a fake
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// Store is the part of servers.ServerManager the scheduler needs
+type Store interface {
+	ScheduledServers() []servers.ScheduledServer
+	RecordScheduleRun(workspaceID string, nickname string, lastRun, nextRun time.Time) error
+}
+
+// FireFunc starts an update of a scheduled server as the schedule's owner;
+// it must not block
+type FireFunc func(entry servers.ScheduledServer)
+
+const (
+	// DefaultInterval is how often Run checks for due schedules
+	DefaultInterval = 30 * time.Second
+	// MissedRunGrace is how late a run may still start, e.g. after a restart.
+	// Older missed runs are skipped rather than fired at an unexpected time.
+	MissedRunGrace = time.Hour
+)
+
+// Scheduler fires updates when servers' schedules come due.
+// Next and last run times live in the servers' UpdateSchedule, so they
+// survive restarts.
+type Scheduler struct {
+	store    Store
+	fire     FireFunc
+	clock    Clock
+	interval time.Duration
+}
+
+func New(store Store, fire FireFunc, clock Clock) *Scheduler {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	return &Scheduler{
+		store:    store,
+		fire:     fire,
+		clock:    clock,
+		interval: DefaultInterval,
+	}
+}
+
+// Run checks schedules every interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("⏰ Scheduler started (checking every %s)", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Tick()
+		select {
+		case <-ctx.Done():
+			log.Println("⏰ Scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick fires every due schedule once and returns how many fired
+func (s *Scheduler) Tick() int {
+	now := s.clock.Now()
+	fired := 0
+
+	for _, entry := range s.store.ScheduledServers() {
+		sched := entry.Schedule
+		plan, err := Compile(sched)
+		if err != nil {
+			log.Printf("⚠️ Schedule of %s (workspace %s) is invalid: %v", entry.Nickname, entry.Workspace, err)
+			continue
+		}
+
+		// New schedule, or one saved before its first run was computed
+		if sched.NextRun.IsZero() {
+			s.record(entry, time.Time{}, plan.Next(now))
+			continue
+		}
+		if now.Before(sched.NextRun) {
+			continue
+		}
+
+		late := now.Sub(sched.NextRun)
+		due := late <= MissedRunGrace && plan.InWindow(now)
+		if !due {
+			log.Printf("⏭ Skipping missed run of %s (workspace %s) due %s", entry.Nickname, entry.Workspace, sched.NextRun.Format(time.RFC3339))
+			s.record(entry, time.Time{}, plan.Next(now))
+			continue
+		}
+
+		// Persist first so a failed write can't make the run repeat every tick
+		if !s.record(entry, now, plan.Next(now)) {
+			continue
+		}
+		log.Printf("⏰ Scheduled update of %s (workspace %s, user %d)", entry.Nickname, entry.Workspace, entry.UserID)
+		s.fire(entry)
+		fired++
+	}
+	return fired
+}
+
+func (s *Scheduler) record(entry servers.ScheduledServer, lastRun, nextRun time.Time) bool {
+	if err := s.store.RecordScheduleRun(entry.Workspace, entry.Nickname, lastRun, nextRun); err != nil {
+		log.Printf("❌ Failed to save schedule of %s (workspace %s): %v", entry.Nickname, entry.Workspace, err)
+		return false
+	}
+	return true
+}
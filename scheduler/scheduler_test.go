@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+type fakeStore struct {
+	entries []servers.ScheduledServer
+	failing bool
+}
+
+func (s *fakeStore) ScheduledServers() []servers.ScheduledServer {
+	return append([]servers.ScheduledServer(nil), s.entries...)
+}
+
+func (s *fakeStore) RecordScheduleRun(workspaceID string, nickname string, lastRun, nextRun time.Time) error {
+	if s.failing {
+		return errors.New("disk full")
+	}
+	for i := range s.entries {
+		if s.entries[i].Workspace == workspaceID && s.entries[i].Nickname == nickname {
+			if !lastRun.IsZero() {
+				s.entries[i].Schedule.LastRun = lastRun
+			}
+			s.entries[i].Schedule.NextRun = nextRun
+		}
+	}
+	return nil
+}
+
+func newTestScheduler(entries ...servers.ScheduledServer) (*Scheduler, *fakeStore, *fakeClock, *[]string) {
+	store := &fakeStore{entries: entries}
+	clock := &fakeClock{}
+	var fired []string
+	s := New(store, func(entry servers.ScheduledServer) { fired = append(fired, entry.Nickname) }, clock)
+	return s, store, clock, &fired
+}
+
+func TestSchedulerFiresWhenDue(t *testing.T) {
+	s, store, clock, fired := newTestScheduler(servers.ScheduledServer{
+		Workspace: "1", UserID: 1, Nickname: "home", Schedule: servers.UpdateSchedule{Cron: "0 4 * * *"},
+	})
+
+	clock.now = mustTime(t, time.UTC, "2026-03-10 01:00")
+	s.Tick()
+	if want := mustTime(t, time.UTC, "2026-03-10 04:00"); !store.entries[0].Schedule.NextRun.Equal(want) {
+		t.Fatalf("expected first run computed as %s, got %s", want, store.entries[0].Schedule.NextRun)
+	}
+	if len(*fired) != 0 {
+		t.Fatalf("fired before due: %v", *fired)
+	}
+
+	clock.now = mustTime(t, time.UTC, "2026-03-10 04:00")
+	if n := s.Tick(); n != 1 || len(*fired) != 1 {
+		t.Fatalf("expected one run at 04:00, got %d (%v)", n, *fired)
+	}
+	sched := store.entries[0].Schedule
+	if !sched.LastRun.Equal(clock.now) || !sched.NextRun.Equal(mustTime(t, time.UTC, "2026-03-11 04:00")) {
+		t.Errorf("unexpected run times after firing: %+v", sched)
+	}
+
+	// The same tick again must not fire twice
+	if n := s.Tick(); n != 0 {
+		t.Errorf("fired again in the same minute")
+	}
+}
+
+func TestSchedulerUsesTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	s, store, clock, _ := newTestScheduler(servers.ScheduledServer{
+		Workspace: "1", UserID: 1, Nickname: "home", Schedule: servers.UpdateSchedule{Cron: "0 4 * * *", Timezone: "America/New_York"},
+	})
+
+	clock.now = mustTime(t, time.UTC, "2026-01-10 00:00")
+	s.Tick()
+	// 04:00 EST is 09:00 UTC
+	if want := mustTime(t, time.UTC, "2026-01-10 09:00"); !store.entries[0].Schedule.NextRun.Equal(want) {
+		t.Errorf("got %s, want %s", store.entries[0].Schedule.NextRun.UTC(), want)
+	}
+}
+
+func TestSchedulerRespectsWindow(t *testing.T) {
+	s, store, clock, _ := newTestScheduler(servers.ScheduledServer{
+		Workspace: "1", UserID: 1, Nickname: "home", Schedule: servers.UpdateSchedule{Cron: "0 * * * *", Window: "23:00-01:00"},
+	})
+
+	clock.now = mustTime(t, time.UTC, "2026-03-10 12:30")
+	s.Tick()
+	if want := mustTime(t, time.UTC, "2026-03-10 23:00"); !store.entries[0].Schedule.NextRun.Equal(want) {
+		t.Errorf("got %s, want %s", store.entries[0].Schedule.NextRun, want)
+	}
+}
+
+func TestSchedulerSkipsStaleMissedRun(t *testing.T) {
+	s, store, clock, fired := newTestScheduler(servers.ScheduledServer{
+		Workspace: "1", UserID: 1, Nickname: "home", Schedule: servers.UpdateSchedule{
+			Cron: "0 4 * * *", NextRun: mustTime(t, time.UTC, "2026-03-10 04:00"),
+		},
+	})
+
+	// Restarted shortly after the run was due: catch up
+	clock.now = mustTime(t, time.UTC, "2026-03-10 04:20")
+	if s.Tick() != 1 {
+		t.Fatal("expected a recent missed run to fire")
+	}
+
+	// Down for a day: skip rather than update at an unexpected time
+	store.entries[0].Schedule.NextRun = mustTime(t, time.UTC, "2026-03-11 04:00")
+	clock.now = mustTime(t, time.UTC, "2026-03-12 10:00")
+	if s.Tick() != 0 || len(*fired) != 1 {
+		t.Fatalf("expected stale run to be skipped, fired %v", *fired)
+	}
+	if want := mustTime(t, time.UTC, "2026-03-13 04:00"); !store.entries[0].Schedule.NextRun.Equal(want) {
+		t.Errorf("expected rescheduling to %s, got %s", want, store.entries[0].Schedule.NextRun)
+	}
+}
+
+func TestSchedulerDoesNotFireWhenSaveFails(t *testing.T) {
+	s, store, clock, fired := newTestScheduler(servers.ScheduledServer{
+		Workspace: "1", UserID: 1, Nickname: "home", Schedule: servers.UpdateSchedule{
+			Cron: "0 4 * * *", NextRun: mustTime(t, time.UTC, "2026-03-10 04:00"),
+		},
+	})
+	store.failing = true
+	clock.now = mustTime(t, time.UTC, "2026-03-10 04:00")
+
+	if s.Tick() != 0 || len(*fired) != 0 {
+		t.Errorf("fired although the run could not be recorded: %v", *fired)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow("02:00-05:30")
+	if err != nil {
+		t.Fatalf("ParseWindow: %v", err)
+	}
+	if !w.Contains(mustTime(t, time.UTC, "2026-03-10 05:29")) || w.Contains(mustTime(t, time.UTC, "2026-03-10 05:30")) {
+		t.Error("window end should be exclusive")
+	}
+	for _, bad := range []string{"02:00", "25:00-03:00", "02:00-02:00", "2-3"} {
+		if _, err := ParseWindow(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package servers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every API token, so they are easy to spot in logs and
+// secret scanners
+const APITokenPrefix = "wtm_"
+
+// apiTokenTouchInterval throttles LastUsed writes for busy tokens
+const apiTokenTouchInterval = time.Minute
+
+var (
+	ErrAPITokenNotFound = errors.New("API token not found")
+	ErrInvalidAPIToken  = errors.New("invalid API token")
+	ErrInvalidTokenName = errors.New("token name must be 1-32 characters: letters, digits, '-', '_' or '.'")
+	ErrNoTokenActions   = errors.New("an API token needs at least one action")
+)
+
+// Allows reports whether the token's scope includes action
+func (t APIToken) Allows(action string) bool {
+	for _, a := range t.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the token's scope includes the server nickname
+func (t APIToken) Covers(nickname string) bool {
+	if len(t.Servers) == 0 {
+		return true
+	}
+	for _, s := range t.Servers {
+		if s == nickname {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIToken issues a token for userID's current workspace. servers
+// limits it to some of the workspace's servers (none means all). The token
+// is returned once; only its hash is kept.
+func (sm *ServerManager) CreateAPIToken(userID int64, name string, servers, actions []string) (string, APIToken, error) {
+	if !nicknamePattern.MatchString(name) {
+		return "", APIToken{}, ErrInvalidTokenName
+	}
+	if len(actions) == 0 {
+		return "", APIToken{}, ErrNoTokenActions
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws := sm.activeWorkspace(userID)
+	if ws == nil {
+		return "", APIToken{}, errors.New("no servers configured")
+	}
+	for _, nickname := range servers {
+		if _, exists := ws.Servers[nickname]; !exists {
+			return "", APIToken{}, ErrServerNotFound
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIToken{}, err
+	}
+	raw := APITokenPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	token := APIToken{
+		ID:        id,
+		Name:      name,
+		UserID:    userID,
+		Workspace: ws.ID,
+		Hash:      hashSecret(raw),
+		Servers:   uniqueSorted(servers),
+		Actions:   uniqueSorted(actions),
+		CreatedAt: time.Now(),
+	}
+	if err := sm.store.UpsertAPIToken(token); err != nil {
+		return "", APIToken{}, err
+	}
+	sm.tokens[id] = &token
+	return raw, copyAPIToken(token), nil
+}
+
+// APITokens lists userID's tokens, oldest first
+func (sm *ServerManager) APITokens(userID int64) []APIToken {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	mine := make(map[string]APIToken)
+	for id, t := range sm.tokens {
+		if t.UserID == userID {
+			mine[id] = *t
+		}
+	}
+	return sortedAPITokens(mine)
+}
+
+// RevokeAPIToken deletes one of userID's tokens
+func (sm *ServerManager) RevokeAPIToken(userID int64, id string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	t, exists := sm.tokens[id]
+	if !exists || t.UserID != userID {
+		return ErrAPITokenNotFound
+	}
+	if err := sm.store.DeleteAPIToken(id); err != nil {
+		return err
+	}
+	delete(sm.tokens, id)
+	return nil
+}
+
+// AuthenticateAPIToken returns the token raw belongs to. A token stops
+// working when its user leaves the token's workspace.
+func (sm *ServerManager) AuthenticateAPIToken(raw string) (APIToken, error) {
+	rest, ok := strings.CutPrefix(raw, APITokenPrefix)
+	if !ok {
+		return APIToken{}, ErrInvalidAPIToken
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return APIToken{}, ErrInvalidAPIToken
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	t, exists := sm.tokens[id]
+	if !exists || subtle.ConstantTimeCompare([]byte(hashSecret(raw)), []byte(t.Hash)) != 1 {
+		return APIToken{}, ErrInvalidAPIToken
+	}
+	if ws := sm.workspaces[t.Workspace]; ws == nil || !ws.HasMember(t.UserID) {
+		return APIToken{}, ErrInvalidAPIToken
+	}
+
+	if now := time.Now(); now.Sub(t.LastUsed) > apiTokenTouchInterval {
+		touched := *t
+		touched.LastUsed = now
+		// Losing a LastUsed update is not worth refusing the request
+		if err := sm.store.UpsertAPIToken(touched); err == nil {
+			*t = touched
+		}
+	}
+	return copyAPIToken(*t), nil
+}
+
+// retargetAPITokens moves token scopes that name oldName in ws over to
+// newName, so a token keeps its server across a rename and never covers a
+// later server that reuses the name. An empty newName means the server was
+// removed: tokens scoped to it alone are revoked rather than widened to every
+// server. (Caller must hold lock)
+func (sm *ServerManager) retargetAPITokens(ws *Workspace, oldName, newName string) error {
+	for id, t := range sm.tokens {
+		if t.Workspace != ws.ID || len(t.Servers) == 0 || !t.Covers(oldName) {
+			continue
+		}
+
+		var scope []string
+		for _, s := range t.Servers {
+			if s != oldName {
+				scope = append(scope, s)
+			}
+		}
+		if newName != "" {
+			scope = append(scope, newName)
+		}
+
+		if len(scope) == 0 {
+			if err := sm.store.DeleteAPIToken(id); err != nil {
+				return err
+			}
+			delete(sm.tokens, id)
+			log.Printf("🔑 Revoked API token %s of user %d: its only server %s was removed", id, t.UserID, oldName)
+			continue
+		}
+		updated := copyAPIToken(*t)
+		updated.Servers = uniqueSorted(scope)
+		if err := sm.store.UpsertAPIToken(updated); err != nil {
+			return err
+		}
+		*t = updated
+	}
+	return nil
+}
+
+func uniqueSorted(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	var out []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,114 @@
+package servers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestManagerAPITokens(t *testing.T) {
+	sm := newTestManager(t)
+	sm.AddServer(1, "home", "https://h", "token")
+	sm.AddServer(1, "vps", "https://v", "token")
+
+	if _, _, err := sm.CreateAPIToken(1, "ci", []string{"nope"}, []string{"update"}); !errors.Is(err, ErrServerNotFound) {
+		t.Errorf("expected ErrServerNotFound, got %v", err)
+	}
+	if _, _, err := sm.CreateAPIToken(1, "bad name", nil, []string{"update"}); !errors.Is(err, ErrInvalidTokenName) {
+		t.Errorf("expected ErrInvalidTokenName, got %v", err)
+	}
+	if _, _, err := sm.CreateAPIToken(1, "ci", nil, nil); !errors.Is(err, ErrNoTokenActions) {
+		t.Errorf("expected ErrNoTokenActions, got %v", err)
+	}
+
+	raw, tok, err := sm.CreateAPIToken(1, "ci", []string{"vps", "vps"}, []string{"update", "view"})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if !strings.HasPrefix(raw, APITokenPrefix+tok.ID+"_") || tok.Hash == "" || strings.Contains(tok.Hash, raw) {
+		t.Errorf("unexpected token %q: %+v", raw, tok)
+	}
+	if tok.Workspace != "1" || len(tok.Servers) != 1 || !tok.Covers("vps") || tok.Covers("home") || !tok.Allows("update") || tok.Allows("manage") {
+		t.Errorf("unexpected scope: %+v", tok)
+	}
+
+	got, err := sm.AuthenticateAPIToken(raw)
+	if err != nil || got.ID != tok.ID || got.LastUsed.IsZero() {
+		t.Fatalf("AuthenticateAPIToken: %+v, %v", got, err)
+	}
+	for _, bad := range []string{"", raw + "x", "wtm_" + tok.ID, strings.TrimPrefix(raw, APITokenPrefix)} {
+		if _, err := sm.AuthenticateAPIToken(bad); !errors.Is(err, ErrInvalidAPIToken) {
+			t.Errorf("AuthenticateAPIToken(%q) = %v", bad, err)
+		}
+	}
+
+	if list := sm.APITokens(1); len(list) != 1 || list[0].ID != tok.ID {
+		t.Errorf("unexpected token list: %+v", list)
+	}
+	if list := sm.APITokens(2); len(list) != 0 {
+		t.Errorf("user 2 should have no tokens, got %+v", list)
+	}
+	if err := sm.RevokeAPIToken(2, tok.ID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("expected another user's revoke to fail, got %v", err)
+	}
+	if err := sm.RevokeAPIToken(1, tok.ID); err != nil {
+		t.Fatalf("RevokeAPIToken: %v", err)
+	}
+	if _, err := sm.AuthenticateAPIToken(raw); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("expected a revoked token to fail, got %v", err)
+	}
+}
+
+func TestAPITokenFollowsWorkspaceMembership(t *testing.T) {
+	sm := newTestManager(t)
+	sm.CreateWorkspace(1, "ops")
+	sm.AddServer(1, "vps", "https://v", "token")
+	sm.AddWorkspaceMember(1, 2)
+	sm.SwitchWorkspace(2, "ops")
+
+	raw, _, err := sm.CreateAPIToken(2, "ci", nil, []string{"update"})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if _, err := sm.AuthenticateAPIToken(raw); err != nil {
+		t.Fatalf("AuthenticateAPIToken: %v", err)
+	}
+
+	sm.RemoveWorkspaceMember(1, 2)
+	if _, err := sm.AuthenticateAPIToken(raw); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("expected a former member's token to fail, got %v", err)
+	}
+}
+
+func TestAPITokenScopeFollowsServer(t *testing.T) {
+	sm := newTestManager(t)
+	sm.AddServer(1, "home", "https://h", "token")
+	sm.AddServer(1, "vps", "https://v", "token")
+
+	rawVPS, _, _ := sm.CreateAPIToken(1, "vps-only", []string{"vps"}, []string{"update"})
+	rawBoth, _, _ := sm.CreateAPIToken(1, "both", []string{"home", "vps"}, []string{"update"})
+	rawAll, _, _ := sm.CreateAPIToken(1, "all", nil, []string{"update"})
+
+	// A rename carries the scope over, and a new server reusing the old name is not covered
+	if err := sm.RenameServer(1, "vps", "edge"); err != nil {
+		t.Fatalf("RenameServer: %v", err)
+	}
+	sm.AddServer(1, "vps", "https://v2", "token")
+	if tok, err := sm.AuthenticateAPIToken(rawVPS); err != nil || !tok.Covers("edge") || tok.Covers("vps") {
+		t.Errorf("expected the token to follow the rename, got %+v (%v)", tok, err)
+	}
+
+	// Removing the only server in scope revokes the token instead of widening it
+	if err := sm.RemoveServer(1, "edge"); err != nil {
+		t.Fatalf("RemoveServer: %v", err)
+	}
+	if _, err := sm.AuthenticateAPIToken(rawVPS); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("expected a token scoped to a removed server to be revoked, got %v", err)
+	}
+	if tok, err := sm.AuthenticateAPIToken(rawBoth); err != nil || len(tok.Servers) != 1 || !tok.Covers("home") {
+		t.Errorf("expected only home left in scope, got %+v (%v)", tok, err)
+	}
+	if tok, err := sm.AuthenticateAPIToken(rawAll); err != nil || len(tok.Servers) != 0 {
+		t.Errorf("an unscoped token must be left alone, got %+v (%v)", tok, err)
+	}
+}
@@ -0,0 +1,462 @@
+package servers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketUsers      = []byte("users")
+	bucketWorkspaces = []byte("workspaces")
+	bucketServers    = []byte("servers")
+	bucketHistory    = []byte("history")
+	bucketMembers    = []byte("members")
+	bucketTokens     = []byte("tokens")
+	keyMeta          = []byte("meta")
+)
+
+// userMeta is the per-user record. Freezes, like a user's servers bucket,
+// only exist in data written before workspaces.
+type userMeta struct {
+	TelegramID    int64     `json:"telegram_id"`
+	Workspace     string    `json:"workspace,omitempty"`
+	CurrentServer string    `json:"current_server"`
+	CreatedAt     time.Time `json:"created_at"`
+	Freezes       []Freeze  `json:"freezes,omitempty"`
+}
+
+// workspaceMeta is the per-workspace record stored next to its servers bucket
+type workspaceMeta struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Members   []int64   `json:"members"`
+	Freezes   []Freeze  `json:"freezes,omitempty"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BoltStore keeps users and workspaces in an embedded bbolt database.
+// Layout: users/<telegram id>/meta, workspaces/<id>/{meta, servers/<nickname>},
+// history/<workspace id>/<entry id>, members/<telegram id> and
+// tokens/<token id>, so every operation only touches the records it changes.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketUsers, bucketWorkspaces, bucketHistory, bucketMembers, bucketTokens} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) LoadUsers() (map[int64]*User, error) {
+	users := make(map[int64]*User)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUsers).ForEachBucket(func(k []byte) error {
+			user, err := readUser(tx.Bucket(bucketUsers).Bucket(k))
+			if err != nil {
+				return err
+			}
+			users[user.TelegramID] = user
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *BoltStore) LoadUser(userID int64) (*User, error) {
+	var user *User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(bucketUsers).Bucket(userKey(userID))
+		if ub == nil {
+			return ErrUserNotFound
+		}
+		var err error
+		user, err = readUser(ub)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *BoltStore) UpsertUser(user *User) error {
+	meta, err := json.Marshal(userMeta{
+		TelegramID:    user.TelegramID,
+		Workspace:     user.Workspace,
+		CurrentServer: user.CurrentServer,
+		CreatedAt:     user.CreatedAt,
+		Freezes:       user.Freezes,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		ub, err := tx.Bucket(bucketUsers).CreateBucketIfNotExists(userKey(user.TelegramID))
+		if err != nil {
+			return err
+		}
+		if err := ub.Put(keyMeta, meta); err != nil {
+			return err
+		}
+
+		// Replace the legacy servers bucket wholesale; it goes away once empty
+		if ub.Bucket(bucketServers) != nil {
+			if err := ub.DeleteBucket(bucketServers); err != nil {
+				return err
+			}
+		}
+		if len(user.Servers) == 0 {
+			return nil
+		}
+		sb, err := ub.CreateBucket(bucketServers)
+		if err != nil {
+			return err
+		}
+		return putServers(sb, user.Servers)
+	})
+}
+
+func (s *BoltStore) LoadWorkspaces() (map[string]*Workspace, error) {
+	workspaces := make(map[string]*Workspace)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketWorkspaces).ForEachBucket(func(k []byte) error {
+			ws, err := readWorkspace(tx.Bucket(bucketWorkspaces).Bucket(k))
+			if err != nil {
+				return err
+			}
+			workspaces[ws.ID] = ws
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+func (s *BoltStore) UpsertWorkspace(ws *Workspace) error {
+	meta, err := json.Marshal(workspaceMeta{
+		ID:        ws.ID,
+		Name:      ws.Name,
+		Members:   ws.Members,
+		Freezes:   ws.Freezes,
+		CreatedBy: ws.CreatedBy,
+		CreatedAt: ws.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		wb, err := tx.Bucket(bucketWorkspaces).CreateBucketIfNotExists(workspaceKey(ws.ID))
+		if err != nil {
+			return err
+		}
+		if _, err := wb.CreateBucketIfNotExists(bucketServers); err != nil {
+			return err
+		}
+		return wb.Put(keyMeta, meta)
+	})
+}
+
+func (s *BoltStore) UpsertServer(workspaceID string, server *ServerConfig) error {
+	data, err := json.Marshal(server)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		wb := tx.Bucket(bucketWorkspaces).Bucket(workspaceKey(workspaceID))
+		if wb == nil {
+			return ErrWorkspaceNotFound
+		}
+		return wb.Bucket(bucketServers).Put([]byte(server.Nickname), data)
+	})
+}
+
+func (s *BoltStore) DeleteServer(workspaceID string, nickname string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		wb := tx.Bucket(bucketWorkspaces).Bucket(workspaceKey(workspaceID))
+		if wb == nil {
+			return nil
+		}
+		return wb.Bucket(bucketServers).Delete([]byte(nickname))
+	})
+}
+
+func (s *BoltStore) AppendHistory(workspaceID string, entry HistoryEntry) (HistoryEntry, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		hb, err := tx.Bucket(bucketHistory).CreateBucketIfNotExists(workspaceKey(workspaceID))
+		if err != nil {
+			return err
+		}
+		if entry.ID, err = hb.NextSequence(); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return hb.Put(historyKey(entry.ID), data)
+	})
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	return entry, nil
+}
+
+func (s *BoltStore) LoadHistory(workspaceID string, server string, limit int) ([]HistoryEntry, error) {
+	var list []HistoryEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		hb := tx.Bucket(bucketHistory).Bucket(workspaceKey(workspaceID))
+		if hb == nil {
+			return nil
+		}
+
+		// Keys are big-endian IDs, so walking backwards is newest first
+		c := hb.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var entry HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if server != "" && entry.Server != server {
+				continue
+			}
+			list = append(list, entry)
+			if limit > 0 && len(list) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *BoltStore) TrimHistory(workspaceID string, keep int, cutoff time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		hb := tx.Bucket(bucketHistory).Bucket(workspaceKey(workspaceID))
+		if hb == nil {
+			return nil
+		}
+
+		var entries []HistoryEntry
+		err := hb.ForEach(func(_, v []byte) error {
+			var entry HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Delete after iterating; bbolt cursors skip keys deleted mid-walk
+		dropped := len(entries) - len(keepHistory(entries, keep, cutoff))
+		for _, entry := range entries[:dropped] {
+			if err := hb.Delete(historyKey(entry.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) LoadMembers() ([]Member, error) {
+	members := make(map[int64]Member)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMembers).ForEach(func(_, v []byte) error {
+			var m Member
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			members[m.UserID] = m
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortedMembers(members), nil
+}
+
+func (s *BoltStore) UpsertMember(member Member) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(member)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketMembers).Put(userKey(member.UserID), data)
+	})
+}
+
+func (s *BoltStore) DeleteMember(userID int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMembers).Delete(userKey(userID))
+	})
+}
+
+func (s *BoltStore) LoadAPITokens() ([]APIToken, error) {
+	tokens := make(map[string]APIToken)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTokens).ForEach(func(_, v []byte) error {
+			var t APIToken
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			tokens[t.ID] = t
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortedAPITokens(tokens), nil
+}
+
+func (s *BoltStore) UpsertAPIToken(token APIToken) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketTokens).Put([]byte(token.ID), data)
+	})
+}
+
+func (s *BoltStore) DeleteAPIToken(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTokens).Delete([]byte(id))
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func historyKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+func userKey(userID int64) []byte {
+	return []byte(strconv.FormatInt(userID, 10))
+}
+
+// workspaceKey names a workspace's buckets. Personal workspaces are keyed by
+// their owner's Telegram ID, the same key history used before workspaces.
+func workspaceKey(id string) []byte {
+	return []byte(id)
+}
+
+func putServers(b *bolt.Bucket, servers map[string]*ServerConfig) error {
+	for nickname, server := range servers {
+		data, err := json.Marshal(server)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(nickname), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readServers(b *bolt.Bucket) (map[string]*ServerConfig, error) {
+	servers := make(map[string]*ServerConfig)
+	if b == nil {
+		return servers, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		var server ServerConfig
+		if err := json.Unmarshal(v, &server); err != nil {
+			return err
+		}
+		servers[string(k)] = &server
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+func readUser(ub *bolt.Bucket) (*User, error) {
+	var meta userMeta
+	if err := json.Unmarshal(ub.Get(keyMeta), &meta); err != nil {
+		return nil, err
+	}
+
+	servers, err := readServers(ub.Bucket(bucketServers))
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		TelegramID:    meta.TelegramID,
+		Workspace:     meta.Workspace,
+		CurrentServer: meta.CurrentServer,
+		CreatedAt:     meta.CreatedAt,
+		Servers:       servers,
+		Freezes:       meta.Freezes,
+	}, nil
+}
+
+func readWorkspace(wb *bolt.Bucket) (*Workspace, error) {
+	var meta workspaceMeta
+	if err := json.Unmarshal(wb.Get(keyMeta), &meta); err != nil {
+		return nil, err
+	}
+
+	servers, err := readServers(wb.Bucket(bucketServers))
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{
+		ID:        meta.ID,
+		Name:      meta.Name,
+		Servers:   servers,
+		Members:   meta.Members,
+		Freezes:   meta.Freezes,
+		CreatedBy: meta.CreatedBy,
+		CreatedAt: meta.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,185 @@
+package servers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters (interactive logins as recommended by the scrypt paper)
+const (
+	saltSize = 16
+	scryptN  = 1 << 15
+	scryptR  = 8
+	scryptP  = 1
+)
+
+// keyIDSize is how many bytes of a key's fingerprint envelopes carry
+const keyIDSize = 4
+
+// ErrWrongKey means a stored token could not be decrypted with any configured key
+var ErrWrongKey = errors.New("cannot decrypt token: wrong ENCRYPTION_KEY or corrupted data")
+
+// tokenCipher encrypts tokens with AES-256-GCM under a scrypt-derived key.
+// A random salt is chosen per process for new records; keys derived for the
+// salts of existing records are cached so scrypt runs once per salt.
+type tokenCipher struct {
+	passphrase string
+	salt       []byte
+
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func newTokenCipher(passphrase string) (*tokenCipher, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return &tokenCipher{
+		passphrase: passphrase,
+		salt:       salt,
+		keys:       make(map[string][]byte),
+	}, nil
+}
+
+// keyID is a short public fingerprint of a derived key. It is taken from the
+// scrypt output, so testing a passphrase guess against it costs a full KDF run.
+func keyID(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("key-id"))
+	return hex.EncodeToString(mac.Sum(nil)[:keyIDSize])
+}
+
+// id returns the key ID of the key derived for salt
+func (tc *tokenCipher) id(salt []byte) (string, error) {
+	key, err := tc.key(salt)
+	if err != nil {
+		return "", err
+	}
+	return keyID(key), nil
+}
+
+// key returns the AES key for salt, deriving it on first use
+func (tc *tokenCipher) key(salt []byte) ([]byte, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if key, ok := tc.keys[string(salt)]; ok {
+		return key, nil
+	}
+	key, err := scrypt.Key([]byte(tc.passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	tc.keys[string(salt)] = key
+	return key, nil
+}
+
+// seal encrypts plaintext, returning the salt used and nonce||ciphertext
+func (tc *tokenCipher) seal(plaintext string) (salt, sealed []byte, err error) {
+	key, err := tc.key(tc.salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return tc.salt, gcm.Seal(nonce, nonce, []byte(plaintext), nil), nil
+}
+
+// open reverses seal; authentication failures are reported as ErrWrongKey
+func (tc *tokenCipher) open(salt, sealed []byte) (string, error) {
+	key, err := tc.key(salt)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrWrongKey
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// legacyKey reproduces the original zero-padded/truncated passphrase key
+func legacyKey(passphrase string) []byte {
+	key := make([]byte, 32)
+	copy(key, passphrase)
+	return key
+}
+
+// decryptLegacy reads records written by the original AES-CFB implementation.
+// CFB is unauthenticated, so a wrong key is detected by the plaintext not
+// looking like a token.
+func decryptLegacy(key []byte, cryptoText string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(cryptoText)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ciphertext) < aes.BlockSize {
+		return "", errors.New("ciphertext too short")
+	}
+
+	iv := ciphertext[:aes.BlockSize]
+	encryptedData := ciphertext[aes.BlockSize:]
+
+	stream := cipher.NewCFBDecrypter(block, iv)
+	plaintext := make([]byte, len(encryptedData))
+	stream.XORKeyStream(plaintext, encryptedData)
+
+	if !looksLikeToken(plaintext) {
+		return "", ErrWrongKey
+	}
+	return string(plaintext), nil
+}
+
+func looksLikeToken(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+package servers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptLegacy reproduces the original AES-CFB record format
+func encryptLegacy(t *testing.T, passphrase, plaintext string) string {
+	t.Helper()
+	block, err := aes.NewCipher(legacyKey(passphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	rand.Read(ciphertext[:aes.BlockSize])
+	cipher.NewCFBEncrypter(block, ciphertext[:aes.BlockSize]).XORKeyStream(ciphertext[aes.BlockSize:], []byte(plaintext))
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+// encryptV2 reproduces the key-ID-less GCM envelope
+func encryptV2(t *testing.T, passphrase, plaintext string) string {
+	t.Helper()
+	tc, _ := newTokenCipher(passphrase)
+	salt, sealed, err := tc.seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelopeV2 + ":" + base64.StdEncoding.EncodeToString(salt) + ":" + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// encryptV3 reproduces the envelope whose key ID was hashed from the passphrase
+func encryptV3(t *testing.T, passphrase, plaintext string) string {
+	t.Helper()
+	tc, _ := newTokenCipher(passphrase)
+	salt, sealed, err := tc.seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("watchtower-masterbot/key-id:" + passphrase))
+	return strings.Join([]string{envelopeV3, hex.EncodeToString(sum[:4]),
+		base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(sealed)}, ":")
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	tc := mustKeyring(t, "correct horse battery staple")
+
+	encrypted, err := tc.encrypt("watchtower-token")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !strings.HasPrefix(encrypted, envelopeV4+":"+tc.PrimaryID()+":") {
+		t.Errorf("expected versioned envelope with key ID, got %q", encrypted)
+	}
+
+	// A fresh keyring (new process, new salt) must still read the record
+	other := mustKeyring(t, "correct horse battery staple")
+	plaintext, err := other.decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if plaintext != "watchtower-token" {
+		t.Errorf("expected round trip, got %q", plaintext)
+	}
+}
+
+func TestKeyringWrongKey(t *testing.T) {
+	tc := mustKeyring(t, "right key")
+	encrypted, _ := tc.encrypt("watchtower-token")
+
+	wrong := mustKeyring(t, "wrong key")
+	if _, err := wrong.decrypt(encrypted); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+
+	legacy := encryptLegacy(t, "right key", "watchtower-token")
+	if _, err := wrong.decrypt(legacy); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey for legacy record, got %v", err)
+	}
+
+	v2 := encryptV2(t, "right key", "watchtower-token")
+	if _, err := wrong.decrypt(v2); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey for v2 record, got %v", err)
+	}
+}
+
+func TestKeyIDRequiresKDF(t *testing.T) {
+	const passphrase = "correct horse battery staple"
+	kr := mustKeyring(t, passphrase)
+	encrypted, _ := kr.encrypt("watchtower-token")
+	parts := strings.Split(encrypted, ":")
+	salt, _ := base64.StdEncoding.DecodeString(parts[2])
+
+	// The ID is the HMAC of the scrypt output for the record's salt...
+	derived, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, derived)
+	mac.Write([]byte("key-id"))
+	if want := hex.EncodeToString(mac.Sum(nil)[:keyIDSize]); parts[1] != want {
+		t.Errorf("key ID %s is not derived from the scrypt key (want %s)", parts[1], want)
+	}
+
+	// ...so no plain hash of the passphrase reproduces it
+	for _, input := range []string{passphrase, "watchtower-masterbot/key-id:" + passphrase, passphrase + string(salt)} {
+		sum := sha256.Sum256([]byte(input))
+		if hex.EncodeToString(sum[:keyIDSize]) == parts[1] {
+			t.Errorf("key ID is a plain SHA-256 of %q", input)
+		}
+	}
+
+	// and the same passphrase yields another ID under another salt
+	if other := mustKeyring(t, passphrase); other.PrimaryID() == kr.PrimaryID() {
+		t.Error("key IDs must depend on the salt")
+	}
+}
+
+func TestKeyringDetectsTampering(t *testing.T) {
+	tc := mustKeyring(t, "key")
+	encrypted, _ := tc.encrypt("watchtower-token")
+
+	parts := strings.Split(encrypted, ":")
+	sealed, _ := base64.StdEncoding.DecodeString(parts[3])
+	sealed[len(sealed)-1] ^= 0x01
+	parts[3] = base64.StdEncoding.EncodeToString(sealed)
+
+	if _, err := tc.decrypt(strings.Join(parts, ":")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected tampered record to be rejected, got %v", err)
+	}
+}
+
+func TestManagerMigratesLegacyTokens(t *testing.T) {
+	store := NewJSONStore(filepath.Join(t.TempDir(), "servers.json"))
+	store.UpsertWorkspace(&Workspace{ID: "1", Name: PersonalWorkspaceName, Members: []int64{1}, CreatedBy: 1})
+	store.UpsertServer("1", &ServerConfig{Nickname: "home", WatchtowerURL: "https://a", Token: encryptLegacy(t, "key", "legacy-token")})
+	store.UpsertServer("1", &ServerConfig{Nickname: "vps", WatchtowerURL: "https://b", Token: encryptV3(t, "key", "v3-token")})
+	store.UpsertUser(&User{TelegramID: 1, Workspace: "1", CurrentServer: "home"})
+
+	sm, err := NewManager(mustKeyring(t, "key"), store)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	stored, _ := store.LoadWorkspaces()
+	for _, nickname := range []string{"home", "vps"} {
+		if isOutdatedFormat(stored["1"].Servers[nickname].Token) {
+			t.Errorf("expected the %s token to be re-encrypted in the store", nickname)
+		}
+	}
+
+	current, err := sm.GetCurrentServer(1)
+	if err != nil {
+		t.Fatalf("GetCurrentServer: %v", err)
+	}
+	if current.Token != "legacy-token" {
+		t.Errorf("expected migrated token to decrypt, got %q", current.Token)
+	}
+}
+
+func TestManagerReportsWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	sm, _ := NewManager(mustKeyring(t, "right key"), NewJSONStore(path))
+	sm.AddServer(1, "home", "https://a", "token")
+
+	wrong, err := NewManager(mustKeyring(t, "wrong key"), NewJSONStore(path))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if _, err := wrong.GetCurrentServer(1); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestKeyringDecryptsWithRetiredKeys(t *testing.T) {
+	old := mustKeyring(t, "old key")
+	encrypted, _ := old.encrypt("watchtower-token")
+
+	kr := mustKeyring(t, "new key", "old key")
+	if kr.isCurrent(encrypted) {
+		t.Error("record sealed by a retired key must not count as current")
+	}
+	for _, record := range []string{encrypted, encryptV3(t, "old key", "watchtower-token"), encryptV2(t, "old key", "watchtower-token"), encryptLegacy(t, "old key", "watchtower-token")} {
+		plaintext, err := kr.decrypt(record)
+		if err != nil || plaintext != "watchtower-token" {
+			t.Errorf("decrypt(%.12s...) = %q, %v", record, plaintext, err)
+		}
+	}
+}
+
+func TestManagerRotateKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	sm, _ := NewManager(mustKeyring(t, "old key"), NewJSONStore(path))
+	sm.AddServer(1, "home", "https://a", "token-a")
+	sm.AddServer(2, "vps", "https://b", "token-b")
+
+	rotated, err := NewManager(mustKeyring(t, "new key", "old key"), NewJSONStore(path))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	n, err := rotated.RotateKeys()
+	if err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rotated tokens, got %d", n)
+	}
+
+	// The old key is no longer needed once rotation is done
+	fresh, _ := NewManager(mustKeyring(t, "new key"), NewJSONStore(path))
+	current, err := fresh.GetCurrentServer(2)
+	if err != nil || current.Token != "token-b" {
+		t.Errorf("expected rotated token to decrypt with new key only, got %+v, %v", current, err)
+	}
+	if n, _ := fresh.RotateKeys(); n != 0 {
+		t.Errorf("expected second rotation to be a no-op, rewrote %d", n)
+	}
+}
+
+func TestManagerRotateKeysRequiresAllKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	sm, _ := NewManager(mustKeyring(t, "old key"), NewJSONStore(path))
+	sm.AddServer(1, "home", "https://a", "token-a")
+
+	// Retired key missing: nothing may be rewritten
+	rotated, _ := NewManager(mustKeyring(t, "new key"), NewJSONStore(path))
+	if _, err := rotated.RotateKeys(); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+	again, _ := NewManager(mustKeyring(t, "old key"), NewJSONStore(path))
+	if _, err := again.GetCurrentServer(1); err != nil {
+		t.Errorf("failed rotation must leave tokens readable with the old key: %v", err)
+	}
+}
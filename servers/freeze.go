@@ -0,0 +1,174 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrFrozen is wrapped by FrozenError when a freeze blocks an update
+	ErrFrozen         = errors.New("updates are frozen")
+	ErrFreezeNotFound = errors.New("freeze not found")
+)
+
+// Freeze blocks updates for a period, either once (Start to End) or on a
+// recurring daily window, optionally limited to certain weekdays
+type Freeze struct {
+	ID string `json:"id"`
+	// Server limits the freeze to one server; empty freezes all of them
+	Server string `json:"server,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// One-off freezes
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+
+	// Recurring freezes: Window is "HH:MM-HH:MM" in Timezone (UTC if empty)
+	// on Days (every day if empty). A window crossing midnight belongs to the
+	// day it starts on.
+	Window   string         `json:"window,omitempty"`
+	Days     []time.Weekday `json:"days,omitempty"`
+	Timezone string         `json:"timezone,omitempty"`
+
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FrozenError reports the freeze that blocked an update
+type FrozenError struct {
+	Freeze Freeze
+}
+
+func (e *FrozenError) Error() string {
+	scope := "all servers"
+	if e.Freeze.Server != "" {
+		scope = e.Freeze.Server
+	}
+	msg := fmt.Sprintf("%v: freeze %s on %s", ErrFrozen, e.Freeze.ID, scope)
+	if e.Freeze.Reason != "" {
+		msg += " (" + e.Freeze.Reason + ")"
+	}
+	return msg
+}
+
+func (e *FrozenError) Unwrap() error {
+	return ErrFrozen
+}
+
+// Recurring reports whether the freeze repeats on a daily window
+func (f Freeze) Recurring() bool {
+	return f.Window != ""
+}
+
+// Validate checks that the freeze describes a usable period
+func (f Freeze) Validate() error {
+	if f.Server != "" {
+		if err := ValidateNickname(f.Server); err != nil {
+			return err
+		}
+	}
+	if !f.Recurring() {
+		if f.Start.IsZero() || f.End.IsZero() || !f.End.After(f.Start) {
+			return errors.New("freeze needs an end after its start")
+		}
+		return nil
+	}
+
+	if _, _, err := parseDailyWindow(f.Window); err != nil {
+		return err
+	}
+	if _, err := f.location(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AppliesTo reports whether the freeze covers the named server
+func (f Freeze) AppliesTo(nickname string) bool {
+	return f.Server == "" || f.Server == nickname
+}
+
+// ActiveAt reports whether updates are frozen at t
+func (f Freeze) ActiveAt(t time.Time) bool {
+	if !f.Recurring() {
+		return !t.Before(f.Start) && t.Before(f.End)
+	}
+
+	start, end, err := parseDailyWindow(f.Window)
+	if err != nil {
+		return false
+	}
+	loc, err := f.location()
+	if err != nil {
+		return false
+	}
+
+	local := t.In(loc)
+	m := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	switch {
+	case start < end:
+		if m < start || m >= end {
+			return false
+		}
+	case m >= start:
+	case m < end:
+		// Early-morning part of a window that started the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return f.onDay(day)
+}
+
+// Expired reports whether a one-off freeze is over
+func (f Freeze) Expired(now time.Time) bool {
+	return !f.Recurring() && !now.Before(f.End)
+}
+
+func (f Freeze) onDay(day time.Weekday) bool {
+	if len(f.Days) == 0 {
+		return true
+	}
+	for _, d := range f.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Freeze) location() (*time.Location, error) {
+	if f.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", f.Timezone)
+	}
+	return loc, nil
+}
+
+// parseDailyWindow parses "HH:MM-HH:MM" into minutes since midnight
+func parseDailyWindow(window string) (int, int, error) {
+	a, b, ok := strings.Cut(window, "-")
+	start, err1 := parseHHMM(a)
+	end, err2 := parseHHMM(b)
+	if !ok || err1 != nil || err2 != nil || start == end {
+		return 0, 0, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM", window)
+	}
+	return start, end, nil
+}
+
+func parseHHMM(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,148 @@
+package servers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFreezeActiveOneOff(t *testing.T) {
+	start := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	f := Freeze{Start: start, End: start.Add(2 * time.Hour)}
+
+	cases := []struct {
+		at   time.Time
+		want bool
+	}{
+		{start.Add(-time.Minute), false},
+		{start, true},
+		{start.Add(time.Hour), true},
+		{start.Add(2 * time.Hour), false},
+	}
+	for _, c := range cases {
+		if got := f.ActiveAt(c.at); got != c.want {
+			t.Errorf("ActiveAt(%s) = %v, want %v", c.at, got, c.want)
+		}
+	}
+	if !f.Expired(start.Add(2 * time.Hour)) {
+		t.Error("expected one-off freeze to expire at its end")
+	}
+}
+
+func TestFreezeActiveRecurring(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	// Friday night into Saturday morning, Berlin time
+	f := Freeze{Window: "22:00-06:00", Days: []time.Weekday{time.Friday}, Timezone: "Europe/Berlin"}
+
+	cases := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"friday before", time.Date(2026, 5, 1, 21, 59, 0, 0, berlin), false},
+		{"friday start", time.Date(2026, 5, 1, 22, 0, 0, 0, berlin), true},
+		{"saturday early", time.Date(2026, 5, 2, 5, 59, 0, 0, berlin), true},
+		{"saturday end", time.Date(2026, 5, 2, 6, 0, 0, 0, berlin), false},
+		{"saturday night", time.Date(2026, 5, 2, 23, 0, 0, 0, berlin), false},
+		{"thursday night", time.Date(2026, 4, 30, 23, 0, 0, 0, berlin), false},
+		// 20:30 UTC is 22:30 in Berlin (CEST)
+		{"utc input", time.Date(2026, 5, 1, 20, 30, 0, 0, time.UTC), true},
+	}
+	for _, c := range cases {
+		if got := f.ActiveAt(c.at); got != c.want {
+			t.Errorf("%s: ActiveAt(%s) = %v, want %v", c.name, c.at, got, c.want)
+		}
+	}
+	if f.Expired(time.Now()) {
+		t.Error("recurring freezes never expire")
+	}
+}
+
+func TestFreezeValidate(t *testing.T) {
+	now := time.Now()
+	bad := []Freeze{
+		{},
+		{Start: now, End: now},
+		{Window: "25:00-06:00"},
+		{Window: "06:00-06:00"},
+		{Window: "22:00-06:00", Timezone: "Mars/Olympus"},
+		{Server: "bad name", Start: now, End: now.Add(time.Hour)},
+	}
+	for _, f := range bad {
+		if err := f.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", f)
+		}
+	}
+	if err := (Freeze{Window: "09:00-17:00"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestManagerFreezes(t *testing.T) {
+	sm := newTestManager(t)
+	if err := sm.AddServer(1, "home", "https://home.example", "t"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	if err := sm.AddServer(1, "vps", "https://vps.example", "t"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	now := time.Now()
+
+	if _, err := sm.AddFreeze(1, Freeze{Server: "nope", Start: now, End: now.Add(time.Hour)}); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected ErrServerNotFound, got %v", err)
+	}
+
+	f, err := sm.AddFreeze(1, Freeze{Server: "home", Start: now.Add(-time.Minute), End: now.Add(time.Hour), Reason: "release"})
+	if err != nil {
+		t.Fatalf("AddFreeze: %v", err)
+	}
+	if f.ID != "f1" {
+		t.Errorf("expected ID f1, got %q", f.ID)
+	}
+
+	err = sm.CheckUpdateAllowed(1, "home", now)
+	var frozen *FrozenError
+	if !errors.Is(err, ErrFrozen) || !errors.As(err, &frozen) || frozen.Freeze.ID != "f1" {
+		t.Fatalf("expected home to be frozen by f1, got %v", err)
+	}
+	if err := sm.CheckUpdateAllowed(1, "vps", now); err != nil {
+		t.Errorf("vps should not be frozen: %v", err)
+	}
+	if err := sm.CheckUpdateAllowed(2, "home", now); err != nil {
+		t.Errorf("other users should not be frozen: %v", err)
+	}
+
+	// A rename must not lift the freeze
+	if err := sm.RenameServer(1, "home", "lab"); err != nil {
+		t.Fatalf("RenameServer: %v", err)
+	}
+	if err := sm.CheckUpdateAllowed(1, "lab", now); !errors.Is(err, ErrFrozen) {
+		t.Errorf("expected renamed server to stay frozen, got %v", err)
+	}
+
+	global, err := sm.AddFreeze(1, Freeze{Window: "00:00-23:59"})
+	if err != nil {
+		t.Fatalf("AddFreeze: %v", err)
+	}
+	if len(sm.ListFreezes(1)) != 2 {
+		t.Fatalf("expected 2 freezes, got %+v", sm.ListFreezes(1))
+	}
+
+	if err := sm.RemoveFreeze(1, "f9"); !errors.Is(err, ErrFreezeNotFound) {
+		t.Errorf("expected ErrFreezeNotFound, got %v", err)
+	}
+	if err := sm.RemoveFreeze(1, global.ID); err != nil {
+		t.Fatalf("RemoveFreeze: %v", err)
+	}
+
+	// Removing the server drops its freezes
+	if err := sm.RemoveServer(1, "lab"); err != nil {
+		t.Fatalf("RemoveServer: %v", err)
+	}
+	if list := sm.ListFreezes(1); len(list) != 0 {
+		t.Errorf("expected no freezes left, got %+v", list)
+	}
+}
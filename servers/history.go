@@ -0,0 +1,98 @@
+package servers
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DefaultHistoryRetention is how many history entries are kept per workspace
+const DefaultHistoryRetention = 500
+
+// Sources of history entries
+const (
+	SourceManual   = "manual"   // /wt_update
+	SourceButton   = "button"   // "Update now" in the server menu
+	SourceFleet    = "fleet"    // /wt_update a,b and /wt_update_all
+	SourceSchedule = "schedule" // bot-owned schedules
+	SourceWeb      = "web"      // terminal UI
+	SourceWebhook  = "webhook"  // reports Watchtower posted on its own
+	SourceAPI      = "api"      // web API calls with an API token
+)
+
+// HistoryStatusReported marks entries received from Watchtower rather than run by the bot
+const HistoryStatusReported = "reported"
+
+// HistoryEntry records one update run or Watchtower report. Entries are
+// append-only; only retention removes them.
+type HistoryEntry struct {
+	// ID is assigned by the store and increases per workspace
+	ID     uint64 `json:"id"`
+	Server string `json:"server"`
+	Source string `json:"source"`
+	// TriggeredBy is the Telegram user who started the update, 0 if nobody did
+	TriggeredBy int64         `json:"triggered_by,omitempty"`
+	JobID       string        `json:"job_id,omitempty"`
+	Started     time.Time     `json:"started"`
+	Duration    time.Duration `json:"duration"`
+	// Status is a job state (succeeded, failed, cancelled) or "reported"
+	Status  string   `json:"status"`
+	Updated []string `json:"updated,omitempty"`
+	Failed  []string `json:"failed,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// historyRecord is one line of the JSON store's history file.
+// Lines written before workspaces carry UserID instead of Workspace.
+type historyRecord struct {
+	Workspace string `json:"workspace,omitempty"`
+	UserID    int64  `json:"user_id,omitempty"`
+	HistoryEntry
+}
+
+// workspaceID returns the record's workspace; a user's old entries belong to
+// their personal workspace
+func (r historyRecord) workspaceID() string {
+	if r.Workspace == "" {
+		return personalWorkspaceID(r.UserID)
+	}
+	return r.Workspace
+}
+
+// keepHistory returns the entries (oldest first) that survive retention:
+// at most keep of the newest ones, none older than cutoff (zero means no age limit)
+func keepHistory(entries []HistoryEntry, keep int, cutoff time.Time) []HistoryEntry {
+	first := 0
+	if keep > 0 && len(entries) > keep {
+		first = len(entries) - keep
+	}
+	for first < len(entries) && !cutoff.IsZero() && entries[first].Started.Before(cutoff) {
+		first++
+	}
+	return entries[first:]
+}
+
+// filterHistory returns up to limit entries for server (all if empty), newest first
+func filterHistory(entries []HistoryEntry, server string, limit int) []HistoryEntry {
+	var list []HistoryEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if server != "" && entries[i].Server != server {
+			continue
+		}
+		list = append(list, copyHistoryEntry(entries[i]))
+		if limit > 0 && len(list) == limit {
+			break
+		}
+	}
+	return list
+}
+
+func copyHistoryEntry(e HistoryEntry) HistoryEntry {
+	e.Updated = append([]string(nil), e.Updated...)
+	e.Failed = append([]string(nil), e.Failed...)
+	return e
+}
+
+func marshalHistoryRecord(workspaceID string, entry HistoryEntry) ([]byte, error) {
+	return json.Marshal(historyRecord{Workspace: workspaceID, HistoryEntry: entry})
+}
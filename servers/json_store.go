@@ -0,0 +1,604 @@
+package servers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of timestamped backups kept next to the JSON document
+const maxBackups = 5
+
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// JSONStore keeps every user and workspace in a single JSON document.
+// Each operation rewrites the whole file, which is fine for a handful of users
+// and keeps the on-disk format human-editable. Writes are atomic and the
+// previous versions are kept as rolling backups in a "backups" directory.
+// Documents written before workspaces, a bare map of users, are still read.
+//
+// Update history is kept separately in "<name>-history.jsonl", one record per
+// line, so recording an update only appends to that file. The access list
+// lives in "<name>-members.json" and API tokens in "<name>-tokens.json".
+type JSONStore struct {
+	path       string
+	users      map[int64]*User
+	workspaces map[string]*Workspace
+	loaded     bool
+
+	historyPath   string
+	history       map[string][]HistoryEntry // oldest first
+	historyLoaded bool
+
+	membersPath   string
+	members       map[int64]Member
+	membersLoaded bool
+
+	tokensPath   string
+	tokens       map[string]APIToken
+	tokensLoaded bool
+
+	mu sync.Mutex
+}
+
+func NewJSONStore(path string) *JSONStore {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return &JSONStore{
+		path:        path,
+		users:       make(map[int64]*User),
+		workspaces:  make(map[string]*Workspace),
+		historyPath: filepath.Join(filepath.Dir(path), base+"-history.jsonl"),
+		history:     make(map[string][]HistoryEntry),
+		membersPath: filepath.Join(filepath.Dir(path), base+"-members.json"),
+		members:     make(map[int64]Member),
+		tokensPath:  filepath.Join(filepath.Dir(path), base+"-tokens.json"),
+		tokens:      make(map[string]APIToken),
+	}
+}
+
+func (s *JSONStore) LoadUsers() (map[int64]*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	users := make(map[int64]*User, len(s.users))
+	for id, u := range s.users {
+		users[id] = copyUser(u)
+	}
+	return users, nil
+}
+
+func (s *JSONStore) LoadUser(userID int64) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (s *JSONStore) UpsertUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	c := copyUser(user)
+	if len(c.Servers) == 0 {
+		c.Servers = nil
+	}
+	if len(c.Freezes) == 0 {
+		c.Freezes = nil
+	}
+	s.users[user.TelegramID] = c
+
+	return s.flush()
+}
+
+func (s *JSONStore) LoadWorkspaces() (map[string]*Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	workspaces := make(map[string]*Workspace, len(s.workspaces))
+	for id, ws := range s.workspaces {
+		workspaces[id] = copyWorkspace(ws)
+	}
+	return workspaces, nil
+}
+
+func (s *JSONStore) UpsertWorkspace(ws *Workspace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	c := copyWorkspace(ws)
+	c.Servers = make(map[string]*ServerConfig)
+	if existing, exists := s.workspaces[ws.ID]; exists {
+		c.Servers = existing.Servers
+	}
+	s.workspaces[ws.ID] = c
+
+	return s.flush()
+}
+
+func (s *JSONStore) UpsertServer(workspaceID string, server *ServerConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	ws, exists := s.workspaces[workspaceID]
+	if !exists {
+		return ErrWorkspaceNotFound
+	}
+	ws.Servers[server.Nickname] = copyServer(server)
+
+	return s.flush()
+}
+
+func (s *JSONStore) DeleteServer(workspaceID string, nickname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	ws, exists := s.workspaces[workspaceID]
+	if !exists {
+		return nil
+	}
+	delete(ws.Servers, nickname)
+
+	return s.flush()
+}
+
+func (s *JSONStore) AppendHistory(workspaceID string, entry HistoryEntry) (HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadHistory(); err != nil {
+		return HistoryEntry{}, err
+	}
+
+	entries := s.history[workspaceID]
+	entry.ID = 1
+	if len(entries) > 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+
+	line, err := marshalHistoryRecord(workspaceID, entry)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.historyPath), 0755); err != nil {
+		return HistoryEntry{}, err
+	}
+	f, err := os.OpenFile(s.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return HistoryEntry{}, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return HistoryEntry{}, err
+	}
+	if err := f.Close(); err != nil {
+		return HistoryEntry{}, err
+	}
+
+	s.history[workspaceID] = append(entries, copyHistoryEntry(entry))
+	return entry, nil
+}
+
+func (s *JSONStore) LoadHistory(workspaceID string, server string, limit int) ([]HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadHistory(); err != nil {
+		return nil, err
+	}
+	return filterHistory(s.history[workspaceID], server, limit), nil
+}
+
+func (s *JSONStore) TrimHistory(workspaceID string, keep int, cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadHistory(); err != nil {
+		return err
+	}
+
+	entries := s.history[workspaceID]
+	kept := keepHistory(entries, keep, cutoff)
+	if len(kept) == len(entries) {
+		return nil
+	}
+	s.history[workspaceID] = kept
+	return s.rewriteHistory()
+}
+
+func (s *JSONStore) LoadMembers() ([]Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadMembers(); err != nil {
+		return nil, err
+	}
+	return sortedMembers(s.members), nil
+}
+
+func (s *JSONStore) UpsertMember(member Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadMembers(); err != nil {
+		return err
+	}
+	s.members[member.UserID] = member
+	return s.flushMembers()
+}
+
+func (s *JSONStore) DeleteMember(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadMembers(); err != nil {
+		return err
+	}
+	if _, exists := s.members[userID]; !exists {
+		return nil
+	}
+	delete(s.members, userID)
+	return s.flushMembers()
+}
+
+func (s *JSONStore) LoadAPITokens() ([]APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadTokens(); err != nil {
+		return nil, err
+	}
+	return sortedAPITokens(s.tokens), nil
+}
+
+func (s *JSONStore) UpsertAPIToken(token APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadTokens(); err != nil {
+		return err
+	}
+	s.tokens[token.ID] = copyAPIToken(token)
+	return s.flushTokens()
+}
+
+func (s *JSONStore) DeleteAPIToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadTokens(); err != nil {
+		return err
+	}
+	if _, exists := s.tokens[id]; !exists {
+		return nil
+	}
+	delete(s.tokens, id)
+	return s.flushTokens()
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// loadMembers reads the access list once (Caller must hold lock)
+func (s *JSONStore) loadMembers() error {
+	if s.membersLoaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.membersPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var list []Member
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("%s is unreadable: %w", s.membersPath, err)
+		}
+		for _, m := range list {
+			s.members[m.UserID] = m
+		}
+	}
+
+	s.membersLoaded = true
+	return nil
+}
+
+// flushMembers writes the access list to disk (Caller must hold lock)
+func (s *JSONStore) flushMembers() error {
+	data, err := json.MarshalIndent(sortedMembers(s.members), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.membersPath, data, 0600)
+}
+
+// loadTokens reads the API tokens once (Caller must hold lock)
+func (s *JSONStore) loadTokens() error {
+	if s.tokensLoaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.tokensPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var list []APIToken
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("%s is unreadable: %w", s.tokensPath, err)
+		}
+		for _, t := range list {
+			s.tokens[t.ID] = t
+		}
+	}
+
+	s.tokensLoaded = true
+	return nil
+}
+
+// flushTokens writes the API tokens to disk (Caller must hold lock)
+func (s *JSONStore) flushTokens() error {
+	data, err := json.MarshalIndent(sortedAPITokens(s.tokens), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.tokensPath, data, 0600)
+}
+
+// loadHistory reads the history file once (Caller must hold lock).
+// A torn last line from a crash mid-append is skipped rather than fatal.
+func (s *JSONStore) loadHistory() error {
+	if s.historyLoaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.historyPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var rec historyRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			log.Printf("⚠️  Skipping unreadable line %d of %s: %v", i+1, s.historyPath, err)
+			continue
+		}
+		id := rec.workspaceID()
+		s.history[id] = append(s.history[id], rec.HistoryEntry)
+	}
+
+	s.historyLoaded = true
+	return nil
+}
+
+// rewriteHistory replaces the history file with the in-memory entries (Caller must hold lock)
+func (s *JSONStore) rewriteHistory() error {
+	ids := make([]string, 0, len(s.history))
+	for id := range s.history {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var buf []byte
+	for _, id := range ids {
+		for _, entry := range s.history[id] {
+			line, err := marshalHistoryRecord(id, entry)
+			if err != nil {
+				return err
+			}
+			buf = append(append(buf, line...), '\n')
+		}
+	}
+	return writeFileAtomic(s.historyPath, buf, 0600)
+}
+
+// load reads the file once, falling back to the newest valid backup when the
+// primary document doesn't parse. I/O errors are returned as they are: the
+// file may be intact, and replacing it with a backup would lose data.
+// (Caller must hold lock)
+func (s *JSONStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	doc, err := readDocument(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.loaded = true
+			return nil // No data yet, start fresh
+		}
+		if !errors.Is(err, errCorruptDocument) {
+			return fmt.Errorf("reading %s: %w", s.path, err)
+		}
+
+		recovered, backup, rerr := s.recover()
+		if rerr != nil {
+			return fmt.Errorf("%s is corrupt (%v) and no valid backup was found: %w", s.path, err, rerr)
+		}
+		log.Printf("⚠️  %s is corrupt (%v), recovered from backup %s", s.path, err, backup)
+
+		// Keep the damaged file around for inspection instead of overwriting it
+		corrupt := s.path + ".corrupt-" + time.Now().UTC().Format(backupTimeFormat)
+		if err := os.Rename(s.path, corrupt); err != nil {
+			return err
+		}
+		doc = recovered
+	}
+
+	s.users = doc.Users
+	s.workspaces = doc.Workspaces
+	s.loaded = true
+	return nil
+}
+
+// recover returns the contents of the newest backup that parses
+func (s *JSONStore) recover() (*jsonDocument, string, error) {
+	backups, err := s.listBackups()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := len(backups) - 1; i >= 0; i-- {
+		doc, err := readDocument(backups[i])
+		if err != nil {
+			log.Printf("⚠️  Skipping invalid backup %s: %v", backups[i], err)
+			continue
+		}
+		return doc, backups[i], nil
+	}
+	return nil, "", os.ErrNotExist
+}
+
+// flush writes the whole document to disk (Caller must hold lock)
+func (s *JSONStore) flush() error {
+	data, err := json.MarshalIndent(jsonDocument{Users: s.users, Workspaces: s.workspaces}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := s.backup(); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, data, 0600)
+}
+
+func (s *JSONStore) backupDir() string {
+	return filepath.Join(filepath.Dir(s.path), "backups")
+}
+
+// backup copies the current document into the backup directory and prunes
+// the oldest copies beyond maxBackups
+func (s *JSONStore) backup() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path))
+	name := fmt.Sprintf("%s-%s%s", base, time.Now().UTC().Format(backupTimeFormat), filepath.Ext(s.path))
+	if err := writeFileAtomic(filepath.Join(s.backupDir(), name), data, 0600); err != nil {
+		return err
+	}
+
+	backups, err := s.listBackups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// listBackups returns backup paths ordered oldest first
+func (s *JSONStore) listBackups() ([]string, error) {
+	base := strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path))
+	matches, err := filepath.Glob(filepath.Join(s.backupDir(), base+"-*"+filepath.Ext(s.path)))
+	if err != nil {
+		return nil, err
+	}
+	// Timestamps are fixed-width UTC, so lexical order is chronological
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// jsonDocument is the layout of the JSON file
+type jsonDocument struct {
+	Users      map[int64]*User       `json:"users"`
+	Workspaces map[string]*Workspace `json:"workspaces"`
+}
+
+// errCorruptDocument marks a document that was read but doesn't parse
+var errCorruptDocument = errors.New("corrupt JSON document")
+
+// readDocument returns I/O errors as they are and wraps parse errors in
+// errCorruptDocument
+func readDocument(path string) (*jsonDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("%w: %w", errCorruptDocument, err)
+	}
+
+	doc := &jsonDocument{}
+	_, hasUsers := top["users"]
+	_, hasWorkspaces := top["workspaces"]
+	if hasUsers || hasWorkspaces || len(top) == 0 {
+		if err := json.Unmarshal(data, doc); err != nil {
+			return nil, fmt.Errorf("%w: %w", errCorruptDocument, err)
+		}
+	} else if err := json.Unmarshal(data, &doc.Users); err != nil {
+		// Keyed by Telegram ID: the document predates workspaces
+		return nil, fmt.Errorf("%w: %w", errCorruptDocument, err)
+	}
+
+	if doc.Users == nil {
+		doc.Users = make(map[int64]*User)
+	}
+	if doc.Workspaces == nil {
+		doc.Workspaces = make(map[string]*Workspace)
+	}
+	for _, ws := range doc.Workspaces {
+		if ws.Servers == nil {
+			ws.Servers = make(map[string]*ServerConfig)
+		}
+	}
+	return doc, nil
+}
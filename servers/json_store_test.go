@@ -0,0 +1,120 @@
+package servers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONStoreKeepsRollingBackups(t *testing.T) {
+	dir := t.TempDir()
+	s := NewJSONStore(filepath.Join(dir, "servers.json"))
+
+	for i := 0; i < maxBackups+3; i++ {
+		if err := s.UpsertUser(&User{TelegramID: 1, CurrentServer: strings.Repeat("x", i)}); err != nil {
+			t.Fatalf("UpsertUser: %v", err)
+		}
+	}
+
+	backups, err := s.listBackups()
+	if err != nil {
+		t.Fatalf("listBackups: %v", err)
+	}
+	if len(backups) != maxBackups {
+		t.Errorf("expected %d backups, got %d", maxBackups, len(backups))
+	}
+
+	// No temp files may be left behind by atomic writes
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("leftover temp file %s", e.Name())
+		}
+	}
+}
+
+func TestJSONStoreRecoversFromNewestValidBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "servers.json")
+
+	s := NewJSONStore(path)
+	s.UpsertWorkspace(&Workspace{ID: "1", Name: PersonalWorkspaceName})
+	s.UpsertServer("1", &ServerConfig{Nickname: "home", Token: "first"})
+	s.UpsertServer("1", &ServerConfig{Nickname: "home", Token: "second"})
+	s.UpsertServer("1", &ServerConfig{Nickname: "home", Token: "third"})
+
+	// Corrupt the newest backup and the primary document
+	backups, _ := s.listBackups()
+	if len(backups) != 3 {
+		t.Fatalf("expected 3 backups, got %d", len(backups))
+	}
+	os.WriteFile(backups[2], []byte("{garbage"), 0600)
+	os.WriteFile(path, []byte(`{"workspaces": {"1": {"servers": {"home": `), 0600)
+
+	workspaces, err := NewJSONStore(path).LoadWorkspaces()
+	if err != nil {
+		t.Fatalf("LoadWorkspaces after corruption: %v", err)
+	}
+	if got := workspaces["1"].Servers["home"].Token; got != "first" {
+		t.Errorf("expected recovery from newest valid backup (token first), got %q", got)
+	}
+
+	corrupt, _ := filepath.Glob(path + ".corrupt-*")
+	if len(corrupt) != 1 {
+		t.Errorf("expected the damaged primary to be preserved, found %v", corrupt)
+	}
+}
+
+func TestJSONStoreFailsWithoutValidBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	os.WriteFile(path, []byte("not json"), 0600)
+
+	if _, err := NewManager(mustKeyring(t, "key"), NewJSONStore(path)); err == nil {
+		t.Error("expected NewManager to fail on unreadable data without backups")
+	}
+}
+
+func TestJSONStoreKeepsPrimaryOnReadError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "servers.json")
+
+	s := NewJSONStore(path)
+	s.UpsertWorkspace(&Workspace{ID: "1", Name: PersonalWorkspaceName})
+	s.UpsertServer("1", &ServerConfig{Nickname: "home", Token: "first"})
+	s.UpsertServer("1", &ServerConfig{Nickname: "home", Token: "second"})
+
+	// Swap the primary for a directory: reading it fails with EISDIR, an I/O
+	// error that, unlike permission bits, also holds when tests run as root
+	intact := path + ".intact"
+	if err := os.Rename(path, intact); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	if _, err := NewJSONStore(path).LoadWorkspaces(); err == nil {
+		t.Fatal("expected an I/O error to be returned, not recovered from a backup")
+	}
+	if corrupt, _ := filepath.Glob(path + ".corrupt-*"); len(corrupt) != 0 {
+		t.Errorf("an unreadable primary must not be moved aside: %v", corrupt)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		t.Errorf("the primary path was touched: %v, %v", info, err)
+	}
+}
+
+func TestJSONStoreReadsPreWorkspaceDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	legacy := `{"1": {"telegram_id": 1, "current_server": "home", "servers": {"home": {"nickname": "home", "token": "t"}}}}`
+	os.WriteFile(path, []byte(legacy), 0600)
+
+	user, err := NewJSONStore(path).LoadUser(1)
+	if err != nil {
+		t.Fatalf("LoadUser: %v", err)
+	}
+	if user.CurrentServer != "home" || user.Servers["home"] == nil || user.Servers["home"].Token != "t" {
+		t.Errorf("legacy user not read: %+v", user)
+	}
+}
@@ -0,0 +1,171 @@
+package servers
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ciphertext envelopes, oldest first:
+//
+//	<base64 iv||cfb>                      legacy AES-CFB, zero-padded key
+//	v2:<base64 salt>:<base64 sealed>      AES-GCM, scrypt key, no key ID
+//	v3:<key id>:<base64 salt>:<base64 sealed>  key ID hashed from the passphrase
+//	v4:<key id>:<base64 salt>:<base64 sealed>  key ID derived from the scrypt key
+//
+// v3 key IDs let anyone holding the store test passphrase guesses at SHA-256
+// speed; such records are decrypted by trying every key and rewritten as v4.
+const (
+	envelopeV2 = "v2"
+	envelopeV3 = "v3"
+	envelopeV4 = "v4"
+)
+
+// Keyring holds the primary encryption key plus retired keys.
+// Tokens are always encrypted with the primary key; any key can decrypt.
+type Keyring struct {
+	primary   *tokenCipher
+	primaryID string
+	ordered   []*tokenCipher
+}
+
+// NewKeyring builds a keyring from the primary passphrase and any retired ones
+func NewKeyring(primary string, retired ...string) (*Keyring, error) {
+	if primary == "" {
+		return nil, errors.New("primary encryption key is empty")
+	}
+
+	kr := &Keyring{}
+	seen := make(map[string]bool)
+	for _, passphrase := range append([]string{primary}, retired...) {
+		if passphrase == "" || seen[passphrase] {
+			continue
+		}
+		seen[passphrase] = true
+		tc, err := newTokenCipher(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		kr.ordered = append(kr.ordered, tc)
+	}
+	kr.primary = kr.ordered[0]
+
+	// Derives the primary key for this process's salt up front
+	id, err := kr.primary.id(kr.primary.salt)
+	if err != nil {
+		return nil, err
+	}
+	kr.primaryID = id
+	return kr, nil
+}
+
+// PrimaryID returns the key ID new records are written with. The ID depends
+// on the salt too, so it differs between processes.
+func (kr *Keyring) PrimaryID() string {
+	return kr.primaryID
+}
+
+func (kr *Keyring) encrypt(plaintext string) (string, error) {
+	salt, sealed, err := kr.primary.seal(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		envelopeV4,
+		kr.primaryID,
+		base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(sealed),
+	}, ":"), nil
+}
+
+func (kr *Keyring) decrypt(cryptoText string) (string, error) {
+	parts := strings.Split(cryptoText, ":")
+
+	switch {
+	case len(parts) == 1:
+		for _, tc := range kr.ordered {
+			if plaintext, err := decryptLegacy(legacyKey(tc.passphrase), cryptoText); err == nil {
+				return plaintext, nil
+			} else if !errors.Is(err, ErrWrongKey) {
+				return "", err
+			}
+		}
+		return "", ErrWrongKey
+
+	case len(parts) == 3 && parts[0] == envelopeV2,
+		len(parts) == 4 && parts[0] == envelopeV3:
+		// v3 key IDs are not trusted; the first key that opens the record wins
+		salt, sealed, err := decodeSealed(parts[len(parts)-2], parts[len(parts)-1])
+		if err != nil {
+			return "", err
+		}
+		for _, tc := range kr.ordered {
+			if plaintext, err := tc.open(salt, sealed); err == nil {
+				return plaintext, nil
+			}
+		}
+		return "", ErrWrongKey
+
+	case len(parts) == 4 && parts[0] == envelopeV4:
+		salt, sealed, err := decodeSealed(parts[2], parts[3])
+		if err != nil {
+			return "", err
+		}
+		tc, err := kr.keyFor(parts[1], salt)
+		if err != nil {
+			return "", err
+		}
+		return tc.open(salt, sealed)
+
+	default:
+		return "", errors.New("unsupported ciphertext envelope")
+	}
+}
+
+// keyFor finds the key whose ID for salt is id
+func (kr *Keyring) keyFor(id string, salt []byte) (*tokenCipher, error) {
+	for _, tc := range kr.ordered {
+		tcID, err := tc.id(salt)
+		if err != nil {
+			return nil, err
+		}
+		if hmac.Equal([]byte(tcID), []byte(id)) {
+			return tc, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: key %s is not in the keyring", ErrWrongKey, id)
+}
+
+// isCurrent reports whether a record is in the latest envelope under the primary key
+func (kr *Keyring) isCurrent(cryptoText string) bool {
+	parts := strings.Split(cryptoText, ":")
+	if len(parts) != 4 || parts[0] != envelopeV4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	id, err := kr.primary.id(salt)
+	return err == nil && id == parts[1]
+}
+
+// isOutdatedFormat reports whether a record predates the current envelope
+func isOutdatedFormat(cryptoText string) bool {
+	return !strings.HasPrefix(cryptoText, envelopeV4+":")
+}
+
+func decodeSealed(saltB64, sealedB64 string) ([]byte, []byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(saltB64)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(sealedB64)
+	if err != nil {
+		return nil, nil, err
+	}
+	return salt, sealed, nil
+}
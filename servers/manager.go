@@ -1,56 +1,103 @@
 package servers
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
-	"encoding/base64"
-	"encoding/json"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
-	"io"
-	"os"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/kfilin/watchtower-masterbot/internal/api"
 )
 
+var (
+	ErrServerNotFound = errors.New("server not found")
+	ErrServerExists   = errors.New("server with this nickname already exists")
+	ErrInvalidName    = errors.New("nickname must be 1-32 characters: letters, digits, '-', '_' or '.'")
+	ErrInvalidURL     = errors.New("URL must be an absolute http(s) URL with a host")
+	ErrNoSchedule     = errors.New("server has no update schedule")
+	ErrHookDenied     = errors.New("unknown webhook or wrong secret")
+	ErrMemberNotFound = errors.New("user is not on the access list")
+)
+
+var nicknamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
 type ServerManager struct {
-	users map[int64]*User
-	mu    sync.RWMutex
-	key   []byte
+	users      map[int64]*User
+	workspaces map[string]*Workspace
+	store      Store
+	mu         sync.RWMutex
+	keys       *Keyring
+
+	// History retention, see SetHistoryRetention
+	historyKeep   int
+	historyMaxAge time.Duration
+
+	// members is the access list, see the access package
+	members map[int64]Member
+	// tokens are the API tokens by ID
+	tokens map[string]*APIToken
 }
 
-func NewManager(encryptionKey string) *ServerManager {
-	key := deriveKey(encryptionKey)
+func NewManager(keys *Keyring, store Store) (*ServerManager, error) {
 	sm := &ServerManager{
-		users: make(map[int64]*User),
-		key:   key,
+		users:       make(map[int64]*User),
+		workspaces:  make(map[string]*Workspace),
+		store:       store,
+		keys:        keys,
+		historyKeep: DefaultHistoryRetention,
+	}
+
+	// Refuse to start on unreadable data rather than silently
+	// starting empty and overwriting it on the next save
+	if err := sm.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load servers: %w", err)
 	}
 
-	// Attempt to load existing data
-	// Ignoring error for now as it just starts empty
-	_ = sm.Load()
+	return sm, nil
+}
+
+// ValidateNickname reports whether nickname can be used for a server
+func ValidateNickname(nickname string) error {
+	if !nicknamePattern.MatchString(nickname) {
+		return ErrInvalidName
+	}
+	return nil
+}
 
-	return sm
+// ValidateURL reports whether raw can be used as a Watchtower or agent endpoint
+func ValidateURL(raw string) error {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
 }
 
 func (sm *ServerManager) AddServer(userID int64, nickname, watchtowerURL, token string) error {
+	if err := ValidateNickname(nickname); err != nil {
+		return err
+	}
+	if err := ValidateURL(watchtowerURL); err != nil {
+		return err
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	user, exists := sm.users[userID]
-	if !exists {
-		user = &User{
-			TelegramID: userID,
-			Servers:    make(map[string]*ServerConfig),
-			CreatedAt:  time.Now(),
-		}
-		sm.users[userID] = user
+	ws, err := sm.ensureWorkspace(userID)
+	if err != nil {
+		return err
 	}
-
-	if _, exists := user.Servers[nickname]; exists {
-		return errors.New("server with this nickname already exists")
+	if _, exists := ws.Servers[nickname]; exists {
+		return ErrServerExists
 	}
 
 	encryptedToken, err := sm.encryptToken(token)
@@ -58,7 +105,7 @@ func (sm *ServerManager) AddServer(userID int64, nickname, watchtowerURL, token
 		return err
 	}
 
-	user.Servers[nickname] = &ServerConfig{
+	server := &ServerConfig{
 		Nickname:      nickname,
 		WatchtowerURL: watchtowerURL,
 		Token:         encryptedToken,
@@ -66,15 +113,14 @@ func (sm *ServerManager) AddServer(userID int64, nickname, watchtowerURL, token
 		IsActive:      true,
 	}
 
-	if user.CurrentServer == "" {
-		user.CurrentServer = nickname
-	}
-
-	// Auto-save
-	if err := sm.saveToFile(); err != nil {
+	if err := sm.store.UpsertServer(ws.ID, server); err != nil {
 		return err
 	}
+	ws.Servers[nickname] = server
 
+	if sm.selectedServer(userID, ws) == "" {
+		return sm.setCurrent(userID, ws, nickname)
+	}
 	return nil
 }
 
@@ -82,172 +128,780 @@ func (sm *ServerManager) GetCurrentServer(userID int64) (*ServerConfig, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	user, exists := sm.users[userID]
-	if !exists || user.CurrentServer == "" {
+	ws := sm.activeWorkspace(userID)
+	if ws == nil {
+		return nil, errors.New("no servers configured")
+	}
+	current := sm.currentServer(userID, ws)
+	if current == "" {
 		return nil, errors.New("no servers configured")
 	}
 
-	server, exists := user.Servers[user.CurrentServer]
-	if !exists {
-		return nil, errors.New("current server not found")
+	return sm.decrypted(ws.Servers[current])
+}
+
+// GetServer returns one of the user's servers with its token decrypted
+func (sm *ServerManager) GetServer(userID int64, nickname string) (*ServerConfig, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ws, err := sm.lookupServer(userID, nickname)
+	if err != nil {
+		return nil, err
 	}
 
+	return sm.decrypted(ws.Servers[nickname])
+}
+
+// decrypted returns a copy of server with a plaintext token (Caller must hold lock)
+func (sm *ServerManager) decrypted(server *ServerConfig) (*ServerConfig, error) {
 	decryptedToken, err := sm.decryptToken(server.Token)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("server %s: %w", server.Nickname, err)
 	}
 
-	return &ServerConfig{
-		Nickname:      server.Nickname,
-		WatchtowerURL: server.WatchtowerURL,
-		Token:         decryptedToken,
-		CreatedAt:     server.CreatedAt,
-		IsActive:      server.IsActive,
-	}, nil
+	plain := copyServer(server)
+	plain.Token = decryptedToken
+	return plain, nil
 }
 
 func (sm *ServerManager) SwitchServer(userID int64, nickname string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	user, exists := sm.users[userID]
-	if !exists {
-		return errors.New("user not found")
-	}
-
-	if _, exists := user.Servers[nickname]; !exists {
-		return errors.New("server not found")
+	ws, err := sm.lookupServer(userID, nickname)
+	if err != nil {
+		return err
 	}
 
-	user.CurrentServer = nickname
-
-	// Auto-save
-	return sm.saveToFile()
+	return sm.setCurrent(userID, ws, nickname)
 }
 
 func (sm *ServerManager) ListServers(userID int64) ([]string, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	user, exists := sm.users[userID]
-	if !exists {
+	ws := sm.activeWorkspace(userID)
+	if ws == nil {
 		return nil, errors.New("no servers configured")
 	}
 
-	servers := make([]string, 0, len(user.Servers))
-	for nickname := range user.Servers {
-		servers = append(servers, nickname)
+	return serverNames(ws), nil
+}
+
+// RemoveServer deletes a server from the user's workspace. Members who had it
+// active switch to the first remaining server (alphabetically).
+func (sm *ServerManager) RemoveServer(userID int64, nickname string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws, err := sm.lookupServer(userID, nickname)
+	if err != nil {
+		return err
+	}
+
+	if err := sm.store.DeleteServer(ws.ID, nickname); err != nil {
+		return err
+	}
+	delete(ws.Servers, nickname)
+
+	// Drop the server's own freezes and token scopes so they don't catch a
+	// future server of the same name
+	var kept []Freeze
+	for _, f := range ws.Freezes {
+		if f.Server != nickname {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) != len(ws.Freezes) {
+		if err := sm.setFreezes(ws, kept); err != nil {
+			return err
+		}
+	}
+	if err := sm.retargetAPITokens(ws, nickname, ""); err != nil {
+		return err
 	}
 
-	return servers, nil
+	next := ""
+	if names := serverNames(ws); len(names) > 0 {
+		next = names[0]
+	}
+	return sm.retargetCurrent(ws, nickname, next)
 }
 
-// GetAPIClient returns a Watchtower API client for the user's current server
-func (sm *ServerManager) GetAPIClient(userID int64) (*api.WatchtowerClient, error) {
-	server, err := sm.GetCurrentServer(userID)
+// RenameServer changes a server's nickname, keeping it active if it was
+func (sm *ServerManager) RenameServer(userID int64, oldName, newName string) error {
+	if err := ValidateNickname(newName); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws, err := sm.lookupServer(userID, oldName)
+	if err != nil {
+		return err
+	}
+	if _, exists := ws.Servers[newName]; exists {
+		return ErrServerExists
+	}
+
+	renamed := copyServer(ws.Servers[oldName])
+	renamed.Nickname = newName
+
+	// Write the new record first so a failure never loses the server
+	if err := sm.store.UpsertServer(ws.ID, renamed); err != nil {
+		return err
+	}
+	ws.Servers[newName] = renamed
+
+	if err := sm.retargetCurrent(ws, oldName, newName); err != nil {
+		return err
+	}
+
+	// Carry server freezes over so a rename can't lift them
+	retargeted := false
+	freezes := copyFreezes(ws.Freezes)
+	for i := range freezes {
+		if freezes[i].Server == oldName {
+			freezes[i].Server = newName
+			retargeted = true
+		}
+	}
+	if retargeted {
+		if err := sm.setFreezes(ws, freezes); err != nil {
+			return err
+		}
+	}
+	if err := sm.retargetAPITokens(ws, oldName, newName); err != nil {
+		return err
+	}
+
+	if err := sm.store.DeleteServer(ws.ID, oldName); err != nil {
+		return err
+	}
+	delete(ws.Servers, oldName)
+
+	return nil
+}
+
+// UpdateServerURL changes the Watchtower endpoint of a server
+func (sm *ServerManager) UpdateServerURL(userID int64, nickname, watchtowerURL string) error {
+	if err := ValidateURL(watchtowerURL); err != nil {
+		return err
+	}
+	return sm.updateServer(userID, nickname, func(s *ServerConfig) error {
+		s.WatchtowerURL = watchtowerURL
+		return nil
+	})
+}
+
+// UpdateServerAgentURL sets (or clears, with "") the Docker agent endpoint
+func (sm *ServerManager) UpdateServerAgentURL(userID int64, nickname, agentURL string) error {
+	if agentURL != "" {
+		if err := ValidateURL(agentURL); err != nil {
+			return err
+		}
+	}
+	return sm.updateServer(userID, nickname, func(s *ServerConfig) error {
+		s.AgentURL = agentURL
+		return nil
+	})
+}
+
+// UpdateServerToken replaces the (encrypted) Watchtower token of a server
+func (sm *ServerManager) UpdateServerToken(userID int64, nickname, token string) error {
+	return sm.updateServer(userID, nickname, func(s *ServerConfig) error {
+		encryptedToken, err := sm.encryptToken(token)
+		if err != nil {
+			return err
+		}
+		s.Token = encryptedToken
+		return nil
+	})
+}
+
+// RecordMetrics stores snap as the server's latest metrics snapshot and
+// returns the one it replaces (nil the first time)
+func (sm *ServerManager) RecordMetrics(userID int64, nickname string, snap MetricsSnapshot) (*MetricsSnapshot, error) {
+	var previous *MetricsSnapshot
+	err := sm.updateServer(userID, nickname, func(s *ServerConfig) error {
+		previous = s.LastMetrics
+		s.LastMetrics = &snap
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return previous, nil
+}
 
-	return api.NewWatchtowerClient(server.WatchtowerURL, server.Token), nil
+// SetSchedule replaces the server's update schedule; nil clears it.
+// The schedule runs as userID.
+func (sm *ServerManager) SetSchedule(userID int64, nickname string, schedule *UpdateSchedule) error {
+	return sm.updateServer(userID, nickname, func(s *ServerConfig) error {
+		if schedule == nil {
+			s.Schedule = nil
+			return nil
+		}
+		sched := *schedule
+		sched.Owner = userID
+		s.Schedule = &sched
+		return nil
+	})
 }
 
-// FIXED: Using modern CFB encryption without deprecated functions
-func (sm *ServerManager) encryptToken(plaintext string) (string, error) {
-	block, err := aes.NewCipher(sm.key)
+// RecordScheduleRun stores when a schedule last fired and when it fires next.
+// A zero lastRun keeps the previous value.
+func (sm *ServerManager) RecordScheduleRun(workspaceID string, nickname string, lastRun, nextRun time.Time) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws := sm.workspaces[workspaceID]
+	if ws == nil {
+		return ErrServerNotFound
+	}
+	return sm.mutateServer(ws, nickname, func(s *ServerConfig) error {
+		if s.Schedule == nil {
+			return ErrNoSchedule
+		}
+		if !lastRun.IsZero() {
+			s.Schedule.LastRun = lastRun
+		}
+		s.Schedule.NextRun = nextRun
+		return nil
+	})
+}
+
+// ScheduledServers returns every server that has a schedule, across all workspaces
+func (sm *ServerManager) ScheduledServers() []ScheduledServer {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var list []ScheduledServer
+	for id, ws := range sm.workspaces {
+		for nickname, server := range ws.Servers {
+			if server.Schedule == nil {
+				continue
+			}
+			list = append(list, ScheduledServer{Workspace: id, UserID: scheduleOwner(ws, server.Schedule), Nickname: nickname, Schedule: *server.Schedule})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Workspace != list[j].Workspace {
+			return list[i].Workspace < list[j].Workspace
+		}
+		return list[i].Nickname < list[j].Nickname
+	})
+	return list
+}
+
+// scheduleOwner is the user a schedule runs as: its owner, or for schedules
+// set before owners were recorded, the workspace's creator
+func scheduleOwner(ws *Workspace, schedule *UpdateSchedule) int64 {
+	if schedule.Owner != 0 {
+		return schedule.Owner
+	}
+	return ws.CreatedBy
+}
+
+// AddFreeze stores a new freeze in userID's workspace and returns it with its
+// ID set. One-off freezes that have already ended are pruned at the same time.
+func (sm *ServerManager) AddFreeze(userID int64, freeze Freeze) (Freeze, error) {
+	if err := freeze.Validate(); err != nil {
+		return Freeze{}, err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws, err := sm.ensureWorkspace(userID)
 	if err != nil {
-		return "", err
+		return Freeze{}, err
+	}
+	if freeze.Server != "" && ws.Servers[freeze.Server] == nil {
+		return Freeze{}, ErrServerNotFound
 	}
 
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return "", err
+	now := time.Now()
+	var existing []Freeze
+	for _, f := range ws.Freezes {
+		if !f.Expired(now) {
+			existing = append(existing, f)
+		}
 	}
 
-	// Modern CFB encryption - create new buffer for encrypted data
-	stream := cipher.NewCFBEncrypter(block, iv)
-	plaintextBytes := []byte(plaintext)
-	encryptedData := make([]byte, len(plaintextBytes))
-	stream.XORKeyStream(encryptedData, plaintextBytes)
+	freeze.ID = newFreezeID(existing)
+	freeze.CreatedAt = now
+	freezes := append(existing, freeze)
+	if err := sm.setFreezes(ws, freezes); err != nil {
+		return Freeze{}, err
+	}
+	return freeze, nil
+}
 
-	// Combine IV and encrypted data
-	copy(ciphertext[aes.BlockSize:], encryptedData)
+// RemoveFreeze deletes one of the freezes of userID's workspace by ID
+func (sm *ServerManager) RemoveFreeze(userID int64, id string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	ws := sm.activeWorkspace(userID)
+	if ws == nil {
+		return ErrFreezeNotFound
+	}
+	for i, f := range ws.Freezes {
+		if f.ID == id {
+			freezes := append(append([]Freeze(nil), ws.Freezes[:i]...), ws.Freezes[i+1:]...)
+			return sm.setFreezes(ws, freezes)
+		}
+	}
+	return ErrFreezeNotFound
 }
 
-// FIXED: Using modern CFB decryption without deprecated functions
-func (sm *ServerManager) decryptToken(cryptoText string) (string, error) {
-	ciphertext, err := base64.StdEncoding.DecodeString(cryptoText)
+// ListFreezes returns the freezes of userID's workspace that have not ended yet
+func (sm *ServerManager) ListFreezes(userID int64) []Freeze {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ws := sm.activeWorkspace(userID)
+	if ws == nil {
+		return nil
+	}
+	now := time.Now()
+	var list []Freeze
+	for _, f := range copyFreezes(ws.Freezes) {
+		if !f.Expired(now) {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// CheckUpdateAllowed is the single policy check for starting an update on one
+// of userID's servers. It returns a *FrozenError (matching ErrFrozen) if a
+// freeze is active.
+func (sm *ServerManager) CheckUpdateAllowed(userID int64, nickname string, now time.Time) error {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return checkFreezes(sm.activeWorkspace(userID), nickname, now)
+}
+
+// CheckUpdateAllowedIn is CheckUpdateAllowed for a server of a given workspace
+func (sm *ServerManager) CheckUpdateAllowedIn(workspaceID string, nickname string, now time.Time) error {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return checkFreezes(sm.workspaces[workspaceID], nickname, now)
+}
+
+func checkFreezes(ws *Workspace, nickname string, now time.Time) error {
+	if ws == nil {
+		return nil
+	}
+	for _, f := range ws.Freezes {
+		if f.AppliesTo(nickname) && f.ActiveAt(now) {
+			return &FrozenError{Freeze: f}
+		}
+	}
+	return nil
+}
+
+// EnableHook gives a server a webhook ID (kept if it already has one) and a
+// new secret, which is returned once and only stored as a hash
+func (sm *ServerManager) EnableHook(userID int64, nickname string) (id, secret string, err error) {
+	secret, err = randomHex(24)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	block, err := aes.NewCipher(sm.key)
+	err = sm.updateServer(userID, nickname, func(s *ServerConfig) error {
+		if s.HookID == "" {
+			hookID, err := randomHex(8)
+			if err != nil {
+				return err
+			}
+			s.HookID = hookID
+		}
+		s.HookSecretHash = hashSecret(secret)
+		id = s.HookID
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	return id, secret, nil
+}
+
+// DisableHook removes a server's webhook ID and secret
+func (sm *ServerManager) DisableHook(userID int64, nickname string) error {
+	return sm.updateServer(userID, nickname, func(s *ServerConfig) error {
+		s.HookID = ""
+		s.HookSecretHash = ""
+		return nil
+	})
+}
+
+// VerifyHook resolves a webhook ID to its workspace and server. Unknown IDs
+// and wrong secrets both return ErrHookDenied so callers can't tell them apart.
+func (sm *ServerManager) VerifyHook(id, secret string) (string, string, error) {
+	if id == "" || secret == "" {
+		return "", "", ErrHookDenied
 	}
+	given := hashSecret(secret)
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 
-	if len(ciphertext) < aes.BlockSize {
-		return "", errors.New("ciphertext too short")
+	for workspaceID, ws := range sm.workspaces {
+		for nickname, s := range ws.Servers {
+			if s.HookID != id {
+				continue
+			}
+			if subtle.ConstantTimeCompare([]byte(given), []byte(s.HookSecretHash)) != 1 {
+				return "", "", ErrHookDenied
+			}
+			return workspaceID, nickname, nil
+		}
 	}
+	return "", "", ErrHookDenied
+}
 
-	iv := ciphertext[:aes.BlockSize]
-	encryptedData := ciphertext[aes.BlockSize:]
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
 
-	// Modern CFB decryption - create new buffer for decrypted data
-	stream := cipher.NewCFBDecrypter(block, iv)
-	plaintext := make([]byte, len(encryptedData))
-	stream.XORKeyStream(plaintext, encryptedData)
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
 
-	return string(plaintext), nil
+// SetHistoryRetention limits each workspace's history to the newest keep entries
+// and drops entries older than maxAge; zero disables the respective limit
+func (sm *ServerManager) SetHistoryRetention(keep int, maxAge time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.historyKeep = keep
+	sm.historyMaxAge = maxAge
 }
 
-// File: servers/manager.go (appending to existing file content, replacing end lines)
+// RecordHistory appends an update to a workspace's history and applies retention
+func (sm *ServerManager) RecordHistory(workspaceID string, entry HistoryEntry) (HistoryEntry, error) {
+	sm.mu.RLock()
+	keep, maxAge := sm.historyKeep, sm.historyMaxAge
+	sm.mu.RUnlock()
 
-// Persistence
-const dataFile = "/app/data/servers.json"
+	entry, err := sm.store.AppendHistory(workspaceID, entry)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	var cutoff time.Time
+	if maxAge > 0 {
+		cutoff = time.Now().Add(-maxAge)
+	}
+	if err := sm.store.TrimHistory(workspaceID, keep, cutoff); err != nil {
+		// The entry is already stored; retention catches up on the next append
+		log.Printf("⚠️ Failed to trim update history of workspace %s: %v", workspaceID, err)
+	}
+	return entry, nil
+}
 
-// Save persists the current state to disk (Thread-Safe)
-func (sm *ServerManager) Save() error {
+// History returns up to limit history entries of userID's workspace for
+// server (all servers if empty), newest first
+func (sm *ServerManager) History(userID int64, server string, limit int) ([]HistoryEntry, error) {
+	sm.mu.RLock()
+	ws := sm.activeWorkspace(userID)
+	sm.mu.RUnlock()
+
+	if ws == nil {
+		return nil, nil
+	}
+	return sm.store.LoadHistory(ws.ID, server, limit)
+}
+
+// Members returns the access list ordered by user ID
+func (sm *ServerManager) Members() []Member {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sortedMembers(sm.members)
+}
+
+// Member returns one access list entry
+func (sm *ServerManager) Member(userID int64) (Member, bool) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	return sm.saveToFile()
+	m, ok := sm.members[userID]
+	return m, ok
+}
+
+// SetMember adds or replaces an access list entry
+func (sm *ServerManager) SetMember(member Member) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if err := sm.store.UpsertMember(member); err != nil {
+		return err
+	}
+	sm.members[member.UserID] = member
+	return nil
 }
 
-// saveToFile writes data to disk without locking (Caller must hold lock)
-func (sm *ServerManager) saveToFile() error {
-	data, err := json.MarshalIndent(sm.users, "", "  ")
+// RemoveMember deletes an access list entry
+func (sm *ServerManager) RemoveMember(userID int64) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.members[userID]; !exists {
+		return ErrMemberNotFound
+	}
+	if err := sm.store.DeleteMember(userID); err != nil {
+		return err
+	}
+	delete(sm.members, userID)
+	return nil
+}
+
+// setFreezes writes a workspace's freezes through to the store (Caller must hold lock)
+func (sm *ServerManager) setFreezes(ws *Workspace, freezes []Freeze) error {
+	updated := *ws
+	updated.Freezes = freezes
+	if err := sm.store.UpsertWorkspace(&updated); err != nil {
+		return err
+	}
+	ws.Freezes = freezes
+	return nil
+}
+
+// newFreezeID returns the lowest unused short ID ("f1", "f2", ...)
+func newFreezeID(existing []Freeze) string {
+	taken := make(map[string]bool, len(existing))
+	for _, f := range existing {
+		taken[f.ID] = true
+	}
+	for n := 1; ; n++ {
+		id := fmt.Sprintf("f%d", n)
+		if !taken[id] {
+			return id
+		}
+	}
+}
+
+// updateServer applies mutate to a copy of the server and writes it through
+func (sm *ServerManager) updateServer(userID int64, nickname string, mutate func(*ServerConfig) error) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws, err := sm.lookupServer(userID, nickname)
 	if err != nil {
 		return err
 	}
+	return sm.mutateServer(ws, nickname, mutate)
+}
+
+// mutateServer applies mutate to a copy of one of the workspace's servers and
+// writes it through (Caller must hold lock)
+func (sm *ServerManager) mutateServer(ws *Workspace, nickname string, mutate func(*ServerConfig) error) error {
+	server, exists := ws.Servers[nickname]
+	if !exists {
+		return ErrServerNotFound
+	}
 
-	// Ensure directory exists
-	if err := os.MkdirAll("/app/data", 0755); err != nil {
+	updated := copyServer(server)
+	if err := mutate(updated); err != nil {
+		return err
+	}
+	if err := sm.store.UpsertServer(ws.ID, updated); err != nil {
 		return err
 	}
+	ws.Servers[nickname] = updated
+
+	return nil
+}
+
+// lookupServer returns the workspace in which userID sees nickname (Caller must hold lock)
+func (sm *ServerManager) lookupServer(userID int64, nickname string) (*Workspace, error) {
+	ws := sm.activeWorkspace(userID)
+	if ws == nil {
+		return nil, ErrServerNotFound
+	}
+	if _, exists := ws.Servers[nickname]; !exists {
+		return nil, ErrServerNotFound
+	}
+	return ws, nil
+}
+
+// GetAPIClient returns a Watchtower API client for the user's current server
+func (sm *ServerManager) GetAPIClient(userID int64) (*api.WatchtowerClient, error) {
+	server, err := sm.GetCurrentServer(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAPIClient(server), nil
+}
+
+func newAPIClient(server *ServerConfig) *api.WatchtowerClient {
+	client := api.NewWatchtowerClient(server.WatchtowerURL, server.Token)
+	client.AgentURL = server.AgentURL
+	return client
+}
+
+// GetAPIClientFor returns a Watchtower API client for one of the user's servers
+func (sm *ServerManager) GetAPIClientFor(userID int64, nickname string) (*api.WatchtowerClient, error) {
+	server, err := sm.GetServer(userID, nickname)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAPIClient(server), nil
+}
+
+// GetAPIClientIn returns a Watchtower API client for a server of a given
+// workspace, for work that must not follow its user to another workspace
+func (sm *ServerManager) GetAPIClientIn(workspaceID string, nickname string) (*api.WatchtowerClient, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ws := sm.workspaces[workspaceID]
+	if ws == nil || ws.Servers[nickname] == nil {
+		return nil, ErrServerNotFound
+	}
+	server, err := sm.decrypted(ws.Servers[nickname])
+	if err != nil {
+		return nil, err
+	}
 
-	return os.WriteFile(dataFile, data, 0644)
+	return newAPIClient(server), nil
 }
 
+func (sm *ServerManager) encryptToken(plaintext string) (string, error) {
+	return sm.keys.encrypt(plaintext)
+}
+
+func (sm *ServerManager) decryptToken(cryptoText string) (string, error) {
+	return sm.keys.decrypt(cryptoText)
+}
+
+// Load replaces the in-memory state with the contents of the store
 func (sm *ServerManager) Load() error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	data, err := os.ReadFile(dataFile)
+	users, err := sm.store.LoadUsers()
+	if err != nil {
+		return err
+	}
+	workspaces, err := sm.store.LoadWorkspaces()
+	if err != nil {
+		return err
+	}
+	members, err := sm.store.LoadMembers()
+	if err != nil {
+		return err
+	}
+	tokens, err := sm.store.LoadAPITokens()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // No data yet, start fresh
+		return err
+	}
+
+	sm.users = users
+	sm.workspaces = workspaces
+	sm.members = make(map[int64]Member, len(members))
+	for _, m := range members {
+		sm.members[m.UserID] = m
+	}
+	sm.tokens = make(map[string]*APIToken, len(tokens))
+	for i := range tokens {
+		sm.tokens[tokens[i].ID] = &tokens[i]
+	}
+	if err := sm.migrateToWorkspaces(); err != nil {
+		return err
+	}
+	return sm.migrateLegacyTokens()
+}
+
+// migrateLegacyTokens re-encrypts tokens stored in an envelope older than the
+// current one. Records sealed by a retired key in the current envelope are left
+// for RotateKeys. (Caller must hold lock)
+func (sm *ServerManager) migrateLegacyTokens() error {
+	for workspaceID, ws := range sm.workspaces {
+		for nickname, server := range ws.Servers {
+			if !isOutdatedFormat(server.Token) {
+				continue
+			}
+
+			plaintext, err := sm.decryptToken(server.Token)
+			if err != nil {
+				// Leave the record untouched; using it will report the error
+				log.Printf("⚠️  Cannot migrate token of server %s (workspace %s): %v", nickname, workspaceID, err)
+				continue
+			}
+			if err := sm.reencrypt(ws, server, plaintext); err != nil {
+				return err
+			}
+			log.Printf("🔐 Migrated token of server %s (workspace %s) to key %s", nickname, workspaceID, sm.keys.PrimaryID())
 		}
+	}
+	return nil
+}
+
+// RotateKeys re-encrypts every token not sealed by the primary key and returns
+// how many were rewritten. Nothing is written unless every token decrypts.
+func (sm *ServerManager) RotateKeys() (int, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	type pending struct {
+		ws        *Workspace
+		server    *ServerConfig
+		plaintext string
+	}
+
+	var todo []pending
+	for workspaceID, ws := range sm.workspaces {
+		for nickname, server := range ws.Servers {
+			if sm.keys.isCurrent(server.Token) {
+				continue
+			}
+			plaintext, err := sm.decryptToken(server.Token)
+			if err != nil {
+				return 0, fmt.Errorf("server %s (workspace %s): %w", nickname, workspaceID, err)
+			}
+			todo = append(todo, pending{ws, server, plaintext})
+		}
+	}
+
+	for i, p := range todo {
+		if err := sm.reencrypt(p.ws, p.server, p.plaintext); err != nil {
+			return i, err
+		}
+	}
+	return len(todo), nil
+}
+
+// reencrypt seals plaintext with the primary key and writes the server back
+// (Caller must hold lock)
+func (sm *ServerManager) reencrypt(ws *Workspace, server *ServerConfig, plaintext string) error {
+	encrypted, err := sm.encryptToken(plaintext)
+	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, &sm.users)
+	updated := copyServer(server)
+	updated.Token = encrypted
+	if err := sm.store.UpsertServer(ws.ID, updated); err != nil {
+		return err
+	}
+	ws.Servers[server.Nickname] = updated
+	return nil
 }
 
-func deriveKey(passphrase string) []byte {
-	key := make([]byte, 32)
-	copy(key, passphrase)
-	return key
+// Close releases the underlying store
+func (sm *ServerManager) Close() error {
+	return sm.store.Close()
 }
@@ -0,0 +1,290 @@
+package servers
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustKeyring(t *testing.T, primary string, retired ...string) *Keyring {
+	t.Helper()
+	kr, err := NewKeyring(primary, retired...)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return kr
+}
+
+func newTestManager(t *testing.T) *ServerManager {
+	t.Helper()
+	sm, err := NewManager(mustKeyring(t, "test-encryption-key"), NewJSONStore(filepath.Join(t.TempDir(), "servers.json")))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return sm
+}
+
+func TestManagerPersistsThroughStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+
+	sm, err := NewManager(mustKeyring(t, "test-encryption-key"), NewJSONStore(path))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if err := sm.AddServer(1, "home", "https://home.example", "secret-token"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	if err := sm.AddServer(1, "vps", "https://vps.example", "other-token"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	if err := sm.SwitchServer(1, "vps"); err != nil {
+		t.Fatalf("SwitchServer: %v", err)
+	}
+
+	reloaded, err := NewManager(mustKeyring(t, "test-encryption-key"), NewJSONStore(path))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	current, err := reloaded.GetCurrentServer(1)
+	if err != nil {
+		t.Fatalf("GetCurrentServer: %v", err)
+	}
+	if current.Nickname != "vps" || current.Token != "other-token" {
+		t.Errorf("unexpected current server after reload: %+v", current)
+	}
+}
+
+func TestManagerRejectsDuplicateNickname(t *testing.T) {
+	sm := newTestManager(t)
+	if err := sm.AddServer(1, "home", "https://a", "t"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	if err := sm.AddServer(1, "home", "https://b", "t"); err == nil {
+		t.Error("expected duplicate nickname to be rejected")
+	}
+}
+
+func TestManagerRemoveServerMovesCurrent(t *testing.T) {
+	sm := newTestManager(t)
+	sm.AddServer(1, "home", "https://a", "t")
+	sm.AddServer(1, "vps", "https://b", "t")
+	sm.AddServer(1, "alpha", "https://c", "t")
+
+	if err := sm.RemoveServer(1, "home"); err != nil {
+		t.Fatalf("RemoveServer: %v", err)
+	}
+	current, err := sm.GetCurrentServer(1)
+	if err != nil || current.Nickname != "alpha" {
+		t.Errorf("expected alpha to become current, got %+v, %v", current, err)
+	}
+
+	if err := sm.RemoveServer(1, "home"); !errors.Is(err, ErrServerNotFound) {
+		t.Errorf("expected ErrServerNotFound, got %v", err)
+	}
+
+	sm.RemoveServer(1, "alpha")
+	sm.RemoveServer(1, "vps")
+	if _, err := sm.GetCurrentServer(1); err == nil {
+		t.Error("expected no current server after removing all servers")
+	}
+}
+
+func TestManagerRenameServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	sm, _ := NewManager(mustKeyring(t, "key"), NewJSONStore(path))
+	sm.AddServer(1, "home", "https://a", "token")
+	sm.AddServer(1, "vps", "https://b", "t")
+
+	if err := sm.RenameServer(1, "home", "vps"); !errors.Is(err, ErrServerExists) {
+		t.Errorf("expected ErrServerExists, got %v", err)
+	}
+	if err := sm.RenameServer(1, "home", "bad name"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("expected ErrInvalidName, got %v", err)
+	}
+	if err := sm.RenameServer(1, "home", "house"); err != nil {
+		t.Fatalf("RenameServer: %v", err)
+	}
+
+	reloaded, _ := NewManager(mustKeyring(t, "key"), NewJSONStore(path))
+	names, _ := reloaded.ListServers(1)
+	if strings.Join(names, ",") != "house,vps" {
+		t.Errorf("expected [house vps], got %v", names)
+	}
+	current, err := reloaded.GetCurrentServer(1)
+	if err != nil || current.Nickname != "house" || current.Token != "token" {
+		t.Errorf("expected renamed server to stay current with its token, got %+v, %v", current, err)
+	}
+}
+
+func TestManagerUpdateServer(t *testing.T) {
+	sm := newTestManager(t)
+	sm.AddServer(1, "home", "https://a", "old-token")
+
+	if err := sm.UpdateServerURL(1, "home", "https://b"); err != nil {
+		t.Fatalf("UpdateServerURL: %v", err)
+	}
+	if err := sm.UpdateServerToken(1, "home", "new-token"); err != nil {
+		t.Fatalf("UpdateServerToken: %v", err)
+	}
+	if err := sm.UpdateServerURL(1, "ghost", "https://c"); !errors.Is(err, ErrServerNotFound) {
+		t.Errorf("expected ErrServerNotFound, got %v", err)
+	}
+	for _, bad := range []string{"httpfoo", "https://", "ftp://c", "c:8080"} {
+		if err := sm.UpdateServerURL(1, "home", bad); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("UpdateServerURL(%q) = %v, want ErrInvalidURL", bad, err)
+		}
+	}
+	if err := sm.UpdateServerAgentURL(1, "home", "httpfoo"); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("expected ErrInvalidURL for the agent, got %v", err)
+	}
+	if err := sm.AddServer(1, "vps", "https:///path", "token"); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("expected AddServer to reject a URL without host, got %v", err)
+	}
+
+	current, _ := sm.GetCurrentServer(1)
+	if current.WatchtowerURL != "https://b" || current.Token != "new-token" {
+		t.Errorf("unexpected server after update: %+v", current)
+	}
+}
+
+func TestManagerRecordMetricsPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	sm, err := NewManager(mustKeyring(t, "test-encryption-key"), NewJSONStore(path))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	sm.AddServer(1, "home", "https://a", "token")
+
+	previous, err := sm.RecordMetrics(1, "home", MetricsSnapshot{Scanned: 5, ScansTotal: 10})
+	if err != nil || previous != nil {
+		t.Fatalf("first RecordMetrics: previous=%+v err=%v", previous, err)
+	}
+
+	reloaded, err := NewManager(mustKeyring(t, "test-encryption-key"), NewJSONStore(path))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	previous, err = reloaded.RecordMetrics(1, "home", MetricsSnapshot{Scanned: 6, ScansTotal: 12})
+	if err != nil {
+		t.Fatalf("RecordMetrics: %v", err)
+	}
+	if previous == nil || previous.Scanned != 5 || previous.ScansTotal != 10 {
+		t.Errorf("expected persisted snapshot, got %+v", previous)
+	}
+}
+
+func TestManagerSchedules(t *testing.T) {
+	sm := newTestManager(t)
+	sm.AddServer(1, "home", "https://a", "token")
+	sm.AddServer(1, "vps", "https://b", "token")
+
+	if err := sm.RecordScheduleRun("1", "home", time.Time{}, time.Now()); !errors.Is(err, ErrNoSchedule) {
+		t.Errorf("expected ErrNoSchedule, got %v", err)
+	}
+	if err := sm.SetSchedule(1, "home", &UpdateSchedule{Cron: "@daily", Timezone: "Europe/Berlin"}); err != nil {
+		t.Fatalf("SetSchedule: %v", err)
+	}
+
+	last := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	next := last.Add(24 * time.Hour)
+	if err := sm.RecordScheduleRun("1", "home", last, next); err != nil {
+		t.Fatalf("RecordScheduleRun: %v", err)
+	}
+
+	list := sm.ScheduledServers()
+	if len(list) != 1 || list[0].Nickname != "home" || list[0].Schedule.Cron != "@daily" {
+		t.Fatalf("unexpected scheduled servers: %+v", list)
+	}
+	if list[0].Workspace != "1" || list[0].UserID != 1 {
+		t.Errorf("expected schedule in workspace 1 owned by user 1, got %+v", list[0])
+	}
+	if !list[0].Schedule.LastRun.Equal(last) || !list[0].Schedule.NextRun.Equal(next) {
+		t.Errorf("run times not recorded: %+v", list[0].Schedule)
+	}
+
+	if err := sm.SetSchedule(1, "home", nil); err != nil {
+		t.Fatalf("SetSchedule(nil): %v", err)
+	}
+	if list := sm.ScheduledServers(); len(list) != 0 {
+		t.Errorf("expected no schedules after clear, got %+v", list)
+	}
+}
+
+func TestManagerHooks(t *testing.T) {
+	sm := newTestManager(t)
+	if err := sm.AddServer(1, "home", "https://home.example", "t"); err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+
+	if _, _, err := sm.EnableHook(1, "nope"); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected ErrServerNotFound, got %v", err)
+	}
+
+	id, secret, err := sm.EnableHook(1, "home")
+	if err != nil {
+		t.Fatalf("EnableHook: %v", err)
+	}
+	server, _ := sm.GetServer(1, "home")
+	if server.HookSecretHash == "" || strings.Contains(server.HookSecretHash, secret) {
+		t.Errorf("secret must be stored only as a hash, got %q", server.HookSecretHash)
+	}
+
+	workspaceID, nickname, err := sm.VerifyHook(id, secret)
+	if err != nil || workspaceID != "1" || nickname != "home" {
+		t.Fatalf("VerifyHook = %q, %q, %v", workspaceID, nickname, err)
+	}
+	if _, _, err := sm.VerifyHook(id, "wrong"); !errors.Is(err, ErrHookDenied) {
+		t.Errorf("expected ErrHookDenied for a wrong secret, got %v", err)
+	}
+	if _, _, err := sm.VerifyHook("unknown", secret); !errors.Is(err, ErrHookDenied) {
+		t.Errorf("expected ErrHookDenied for an unknown ID, got %v", err)
+	}
+
+	// Rotating keeps the ID and invalidates the old secret
+	rotatedID, rotated, err := sm.EnableHook(1, "home")
+	if err != nil {
+		t.Fatalf("EnableHook: %v", err)
+	}
+	if rotatedID != id || rotated == secret {
+		t.Errorf("expected same ID and new secret, got %q/%q", rotatedID, rotated)
+	}
+	if _, _, err := sm.VerifyHook(id, secret); !errors.Is(err, ErrHookDenied) {
+		t.Errorf("old secret still accepted: %v", err)
+	}
+
+	if err := sm.DisableHook(1, "home"); err != nil {
+		t.Fatalf("DisableHook: %v", err)
+	}
+	if _, _, err := sm.VerifyHook(id, rotated); !errors.Is(err, ErrHookDenied) {
+		t.Errorf("disabled hook still accepted: %v", err)
+	}
+}
+
+func TestManagerHistoryRetention(t *testing.T) {
+	sm := newTestManager(t)
+	sm.SetHistoryRetention(2, time.Hour)
+	sm.AddServer(1, "home", "https://a", "token")
+
+	now := time.Now()
+	entries := []HistoryEntry{
+		{Server: "home", Started: now.Add(-2 * time.Hour), Status: "succeeded"},
+		{Server: "home", Started: now.Add(-3 * time.Minute), Status: "failed"},
+		{Server: "vps", Started: now.Add(-2 * time.Minute), Status: "succeeded"},
+		{Server: "home", Started: now.Add(-time.Minute), Status: HistoryStatusReported},
+	}
+	for _, e := range entries {
+		if _, err := sm.RecordHistory("1", e); err != nil {
+			t.Fatalf("RecordHistory: %v", err)
+		}
+	}
+
+	list, err := sm.History(1, "", 0)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(list) != 2 || list[0].Status != HistoryStatusReported || list[1].Server != "vps" {
+		t.Errorf("expected the 2 newest entries, got %+v", list)
+	}
+}
@@ -0,0 +1,162 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Storage backends selectable via STORAGE_BACKEND
+const (
+	BackendJSON = "json"
+	BackendBolt = "bolt"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+)
+
+// Store is the persistence layer behind ServerManager.
+// ServerManager keeps an in-memory copy of every user and workspace and writes
+// each change through to the store, so implementations only need to handle
+// single-record operations. Returned values must not alias the store's
+// internal state.
+type Store interface {
+	// LoadUsers returns every persisted user keyed by Telegram ID
+	LoadUsers() (map[int64]*User, error)
+	// LoadUser returns a single user or ErrUserNotFound
+	LoadUser(userID int64) (*User, error)
+	// UpsertUser creates or replaces a user, including the pre-workspace
+	// Servers and Freezes, which are dropped when empty
+	UpsertUser(user *User) error
+	// LoadWorkspaces returns every workspace with its servers, keyed by ID
+	LoadWorkspaces() (map[string]*Workspace, error)
+	// UpsertWorkspace creates or replaces a workspace's name, members and
+	// freezes; its servers are left untouched
+	UpsertWorkspace(ws *Workspace) error
+	// UpsertServer creates or replaces a server of an existing workspace
+	UpsertServer(workspaceID string, server *ServerConfig) error
+	// DeleteServer removes a server; deleting a missing server is not an error
+	DeleteServer(workspaceID string, nickname string) error
+	// AppendHistory adds an entry to the workspace's history and returns it with its ID set
+	AppendHistory(workspaceID string, entry HistoryEntry) (HistoryEntry, error)
+	// LoadHistory returns up to limit entries for server (all servers if
+	// empty), newest first; limit <= 0 returns everything
+	LoadHistory(workspaceID string, server string, limit int) ([]HistoryEntry, error)
+	// TrimHistory keeps the newest keep entries and drops those started before
+	// cutoff; keep <= 0 and a zero cutoff disable the respective limit
+	TrimHistory(workspaceID string, keep int, cutoff time.Time) error
+	// LoadMembers returns the access list
+	LoadMembers() ([]Member, error)
+	// UpsertMember adds or replaces an access list entry
+	UpsertMember(member Member) error
+	// DeleteMember removes an access list entry; removing a missing one is not an error
+	DeleteMember(userID int64) error
+	// LoadAPITokens returns every API token
+	LoadAPITokens() ([]APIToken, error)
+	// UpsertAPIToken adds or replaces an API token
+	UpsertAPIToken(token APIToken) error
+	// DeleteAPIToken removes an API token; removing a missing one is not an error
+	DeleteAPIToken(id string) error
+	Close() error
+}
+
+// OpenStore opens the named storage backend inside dataDir
+func OpenStore(backend, dataDir string) (Store, error) {
+	switch backend {
+	case "", BackendJSON:
+		return NewJSONStore(filepath.Join(dataDir, "servers.json")), nil
+	case BackendBolt:
+		return NewBoltStore(filepath.Join(dataDir, "servers.db"))
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+func copyServer(s *ServerConfig) *ServerConfig {
+	c := *s
+	if s.LastMetrics != nil {
+		m := *s.LastMetrics
+		c.LastMetrics = &m
+	}
+	if s.Schedule != nil {
+		sched := *s.Schedule
+		c.Schedule = &sched
+	}
+	return &c
+}
+
+func copyUser(u *User) *User {
+	c := *u
+	c.Servers = copyServers(u.Servers)
+	c.Freezes = copyFreezes(u.Freezes)
+	return &c
+}
+
+func copyWorkspace(ws *Workspace) *Workspace {
+	c := *ws
+	c.Servers = copyServers(ws.Servers)
+	if c.Servers == nil {
+		c.Servers = make(map[string]*ServerConfig)
+	}
+	c.Members = append([]int64(nil), ws.Members...)
+	c.Freezes = copyFreezes(ws.Freezes)
+	return &c
+}
+
+func copyServers(servers map[string]*ServerConfig) map[string]*ServerConfig {
+	if servers == nil {
+		return nil
+	}
+	c := make(map[string]*ServerConfig, len(servers))
+	for nickname, s := range servers {
+		c[nickname] = copyServer(s)
+	}
+	return c
+}
+
+func copyFreezes(freezes []Freeze) []Freeze {
+	if freezes == nil {
+		return nil
+	}
+	c := make([]Freeze, len(freezes))
+	for i, f := range freezes {
+		f.Days = append([]time.Weekday(nil), f.Days...)
+		c[i] = f
+	}
+	return c
+}
+
+// sortedAPITokens lists tokens oldest first
+func sortedAPITokens(tokens map[string]APIToken) []APIToken {
+	list := make([]APIToken, 0, len(tokens))
+	for _, t := range tokens {
+		list = append(list, copyAPIToken(t))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func copyAPIToken(t APIToken) APIToken {
+	t.Servers = append([]string(nil), t.Servers...)
+	t.Actions = append([]string(nil), t.Actions...)
+	return t
+}
+
+// sortedMembers lists members ordered by user ID
+func sortedMembers(members map[int64]Member) []Member {
+	list := make([]Member, 0, len(members))
+	for _, m := range members {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UserID < list[j].UserID })
+	return list
+}
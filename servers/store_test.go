@@ -0,0 +1,410 @@
+package servers
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// storeFactories lists every Store implementation run through the conformance suite.
+// reopen must return a store backed by the same data as the previous call.
+var storeFactories = map[string]func(t *testing.T) (open func() Store){
+	"json": func(t *testing.T) func() Store {
+		path := filepath.Join(t.TempDir(), "servers.json")
+		return func() Store { return NewJSONStore(path) }
+	},
+	"bolt": func(t *testing.T) func() Store {
+		path := filepath.Join(t.TempDir(), "servers.db")
+		return func() Store {
+			s, err := NewBoltStore(path)
+			if err != nil {
+				t.Fatalf("open bolt store: %v", err)
+			}
+			return s
+		}
+	},
+}
+
+func TestStoreConformance(t *testing.T) {
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Empty", func(t *testing.T) { testStoreEmpty(t, factory(t)) })
+			t.Run("UpsertAndLoad", func(t *testing.T) { testStoreUpsertAndLoad(t, factory(t)) })
+			t.Run("Delete", func(t *testing.T) { testStoreDelete(t, factory(t)) })
+			t.Run("Users", func(t *testing.T) { testStoreUsers(t, factory(t)) })
+			t.Run("Workspaces", func(t *testing.T) { testStoreWorkspaces(t, factory(t)) })
+			t.Run("History", func(t *testing.T) { testStoreHistory(t, factory(t)) })
+			t.Run("Members", func(t *testing.T) { testStoreMembers(t, factory(t)) })
+			t.Run("APITokens", func(t *testing.T) { testStoreAPITokens(t, factory(t)) })
+			t.Run("Isolation", func(t *testing.T) { testStoreIsolation(t, factory(t)) })
+		})
+	}
+}
+
+func testStoreEmpty(t *testing.T, open func() Store) {
+	s := open()
+	defer s.Close()
+
+	users, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("expected no users, got %d", len(users))
+	}
+	if _, err := s.LoadUser(1); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	workspaces, err := s.LoadWorkspaces()
+	if err != nil {
+		t.Fatalf("LoadWorkspaces: %v", err)
+	}
+	if len(workspaces) != 0 {
+		t.Errorf("expected no workspaces, got %d", len(workspaces))
+	}
+}
+
+func testStoreUpsertAndLoad(t *testing.T, open func() Store) {
+	s := open()
+	created := time.Date(2026, 1, 30, 12, 0, 0, 0, time.UTC)
+
+	if err := s.UpsertServer("ops", &ServerConfig{Nickname: "home"}); err != ErrWorkspaceNotFound {
+		t.Errorf("expected ErrWorkspaceNotFound for unknown workspace, got %v", err)
+	}
+	if err := s.UpsertWorkspace(&Workspace{ID: "ops", Name: "ops", Members: []int64{42}, CreatedBy: 42, CreatedAt: created}); err != nil {
+		t.Fatalf("UpsertWorkspace: %v", err)
+	}
+	if err := s.UpsertServer("ops", &ServerConfig{Nickname: "home", WatchtowerURL: "https://a", Token: "t1", CreatedAt: created, IsActive: true}); err != nil {
+		t.Fatalf("UpsertServer: %v", err)
+	}
+	if err := s.UpsertServer("ops", &ServerConfig{Nickname: "vps", WatchtowerURL: "https://b", Token: "t2"}); err != nil {
+		t.Fatalf("UpsertServer: %v", err)
+	}
+	// Replacing an existing server must not duplicate it
+	if err := s.UpsertServer("ops", &ServerConfig{Nickname: "home", WatchtowerURL: "https://c", Token: "t3", CreatedAt: created, IsActive: true}); err != nil {
+		t.Fatalf("UpsertServer: %v", err)
+	}
+	s.Close()
+
+	s = open()
+	defer s.Close()
+
+	workspaces, err := s.LoadWorkspaces()
+	if err != nil {
+		t.Fatalf("LoadWorkspaces: %v", err)
+	}
+	ws := workspaces["ops"]
+	if len(workspaces) != 1 || ws == nil {
+		t.Fatalf("expected exactly workspace ops, got %v", workspaces)
+	}
+	if ws.Name != "ops" || ws.CreatedBy != 42 || !ws.CreatedAt.Equal(created) || len(ws.Members) != 1 || ws.Members[0] != 42 {
+		t.Errorf("unexpected workspace after reopen: %+v", ws)
+	}
+	if len(ws.Servers) != 2 {
+		t.Fatalf("expected 2 servers, got %d", len(ws.Servers))
+	}
+	home := ws.Servers["home"]
+	if home.WatchtowerURL != "https://c" || home.Token != "t3" || !home.IsActive || !home.CreatedAt.Equal(created) {
+		t.Errorf("unexpected home server after reopen: %+v", home)
+	}
+}
+
+func testStoreDelete(t *testing.T, open func() Store) {
+	s := open()
+	defer s.Close()
+
+	if err := s.DeleteServer("ghost", "home"); err != nil {
+		t.Errorf("deleting from unknown workspace should be a no-op, got %v", err)
+	}
+
+	s.UpsertWorkspace(&Workspace{ID: "7", Name: PersonalWorkspaceName, Members: []int64{7}, CreatedBy: 7})
+	s.UpsertServer("7", &ServerConfig{Nickname: "home"})
+	s.UpsertServer("7", &ServerConfig{Nickname: "vps"})
+
+	if err := s.DeleteServer("7", "home"); err != nil {
+		t.Fatalf("DeleteServer: %v", err)
+	}
+	if err := s.DeleteServer("7", "home"); err != nil {
+		t.Errorf("deleting twice should be a no-op, got %v", err)
+	}
+
+	workspaces, err := s.LoadWorkspaces()
+	if err != nil {
+		t.Fatalf("LoadWorkspaces: %v", err)
+	}
+	if servers := workspaces["7"].Servers; servers["home"] != nil || len(servers) != 1 {
+		t.Errorf("expected only vps to remain, got %v", servers)
+	}
+}
+
+func testStoreUsers(t *testing.T, open func() Store) {
+	s := open()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Users written before workspaces still carry their servers and freezes
+	legacy := &User{
+		TelegramID:    9,
+		CurrentServer: "home",
+		CreatedAt:     created,
+		Servers:       map[string]*ServerConfig{"home": {Nickname: "home", Token: "t"}},
+		Freezes:       []Freeze{{ID: "f1", End: created}},
+	}
+	if err := s.UpsertUser(legacy); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	s.Close()
+
+	s = open()
+	user, err := s.LoadUser(9)
+	if err != nil {
+		t.Fatalf("LoadUser: %v", err)
+	}
+	if user.CurrentServer != "home" || !user.CreatedAt.Equal(created) || user.Servers["home"].Token != "t" || len(user.Freezes) != 1 {
+		t.Fatalf("unexpected legacy user after reopen: %+v", user)
+	}
+
+	if err := s.UpsertUser(&User{TelegramID: 9, Workspace: "ops", CurrentServer: "vps", CreatedAt: created}); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	s.Close()
+
+	s = open()
+	defer s.Close()
+
+	users, err := s.LoadUsers()
+	if err != nil {
+		t.Fatalf("LoadUsers: %v", err)
+	}
+	user = users[9]
+	if len(users) != 1 || user == nil {
+		t.Fatalf("expected exactly user 9, got %v", users)
+	}
+	if user.Workspace != "ops" || user.CurrentServer != "vps" {
+		t.Errorf("expected workspace ops and server vps, got %+v", user)
+	}
+	if len(user.Servers) != 0 || len(user.Freezes) != 0 {
+		t.Errorf("expected legacy servers and freezes dropped, got %+v", user)
+	}
+}
+
+func testStoreWorkspaces(t *testing.T, open func() Store) {
+	s := open()
+	end := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	ws := &Workspace{
+		ID:      "ops",
+		Name:    "ops",
+		Members: []int64{5, 6},
+		Freezes: []Freeze{
+			{ID: "f1", Start: end.Add(-time.Hour), End: end, Reason: "release"},
+			{ID: "f2", Server: "home", Window: "22:00-06:00", Days: []time.Weekday{time.Friday}, Timezone: "Europe/Berlin"},
+		},
+		CreatedBy: 5,
+	}
+	if err := s.UpsertWorkspace(ws); err != nil {
+		t.Fatalf("UpsertWorkspace: %v", err)
+	}
+	if err := s.UpsertServer("ops", &ServerConfig{Nickname: "home", WatchtowerURL: "https://a"}); err != nil {
+		t.Fatalf("UpsertServer: %v", err)
+	}
+	s.Close()
+
+	s = open()
+	defer s.Close()
+
+	workspaces, err := s.LoadWorkspaces()
+	if err != nil {
+		t.Fatalf("LoadWorkspaces: %v", err)
+	}
+	got := workspaces["ops"]
+	if len(got.Freezes) != 2 || got.Freezes[0].ID != "f1" || !got.Freezes[0].End.Equal(end) {
+		t.Fatalf("unexpected freezes after reopen: %+v", got.Freezes)
+	}
+	if f := got.Freezes[1]; f.Server != "home" || f.Window != "22:00-06:00" || len(f.Days) != 1 || f.Days[0] != time.Friday {
+		t.Errorf("recurring freeze not preserved: %+v", f)
+	}
+
+	// Rewriting the workspace leaves its servers alone
+	if err := s.UpsertWorkspace(&Workspace{ID: "ops", Name: "ops", Members: []int64{6}, CreatedBy: 5}); err != nil {
+		t.Fatalf("UpsertWorkspace: %v", err)
+	}
+	workspaces, err = s.LoadWorkspaces()
+	if err != nil {
+		t.Fatalf("LoadWorkspaces: %v", err)
+	}
+	got = workspaces["ops"]
+	if len(got.Freezes) != 0 || len(got.Members) != 1 || got.Members[0] != 6 {
+		t.Errorf("expected freezes cleared and member 6 left, got %+v", got)
+	}
+	if got.Servers["home"] == nil {
+		t.Error("server lost after UpsertWorkspace")
+	}
+}
+
+func testStoreHistory(t *testing.T, open func() Store) {
+	s := open()
+	base := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	for i, server := range []string{"home", "vps", "home", "home"} {
+		entry := HistoryEntry{Server: server, Source: SourceManual, Started: base.Add(time.Duration(i) * time.Hour), Status: "succeeded", Updated: []string{"web"}}
+		got, err := s.AppendHistory("7", entry)
+		if err != nil {
+			t.Fatalf("AppendHistory: %v", err)
+		}
+		if got.ID != uint64(i+1) {
+			t.Errorf("expected ID %d, got %d", i+1, got.ID)
+		}
+	}
+	if _, err := s.AppendHistory("8", HistoryEntry{Server: "home", Started: base}); err != nil {
+		t.Fatalf("AppendHistory: %v", err)
+	}
+	s.Close()
+
+	s = open()
+	defer s.Close()
+
+	all, err := s.LoadHistory("7", "", 0)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if len(all) != 4 || all[0].ID != 4 || all[3].ID != 1 {
+		t.Fatalf("expected 4 entries newest first, got %+v", all)
+	}
+	if len(all[0].Updated) != 1 || all[0].Updated[0] != "web" {
+		t.Errorf("container lists not preserved: %+v", all[0])
+	}
+
+	home, err := s.LoadHistory("7", "home", 2)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if len(home) != 2 || home[0].ID != 4 || home[1].ID != 3 {
+		t.Errorf("expected home entries 4 and 3, got %+v", home)
+	}
+
+	// Keep the newest 3, then drop everything before 02:30
+	if err := s.TrimHistory("7", 3, time.Time{}); err != nil {
+		t.Fatalf("TrimHistory: %v", err)
+	}
+	if err := s.TrimHistory("7", 0, base.Add(150*time.Minute)); err != nil {
+		t.Fatalf("TrimHistory: %v", err)
+	}
+	left, err := s.LoadHistory("7", "", 0)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if len(left) != 1 || left[0].ID != 4 {
+		t.Errorf("expected only entry 4 after trimming, got %+v", left)
+	}
+
+	// IDs keep increasing after a trim, and other workspaces are untouched
+	next, err := s.AppendHistory("7", HistoryEntry{Server: "home", Started: base.Add(5 * time.Hour)})
+	if err != nil {
+		t.Fatalf("AppendHistory: %v", err)
+	}
+	if next.ID != 5 {
+		t.Errorf("expected ID 5 after trim, got %d", next.ID)
+	}
+	if other, _ := s.LoadHistory("8", "", 0); len(other) != 1 {
+		t.Errorf("expected workspace 8 history untouched, got %+v", other)
+	}
+}
+
+func testStoreMembers(t *testing.T, open func() Store) {
+	s := open()
+	added := time.Date(2026, 2, 1, 9, 0, 0, 0, time.UTC)
+	for _, m := range []Member{
+		{UserID: 30, Role: "viewer", AddedBy: 10, AddedAt: added},
+		{UserID: 20, Role: "operator", AddedBy: 10, AddedAt: added},
+	} {
+		if err := s.UpsertMember(m); err != nil {
+			t.Fatalf("UpsertMember: %v", err)
+		}
+	}
+	if err := s.UpsertMember(Member{UserID: 30, Role: "operator", AddedBy: 10, AddedAt: added}); err != nil {
+		t.Fatalf("UpsertMember: %v", err)
+	}
+	s.Close()
+
+	s = open()
+	defer s.Close()
+
+	members, err := s.LoadMembers()
+	if err != nil {
+		t.Fatalf("LoadMembers: %v", err)
+	}
+	if len(members) != 2 || members[0].UserID != 20 || members[1].Role != "operator" || !members[1].AddedAt.Equal(added) {
+		t.Fatalf("unexpected members: %+v", members)
+	}
+
+	if err := s.DeleteMember(20); err != nil {
+		t.Fatalf("DeleteMember: %v", err)
+	}
+	if err := s.DeleteMember(99); err != nil {
+		t.Errorf("deleting a missing member should not fail: %v", err)
+	}
+	members, err = s.LoadMembers()
+	if err != nil {
+		t.Fatalf("LoadMembers: %v", err)
+	}
+	if len(members) != 1 || members[0].UserID != 30 {
+		t.Errorf("expected only member 30 left, got %+v", members)
+	}
+}
+
+func testStoreIsolation(t *testing.T, open func() Store) {
+	s := open()
+	defer s.Close()
+
+	for _, id := range []string{"1", "2"} {
+		s.UpsertWorkspace(&Workspace{ID: id, Name: PersonalWorkspaceName})
+	}
+	s.UpsertServer("1", &ServerConfig{Nickname: "home", Token: "one"})
+	s.UpsertServer("2", &ServerConfig{Nickname: "home", Token: "two"})
+
+	// Mutating a returned value must not leak back into the store
+	workspaces, _ := s.LoadWorkspaces()
+	workspaces["1"].Servers["home"].Token = "mutated"
+	workspaces["1"].Members = append(workspaces["1"].Members, 99)
+
+	again, _ := s.LoadWorkspaces()
+	if again["1"].Servers["home"].Token != "one" || len(again["1"].Members) != 0 {
+		t.Errorf("store state aliased by LoadWorkspaces result")
+	}
+	if again["2"].Servers["home"].Token != "two" {
+		t.Errorf("workspaces are not isolated: got token %q", again["2"].Servers["home"].Token)
+	}
+}
+
+func testStoreAPITokens(t *testing.T, open func() Store) {
+	s := open()
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, tok := range []APIToken{
+		{ID: "b", Name: "deploy", UserID: 1, Workspace: "ops", Hash: "h1", Servers: []string{"vps"}, Actions: []string{"update"}, CreatedAt: created.Add(time.Hour)},
+		{ID: "a", Name: "ci", UserID: 2, Workspace: "2", Hash: "h2", Actions: []string{"view"}, CreatedAt: created},
+	} {
+		if err := s.UpsertAPIToken(tok); err != nil {
+			t.Fatalf("UpsertAPIToken: %v", err)
+		}
+	}
+	s.Close()
+
+	s = open()
+	defer s.Close()
+
+	tokens, err := s.LoadAPITokens()
+	if err != nil {
+		t.Fatalf("LoadAPITokens: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].ID != "a" || tokens[1].Hash != "h1" || tokens[1].Servers[0] != "vps" || !tokens[1].CreatedAt.Equal(created.Add(time.Hour)) {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+
+	if err := s.DeleteAPIToken("a"); err != nil {
+		t.Fatalf("DeleteAPIToken: %v", err)
+	}
+	if err := s.DeleteAPIToken("missing"); err != nil {
+		t.Errorf("deleting a missing token should not fail: %v", err)
+	}
+	if tokens, _ := s.LoadAPITokens(); len(tokens) != 1 || tokens[0].ID != "b" {
+		t.Errorf("expected only token b left, got %+v", tokens)
+	}
+}
@@ -6,13 +6,102 @@ type ServerConfig struct {
 	Nickname      string    `json:"nickname"`
 	WatchtowerURL string    `json:"watchtower_url"`
 	Token         string    `json:"token"`
+	AgentURL      string    `json:"agent_url,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
 	IsActive      bool      `json:"is_active"`
+	// LastMetrics is the snapshot shown by the previous /metrics, for deltas
+	LastMetrics *MetricsSnapshot `json:"last_metrics,omitempty"`
+	// Schedule, if set, has the bot trigger updates itself
+	Schedule *UpdateSchedule `json:"schedule,omitempty"`
+	// HookID names the server in /hooks/watchtower/<id>; empty disables the webhook
+	HookID string `json:"hook_id,omitempty"`
+	// HookSecretHash is the hex SHA-256 of the webhook secret, which is never stored
+	HookSecretHash string `json:"hook_secret_hash,omitempty"`
+}
+
+// UpdateSchedule is a bot-owned update schedule for one server
+type UpdateSchedule struct {
+	// Cron is a 5-field cron expression or a descriptor such as @daily
+	Cron string `json:"cron"`
+	// Timezone is an IANA zone name; empty means UTC
+	Timezone string `json:"timezone,omitempty"`
+	// Window restricts runs to "HH:MM-HH:MM" in Timezone; empty means any time
+	Window  string    `json:"window,omitempty"`
+	NextRun time.Time `json:"next_run,omitempty"`
+	LastRun time.Time `json:"last_run,omitempty"`
+	// Owner is the user the schedule runs as and reports to
+	Owner int64 `json:"owner,omitempty"`
+}
+
+// ScheduledServer identifies a server with a schedule
+type ScheduledServer struct {
+	Workspace string
+	// UserID is the schedule's owner, or the workspace's creator for
+	// schedules saved before owners were recorded
+	UserID   int64
+	Nickname string
+	Schedule UpdateSchedule
+}
+
+// MetricsSnapshot records Watchtower's scan statistics at a point in time
+type MetricsSnapshot struct {
+	Scanned      int       `json:"scanned"`
+	Updated      int       `json:"updated"`
+	Failed       int       `json:"failed"`
+	ScansTotal   int       `json:"scans_total"`
+	ScansSkipped int       `json:"scans_skipped"`
+	TakenAt      time.Time `json:"taken_at"`
 }
 
 type User struct {
-	TelegramID    int64                    `json:"telegram_id"`
-	Servers       map[string]*ServerConfig `json:"servers"`
-	CurrentServer string                   `json:"current_server"`
-	CreatedAt     time.Time                `json:"created_at"`
+	TelegramID int64 `json:"telegram_id"`
+	// Workspace is the ID of the active workspace; CurrentServer is one of its servers
+	Workspace     string    `json:"workspace,omitempty"`
+	CurrentServer string    `json:"current_server"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Servers and Freezes predate workspaces. They are only read to move
+	// them into the user's personal workspace; see ServerManager.Load.
+	Servers map[string]*ServerConfig `json:"servers,omitempty"`
+	Freezes []Freeze                 `json:"freezes,omitempty"`
+}
+
+// Workspace owns servers and their freezes, history and webhooks. Every
+// member sees the same servers, while each keeps their own current server.
+// A user's personal workspace has their Telegram ID as its ID.
+type Workspace struct {
+	ID      string                   `json:"id"`
+	Name    string                   `json:"name"`
+	Servers map[string]*ServerConfig `json:"servers,omitempty"`
+	// Members are Telegram user IDs in ascending order
+	Members []int64 `json:"members"`
+	// Freezes block updates; see Freeze
+	Freezes   []Freeze  `json:"freezes,omitempty"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Member is an entry of the access list. Role is interpreted by the access
+// package; servers only stores it.
+type Member struct {
+	UserID  int64     `json:"user_id"`
+	Role    string    `json:"role"`
+	AddedBy int64     `json:"added_by,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// APIToken is a personal token for scripts and CI pipelines. Only a SHA-256
+// hash of the token is stored. Actions are access package action names; the
+// token can never do more than its user's role allows.
+type APIToken struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	UserID    int64  `json:"user_id"`
+	Workspace string `json:"workspace"`
+	Hash      string `json:"hash"`
+	// Servers limits the token to these servers; empty means every server of the workspace
+	Servers   []string  `json:"servers,omitempty"`
+	Actions   []string  `json:"actions"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used,omitempty"`
 }
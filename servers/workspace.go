@@ -0,0 +1,441 @@
+package servers
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// PersonalWorkspaceName is how every user's personal workspace is shown
+const PersonalWorkspaceName = "personal"
+
+var (
+	ErrWorkspaceExists     = errors.New("workspace with this name already exists")
+	ErrInvalidWorkspace    = errors.New("workspace name must be 1-32 characters: letters, digits, '-', '_' or '.', not only digits, and not \"personal\"")
+	ErrPersonalWorkspace   = errors.New("personal workspaces can't be shared; create a team workspace instead")
+	ErrNotWorkspaceMember  = errors.New("user is not a member of this workspace")
+	ErrLastWorkspaceMember = errors.New("a workspace needs at least one member")
+)
+
+// ValidateWorkspaceName reports whether name can be used for a team workspace.
+// All-digit names are reserved for personal workspaces.
+func ValidateWorkspaceName(name string) error {
+	if !nicknamePattern.MatchString(name) || name == PersonalWorkspaceName {
+		return ErrInvalidWorkspace
+	}
+	if _, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return ErrInvalidWorkspace
+	}
+	return nil
+}
+
+// Personal reports whether ws is its creator's personal workspace
+func (ws *Workspace) Personal() bool {
+	return ws.ID == personalWorkspaceID(ws.CreatedBy)
+}
+
+// HasMember reports whether userID is a member of ws
+func (ws *Workspace) HasMember(userID int64) bool {
+	i := sort.Search(len(ws.Members), func(i int) bool { return ws.Members[i] >= userID })
+	return i < len(ws.Members) && ws.Members[i] == userID
+}
+
+// personalWorkspaceID is the ID of userID's personal workspace
+func personalWorkspaceID(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+// CurrentWorkspace returns the workspace userID is working in. Its server
+// tokens stay encrypted.
+func (sm *ServerManager) CurrentWorkspace(userID int64) (*Workspace, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ws := sm.activeWorkspace(userID)
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	return copyWorkspace(ws), nil
+}
+
+// WorkspaceID returns the ID of the workspace userID is working in, or "" if
+// they have none yet
+func (sm *ServerManager) WorkspaceID(userID int64) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if ws := sm.activeWorkspace(userID); ws != nil {
+		return ws.ID
+	}
+	return ""
+}
+
+// Workspaces lists the workspaces userID belongs to, personal first
+func (sm *ServerManager) Workspaces(userID int64) []*Workspace {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var list []*Workspace
+	for _, ws := range sm.workspaces {
+		if ws.HasMember(userID) {
+			list = append(list, copyWorkspace(ws))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Personal() != list[j].Personal() {
+			return list[i].Personal()
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// WorkspaceMembers returns the members of a workspace
+func (sm *ServerManager) WorkspaceMembers(workspaceID string) []int64 {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ws := sm.workspaces[workspaceID]
+	if ws == nil {
+		return nil
+	}
+	return append([]int64(nil), ws.Members...)
+}
+
+// IsWorkspaceMember reports whether userID belongs to a workspace
+func (sm *ServerManager) IsWorkspaceMember(workspaceID string, userID int64) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ws := sm.workspaces[workspaceID]
+	return ws != nil && ws.HasMember(userID)
+}
+
+// CreateWorkspace creates a team workspace with userID as its only member and
+// switches userID to it
+func (sm *ServerManager) CreateWorkspace(userID int64, name string) (*Workspace, error) {
+	if err := ValidateWorkspaceName(name); err != nil {
+		return nil, err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.workspaces[name]; exists {
+		return nil, ErrWorkspaceExists
+	}
+
+	ws := &Workspace{
+		ID:        name,
+		Name:      name,
+		Servers:   make(map[string]*ServerConfig),
+		Members:   []int64{userID},
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	if err := sm.store.UpsertWorkspace(ws); err != nil {
+		return nil, err
+	}
+	sm.workspaces[ws.ID] = ws
+
+	if err := sm.setCurrent(userID, ws, ""); err != nil {
+		return nil, err
+	}
+	return copyWorkspace(ws), nil
+}
+
+// SwitchWorkspace makes one of userID's workspaces, by name, the one they
+// work in. Their current server becomes its first server.
+func (sm *ServerManager) SwitchWorkspace(userID int64, name string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var ws *Workspace
+	if name == PersonalWorkspaceName {
+		var err error
+		if ws, err = sm.personalWorkspace(userID); err != nil {
+			return err
+		}
+	} else if ws = sm.workspaces[name]; ws == nil || !ws.HasMember(userID) || ws.Personal() {
+		return ErrWorkspaceNotFound
+	}
+
+	current := ""
+	if names := serverNames(ws); len(names) > 0 {
+		current = names[0]
+	}
+	return sm.setCurrent(userID, ws, current)
+}
+
+// AddWorkspaceMember shares userID's current workspace with memberID
+func (sm *ServerManager) AddWorkspaceMember(userID, memberID int64) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws := sm.activeWorkspace(userID)
+	if ws == nil || ws.Personal() {
+		return ErrPersonalWorkspace
+	}
+	if ws.HasMember(memberID) {
+		return nil
+	}
+
+	members := append(append([]int64(nil), ws.Members...), memberID)
+	sort.Slice(members, func(i, j int) bool { return members[i] < members[j] })
+	return sm.setMembers(ws, members)
+}
+
+// RemoveWorkspaceMember removes memberID, possibly userID themselves, from
+// userID's current workspace. memberID falls back to their personal workspace.
+func (sm *ServerManager) RemoveWorkspaceMember(userID, memberID int64) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ws := sm.activeWorkspace(userID)
+	if ws == nil || ws.Personal() {
+		return ErrPersonalWorkspace
+	}
+	if !ws.HasMember(memberID) {
+		return ErrNotWorkspaceMember
+	}
+	if len(ws.Members) == 1 {
+		return ErrLastWorkspaceMember
+	}
+
+	var members []int64
+	for _, id := range ws.Members {
+		if id != memberID {
+			members = append(members, id)
+		}
+	}
+	if err := sm.setMembers(ws, members); err != nil {
+		return err
+	}
+	if err := sm.reassignSchedules(ws, memberID, userID); err != nil {
+		return err
+	}
+
+	if user := sm.users[memberID]; user != nil && user.Workspace == ws.ID {
+		return sm.setUser(memberID, "", "")
+	}
+	return nil
+}
+
+// reassignSchedules hands the schedules that ran as a departed member to
+// userID, or to the first remaining member when the member left on their own,
+// so they keep firing for somebody who can still see the results
+// (Caller must hold lock)
+func (sm *ServerManager) reassignSchedules(ws *Workspace, departed, userID int64) error {
+	heir := userID
+	if heir == departed {
+		heir = ws.Members[0]
+	}
+	for _, nickname := range serverNames(ws) {
+		schedule := ws.Servers[nickname].Schedule
+		if schedule == nil || scheduleOwner(ws, schedule) != departed {
+			continue
+		}
+		err := sm.mutateServer(ws, nickname, func(s *ServerConfig) error {
+			s.Schedule.Owner = heir
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeWorkspace returns the workspace userID works in: the one they chose
+// if they are still a member, otherwise their personal workspace, if any
+// (Caller must hold lock)
+func (sm *ServerManager) activeWorkspace(userID int64) *Workspace {
+	if user := sm.users[userID]; user != nil && user.Workspace != "" {
+		if ws := sm.workspaces[user.Workspace]; ws != nil && ws.HasMember(userID) {
+			return ws
+		}
+	}
+	return sm.workspaces[personalWorkspaceID(userID)]
+}
+
+// ensureWorkspace returns userID's active workspace, creating their personal
+// workspace if they have none (Caller must hold lock)
+func (sm *ServerManager) ensureWorkspace(userID int64) (*Workspace, error) {
+	if ws := sm.activeWorkspace(userID); ws != nil {
+		return ws, nil
+	}
+	ws, err := sm.personalWorkspace(userID)
+	if err != nil {
+		return nil, err
+	}
+	return ws, sm.setCurrent(userID, ws, "")
+}
+
+// personalWorkspace returns userID's personal workspace, creating it if
+// needed (Caller must hold lock)
+func (sm *ServerManager) personalWorkspace(userID int64) (*Workspace, error) {
+	if ws := sm.workspaces[personalWorkspaceID(userID)]; ws != nil {
+		return ws, nil
+	}
+
+	ws := newPersonalWorkspace(userID, time.Now())
+	if err := sm.store.UpsertWorkspace(ws); err != nil {
+		return nil, err
+	}
+	sm.workspaces[ws.ID] = ws
+	return ws, nil
+}
+
+func newPersonalWorkspace(userID int64, createdAt time.Time) *Workspace {
+	return &Workspace{
+		ID:        personalWorkspaceID(userID),
+		Name:      PersonalWorkspaceName,
+		Servers:   make(map[string]*ServerConfig),
+		Members:   []int64{userID},
+		CreatedBy: userID,
+		CreatedAt: createdAt,
+	}
+}
+
+// selectedServer returns the server userID chose in ws, or "" if they chose
+// none there or it is gone (Caller must hold lock)
+func (sm *ServerManager) selectedServer(userID int64, ws *Workspace) string {
+	user := sm.users[userID]
+	if user == nil || user.Workspace != ws.ID || ws.Servers[user.CurrentServer] == nil {
+		return ""
+	}
+	return user.CurrentServer
+}
+
+// currentServer returns userID's current server in ws, defaulting to its
+// first server (Caller must hold lock)
+func (sm *ServerManager) currentServer(userID int64, ws *Workspace) string {
+	if current := sm.selectedServer(userID, ws); current != "" {
+		return current
+	}
+	if names := serverNames(ws); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// setCurrent makes ws userID's workspace and nickname their current server
+// (Caller must hold lock)
+func (sm *ServerManager) setCurrent(userID int64, ws *Workspace, nickname string) error {
+	return sm.setUser(userID, ws.ID, nickname)
+}
+
+// setUser writes userID's workspace and current server through to the store,
+// creating the user if needed (Caller must hold lock)
+func (sm *ServerManager) setUser(userID int64, workspaceID, nickname string) error {
+	updated := &User{TelegramID: userID, CreatedAt: time.Now()}
+	if user := sm.users[userID]; user != nil {
+		updated = copyUser(user)
+	}
+	updated.Workspace = workspaceID
+	updated.CurrentServer = nickname
+
+	if err := sm.store.UpsertUser(updated); err != nil {
+		return err
+	}
+	sm.users[userID] = updated
+	return nil
+}
+
+// retargetCurrent moves every member of ws whose current server is from to
+// to (Caller must hold lock)
+func (sm *ServerManager) retargetCurrent(ws *Workspace, from, to string) error {
+	for _, memberID := range ws.Members {
+		user := sm.users[memberID]
+		if user == nil || user.Workspace != ws.ID || user.CurrentServer != from {
+			continue
+		}
+		if err := sm.setCurrent(memberID, ws, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMembers writes a workspace's members through to the store (Caller must hold lock)
+func (sm *ServerManager) setMembers(ws *Workspace, members []int64) error {
+	updated := *ws
+	updated.Members = members
+	if err := sm.store.UpsertWorkspace(&updated); err != nil {
+		return err
+	}
+	ws.Members = members
+	return nil
+}
+
+// serverNames lists a workspace's server nicknames alphabetically
+func serverNames(ws *Workspace) []string {
+	names := make([]string, 0, len(ws.Servers))
+	for nickname := range ws.Servers {
+		names = append(names, nickname)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// migrateToWorkspaces moves servers and freezes still stored on users into
+// their personal workspaces. It is safe to re-run after a partial failure.
+// (Caller must hold lock)
+func (sm *ServerManager) migrateToWorkspaces() error {
+	for userID, user := range sm.users {
+		if len(user.Servers) == 0 && len(user.Freezes) == 0 {
+			continue
+		}
+
+		ws := sm.workspaces[personalWorkspaceID(userID)]
+		if ws == nil {
+			ws = newPersonalWorkspace(userID, user.CreatedAt)
+		}
+
+		// Freezes keep their IDs; skip the ones a previous attempt already moved
+		freezes := copyFreezes(ws.Freezes)
+		for _, f := range user.Freezes {
+			moved := false
+			for _, existing := range freezes {
+				moved = moved || existing.ID == f.ID
+			}
+			if !moved {
+				freezes = append(freezes, f)
+			}
+		}
+		updated := *ws
+		updated.Freezes = freezes
+		if err := sm.store.UpsertWorkspace(&updated); err != nil {
+			return err
+		}
+		ws.Freezes = freezes
+		sm.workspaces[ws.ID] = ws
+
+		for nickname, server := range user.Servers {
+			moved := copyServer(server)
+			if moved.Schedule != nil && moved.Schedule.Owner == 0 {
+				moved.Schedule.Owner = userID
+			}
+			if err := sm.store.UpsertServer(ws.ID, moved); err != nil {
+				return err
+			}
+			ws.Servers[nickname] = moved
+		}
+
+		migrated := copyUser(user)
+		migrated.Servers = nil
+		migrated.Freezes = nil
+		if migrated.Workspace == "" {
+			migrated.Workspace = ws.ID
+		}
+		if err := sm.store.UpsertUser(migrated); err != nil {
+			return err
+		}
+		sm.users[userID] = migrated
+
+		log.Printf("📦 Moved %d server(s) and %d freeze(s) of user %d into their personal workspace", len(user.Servers), len(user.Freezes), userID)
+	}
+	return nil
+}
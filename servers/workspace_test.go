@@ -0,0 +1,211 @@
+package servers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateWorkspaceName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"ops":      true,
+		"team-1":   true,
+		"":         false,
+		"12345":    false,
+		"personal": false,
+		"a b":      false,
+	} {
+		if err := ValidateWorkspaceName(name); (err == nil) != ok {
+			t.Errorf("ValidateWorkspaceName(%q) = %v", name, err)
+		}
+	}
+}
+
+func TestManagerWorkspaces(t *testing.T) {
+	sm := newTestManager(t)
+	sm.AddServer(1, "laptop", "https://l", "token")
+
+	ws, err := sm.CreateWorkspace(1, "ops")
+	if err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	if ws.ID != "ops" || ws.Personal() || !ws.HasMember(1) {
+		t.Fatalf("unexpected workspace: %+v", ws)
+	}
+	if _, err := sm.CreateWorkspace(2, "ops"); !errors.Is(err, ErrWorkspaceExists) {
+		t.Errorf("expected ErrWorkspaceExists, got %v", err)
+	}
+
+	// The creator now works in ops; their personal server is out of sight
+	sm.AddServer(1, "home", "https://h", "token")
+	sm.AddServer(1, "vps", "https://v", "token")
+	if names, _ := sm.ListServers(1); len(names) != 2 || names[0] != "home" {
+		t.Fatalf("expected ops servers, got %v", names)
+	}
+
+	if err := sm.AddWorkspaceMember(1, 2); err != nil {
+		t.Fatalf("AddWorkspaceMember: %v", err)
+	}
+	if err := sm.SwitchWorkspace(2, "ops"); err != nil {
+		t.Fatalf("SwitchWorkspace: %v", err)
+	}
+
+	// A server added once is visible to every member; current servers are per user
+	sm.SwitchServer(2, "vps")
+	if current, _ := sm.GetCurrentServer(1); current.Nickname != "home" {
+		t.Errorf("user 1 should still be on home, got %s", current.Nickname)
+	}
+	if current, _ := sm.GetCurrentServer(2); current.Nickname != "vps" || current.Token != "token" {
+		t.Errorf("user 2 should be on vps with a decrypted token, got %+v", current)
+	}
+
+	// Renames and removals follow every member
+	if err := sm.RenameServer(1, "vps", "edge"); err != nil {
+		t.Fatalf("RenameServer: %v", err)
+	}
+	if current, _ := sm.GetCurrentServer(2); current.Nickname != "edge" {
+		t.Errorf("expected user 2 moved to edge, got %s", current.Nickname)
+	}
+	if err := sm.RemoveServer(1, "edge"); err != nil {
+		t.Fatalf("RemoveServer: %v", err)
+	}
+	if current, _ := sm.GetCurrentServer(2); current.Nickname != "home" {
+		t.Errorf("expected user 2 moved to home, got %s", current.Nickname)
+	}
+
+	// Freezes belong to the workspace
+	if _, err := sm.AddFreeze(1, Freeze{Start: time.Now().Add(-time.Minute), End: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("AddFreeze: %v", err)
+	}
+	if err := sm.CheckUpdateAllowed(2, "home", time.Now()); !errors.Is(err, ErrFrozen) {
+		t.Errorf("expected a teammate's freeze to apply, got %v", err)
+	}
+	if err := sm.CheckUpdateAllowedIn("1", "laptop", time.Now()); err != nil {
+		t.Errorf("freeze leaked into the personal workspace: %v", err)
+	}
+
+	if err := sm.RemoveWorkspaceMember(2, 2); err != nil {
+		t.Fatalf("RemoveWorkspaceMember: %v", err)
+	}
+	if _, err := sm.ListServers(2); err == nil {
+		t.Error("expected a removed member to lose the workspace's servers")
+	}
+	if err := sm.RemoveWorkspaceMember(1, 1); !errors.Is(err, ErrLastWorkspaceMember) {
+		t.Errorf("expected ErrLastWorkspaceMember, got %v", err)
+	}
+	if err := sm.SwitchWorkspace(2, "ops"); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Errorf("expected ErrWorkspaceNotFound for a non-member, got %v", err)
+	}
+
+	if err := sm.SwitchWorkspace(1, PersonalWorkspaceName); err != nil {
+		t.Fatalf("SwitchWorkspace: %v", err)
+	}
+	if current, _ := sm.GetCurrentServer(1); current.Nickname != "laptop" {
+		t.Errorf("expected the personal server back, got %s", current.Nickname)
+	}
+	if err := sm.AddWorkspaceMember(1, 2); !errors.Is(err, ErrPersonalWorkspace) {
+		t.Errorf("expected ErrPersonalWorkspace, got %v", err)
+	}
+	if list := sm.Workspaces(1); len(list) != 2 || !list[0].Personal() || list[1].ID != "ops" {
+		t.Errorf("unexpected workspace list: %+v", list)
+	}
+}
+
+func TestRemoveWorkspaceMemberReassignsSchedules(t *testing.T) {
+	sm := newTestManager(t)
+	if _, err := sm.CreateWorkspace(1, "ops"); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	for _, id := range []int64{2, 3} {
+		if err := sm.AddWorkspaceMember(1, id); err != nil {
+			t.Fatalf("AddWorkspaceMember: %v", err)
+		}
+		if err := sm.SwitchWorkspace(id, "ops"); err != nil {
+			t.Fatalf("SwitchWorkspace: %v", err)
+		}
+	}
+	sm.AddServer(1, "home", "https://h", "token")
+	sm.AddServer(1, "vps", "https://v", "token")
+	sm.SetSchedule(2, "home", &UpdateSchedule{Cron: "@daily"})
+	sm.SetSchedule(3, "vps", &UpdateSchedule{Cron: "@daily"})
+
+	owners := func() map[string]int64 {
+		owners := make(map[string]int64)
+		for _, s := range sm.ScheduledServers() {
+			owners[s.Nickname] = s.UserID
+		}
+		return owners
+	}
+
+	// Removed by a teammate: the teammate takes the schedule over
+	if err := sm.RemoveWorkspaceMember(1, 2); err != nil {
+		t.Fatalf("RemoveWorkspaceMember: %v", err)
+	}
+	if got := owners(); got["home"] != 1 || got["vps"] != 3 {
+		t.Errorf("expected home to pass to user 1 only, got %v", got)
+	}
+
+	// Leaving on their own: a remaining member takes it over
+	if err := sm.RemoveWorkspaceMember(3, 3); err != nil {
+		t.Fatalf("RemoveWorkspaceMember: %v", err)
+	}
+	if got := owners(); got["home"] != 1 || got["vps"] != 1 {
+		t.Errorf("expected both schedules to run as user 1, got %v", got)
+	}
+	if sm.IsWorkspaceMember("ops", 3) || !sm.IsWorkspaceMember("ops", 1) {
+		t.Error("unexpected workspace membership")
+	}
+}
+
+func TestManagerMigratesToWorkspaces(t *testing.T) {
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			open := factory(t)
+			keys := mustKeyring(t, "key")
+			token, _ := keys.encrypt("secret")
+
+			// A user as stored before workspaces, with existing history
+			store := open()
+			store.UpsertUser(&User{
+				TelegramID:    7,
+				CurrentServer: "vps",
+				Servers: map[string]*ServerConfig{
+					"home": {Nickname: "home", Token: token, Schedule: &UpdateSchedule{Cron: "@daily"}},
+					"vps":  {Nickname: "vps", Token: token},
+				},
+				Freezes: []Freeze{{ID: "f1", Start: time.Now(), End: time.Now().Add(time.Hour)}},
+			})
+			store.AppendHistory("7", HistoryEntry{Server: "home", Status: "succeeded"})
+
+			if _, err := NewManager(keys, store); err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			store.Close()
+
+			// Reopen to check what was written, and that a second load is a no-op
+			store = open()
+			defer store.Close()
+			sm, err := NewManager(keys, store)
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+
+			user, _ := store.LoadUser(7)
+			if len(user.Servers) != 0 || len(user.Freezes) != 0 || user.Workspace != "7" {
+				t.Errorf("expected the user record moved out, got %+v", user)
+			}
+			if current, err := sm.GetCurrentServer(7); err != nil || current.Nickname != "vps" || current.Token != "secret" {
+				t.Errorf("expected current server vps to survive, got %+v, %v", current, err)
+			}
+			if freezes := sm.ListFreezes(7); len(freezes) != 1 || freezes[0].ID != "f1" {
+				t.Errorf("expected freeze f1 moved, got %+v", freezes)
+			}
+			if list := sm.ScheduledServers(); len(list) != 1 || list[0].UserID != 7 || list[0].Schedule.Owner != 7 {
+				t.Errorf("expected the schedule owned by user 7, got %+v", list)
+			}
+			if history, _ := sm.History(7, "", 0); len(history) != 1 {
+				t.Errorf("expected existing history in the personal workspace, got %+v", history)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+var (
+	// Open access is a convenience for the bot; never extend it to the web
+	errWebClosed      = errors.New("web access needs ADMIN_USER_ID or an access list")
+	errTokenScope     = fmt.Errorf("%w: outside the API token's scope", access.ErrForbidden)
+	errTokenWorkspace = fmt.Errorf("%w: the API token belongs to another workspace; use /api/servers/{nickname}/update or /status", access.ErrForbidden)
+)
+
+// caller is who a request acts as and in which workspace
+type caller struct {
+	UserID    int64
+	Workspace string
+	// Source is how the history records the caller's updates
+	Source string
+}
+
+// authorizeCaller checks that the request may perform action on nickname ("" for
+// requests not about one server). API tokens act in the workspace they were
+// issued for; terminal users act in their current workspace.
+func (s *WebServer) authorizeCaller(r *http.Request, action access.Action, nickname string) (caller, error) {
+	if raw := sessionToken(r); strings.HasPrefix(raw, servers.APITokenPrefix) {
+		return s.authorizeAPIToken(r, raw, action, nickname)
+	}
+
+	userID, err := s.authorizeUser(r, action)
+	if err != nil {
+		return caller{}, err
+	}
+	return caller{UserID: userID, Workspace: s.serverManager.WorkspaceID(userID), Source: servers.SourceWeb}, nil
+}
+
+// authorizeActive is authorizeCaller for handlers that work on the user's
+// current workspace, which an API token's workspace must then be
+func (s *WebServer) authorizeActive(r *http.Request, action access.Action, nickname string) (caller, error) {
+	c, err := s.authorizeCaller(r, action, nickname)
+	if err != nil {
+		return caller{}, err
+	}
+	if c.Workspace != s.serverManager.WorkspaceID(c.UserID) {
+		return caller{}, errTokenWorkspace
+	}
+	return c, nil
+}
+
+// authorize checks a request that is not about one server and returns its user
+func (s *WebServer) authorize(r *http.Request, action access.Action) (int64, error) {
+	c, err := s.authorizeActive(r, action, "")
+	return c.UserID, err
+}
+
+func (s *WebServer) authorizeAPIToken(r *http.Request, raw string, action access.Action, nickname string) (caller, error) {
+	if s.access.Open() {
+		return caller{}, errWebClosed
+	}
+
+	token, err := s.serverManager.AuthenticateAPIToken(raw)
+	if err != nil {
+		log.Printf("⛔ API request from %s refused: %v", r.RemoteAddr, err)
+		return caller{}, err
+	}
+	// A server-scoped token can't call endpoints that span every server
+	if !token.Allows(string(action)) || (nickname == "" && len(token.Servers) > 0) || !token.Covers(nickname) {
+		log.Printf("⛔ API token %s of user %d denied %s on %q", token.ID, token.UserID, action, nickname)
+		return caller{}, errTokenScope
+	}
+	// The token never outlives its user's role
+	if err := s.access.Check(token.UserID, action); err != nil {
+		log.Printf("⛔ API token %s of user %d denied %s: %v", token.ID, token.UserID, action, err)
+		return caller{}, err
+	}
+	return caller{UserID: token.UserID, Workspace: token.Workspace, Source: servers.SourceAPI}, nil
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+func TestAPITokenScope(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"updated": ["web"], "failed": []}`))
+	}))
+	defer watchtower.Close()
+
+	api := newTestAPI(t)
+	owner := api.login(42)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "`+watchtower.URL+`", "token": "t"}`), http.StatusCreated)
+	api.expect(api.do(owner, "POST", "/api/servers/vps", `{"url": "`+watchtower.URL+`", "token": "t"}`), http.StatusCreated)
+
+	ci, _, err := api.server.serverManager.CreateAPIToken(42, "ci", []string{"home"}, []string{"update"})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	api.expect(api.do(ci, "POST", "/api/servers/home/update", ""), http.StatusOK)
+	api.expect(api.do(ci, "POST", "/api/servers/vps/update", ""), http.StatusForbidden)
+	api.expect(api.do(ci, "POST", "/api/update", ""), http.StatusForbidden)
+	api.expect(api.do(ci, "GET", "/api/servers/home", ""), http.StatusForbidden)
+	api.expect(api.do(ci, "DELETE", "/api/servers/home", ""), http.StatusForbidden)
+	api.expect(api.do(ci, "GET", "/api/servers", ""), http.StatusForbidden)
+	api.expect(api.do(ci+"x", "POST", "/api/servers/home/update", ""), http.StatusUnauthorized)
+	api.expect(api.do("wtm_0000000000000000_nope", "POST", "/api/servers/home/update", ""), http.StatusUnauthorized)
+
+	entries, err := api.server.serverManager.History(42, "home", 10)
+	if err != nil || len(entries) != 1 || entries[0].Source != servers.SourceAPI || entries[0].TriggeredBy != 42 {
+		t.Errorf("expected one API update in the history, got %+v (%v)", entries, err)
+	}
+
+	reader, readerToken, err := api.server.serverManager.CreateAPIToken(42, "reader", nil, []string{"view"})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	api.expect(api.do(reader, "GET", "/api/servers", ""), http.StatusOK)
+	api.expect(api.do(reader, "GET", "/api/servers/vps", ""), http.StatusOK)
+	api.expect(api.do(reader, "POST", "/api/servers/vps/update", ""), http.StatusForbidden)
+
+	// Revoking ends the token at once
+	if err := api.server.serverManager.RevokeAPIToken(42, readerToken.ID); err != nil {
+		t.Fatalf("RevokeAPIToken: %v", err)
+	}
+	api.expect(api.do(reader, "GET", "/api/servers", ""), http.StatusUnauthorized)
+}
+
+func TestAPITokenWorkspace(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/metrics" {
+			w.Write([]byte("watchtower_containers_scanned 3\n"))
+			return
+		}
+		w.Write([]byte(`{"updated": [], "failed": []}`))
+	}))
+	defer watchtower.Close()
+
+	api := newTestAPI(t)
+	owner := api.login(42)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "`+watchtower.URL+`", "token": "t"}`), http.StatusCreated)
+
+	ci, _, err := api.server.serverManager.CreateAPIToken(42, "ci", nil, []string{"update", "view"})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if _, err := api.server.serverManager.CreateWorkspace(42, "team"); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	if err := api.server.serverManager.SwitchWorkspace(42, "team"); err != nil {
+		t.Fatalf("SwitchWorkspace: %v", err)
+	}
+
+	// The token keeps updating the workspace it was issued for...
+	api.expect(api.do(ci, "POST", "/api/servers/home/update", ""), http.StatusOK)
+	api.expect(api.do(ci, "GET", "/api/servers/home/status", ""), http.StatusOK)
+	// ...but can't act on the user's current workspace
+	api.expect(api.do(ci, "GET", "/api/servers", ""), http.StatusForbidden)
+	api.expect(api.do(ci, "GET", "/api/servers/home", ""), http.StatusForbidden)
+
+	entries, err := api.server.serverManager.History(42, "home", 10)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("the team workspace should have no history, got %+v (%v)", entries, err)
+	}
+}
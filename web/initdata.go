@@ -0,0 +1,148 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInitDataMaxAge is how long Telegram WebApp initData stays valid
+const DefaultInitDataMaxAge = time.Hour
+
+// maxClockSkew tolerates an auth_date slightly ahead of our clock
+const maxClockSkew = time.Minute
+
+var (
+	errMissingInitData  = errors.New("missing initData")
+	errInvalidInitData  = errors.New("invalid initData signature")
+	errExpiredInitData  = errors.New("initData expired, reopen the terminal")
+	errReplayedInitData = errors.New("initData already used for a change, reopen the terminal")
+)
+
+// initData is a verified Telegram WebApp launch payload
+type initData struct {
+	UserID   int64
+	AuthDate time.Time
+	Hash     string
+}
+
+// initDataVerifier checks the WebApp initData signature and freshness, and
+// remembers which payloads were spent on state-changing requests
+type initDataVerifier struct {
+	secret []byte
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	used map[string]time.Time // hash -> when the payload expires
+}
+
+func newInitDataVerifier(botToken string, maxAge time.Duration) *initDataVerifier {
+	if maxAge <= 0 {
+		maxAge = DefaultInitDataMaxAge
+	}
+	return &initDataVerifier{
+		secret: hmacSHA256([]byte("WebAppData"), []byte(botToken)),
+		maxAge: maxAge,
+		now:    time.Now,
+		used:   make(map[string]time.Time),
+	}
+}
+
+// verify parses raw initData and checks its hash and auth_date, see
+// https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func (v *initDataVerifier) verify(raw string) (*initData, error) {
+	if raw == "" {
+		return nil, errMissingInitData
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return nil, errInvalidInitData
+	}
+	// A repeated field would be signed under one value and read under another
+	for _, vs := range values {
+		if len(vs) != 1 {
+			return nil, errInvalidInitData
+		}
+	}
+
+	hash, err := hex.DecodeString(values.Get("hash"))
+	if err != nil || len(hash) != sha256.Size {
+		return nil, errInvalidInitData
+	}
+	expected := hmacSHA256(v.secret, []byte(buildDataCheckString(values)))
+	if !hmac.Equal(hash, expected) {
+		return nil, errInvalidInitData
+	}
+
+	// Only signed fields are read from here on
+	seconds, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth_date: %w", err)
+	}
+	authDate := time.Unix(seconds, 0)
+	now := v.now()
+	if authDate.After(now.Add(maxClockSkew)) || now.Sub(authDate) > v.maxAge {
+		return nil, errExpiredInitData
+	}
+
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return nil, errors.New("initData has no user")
+	}
+
+	return &initData{UserID: user.ID, AuthDate: authDate, Hash: hex.EncodeToString(hash)}, nil
+}
+
+// spend marks data as used for a state-changing request. A payload can be
+// spent once; anyone replaying it afterwards is refused until it expires.
+func (v *initDataVerifier) spend(data *initData) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	for hash, expires := range v.used {
+		if now.After(expires) {
+			delete(v.used, hash)
+		}
+	}
+
+	if _, seen := v.used[data.Hash]; seen {
+		return errReplayedInitData
+	}
+	v.used[data.Hash] = data.AuthDate.Add(v.maxAge)
+	return nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func buildDataCheckString(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if k != "hash" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, values.Get(k)))
+	}
+	return strings.Join(pairs, "\n")
+}
@@ -0,0 +1,196 @@
+package web
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+const testBotToken = "123456:TEST-token"
+
+// signInitData builds initData as Telegram would, signed with token
+func signInitData(token string, fields map[string]string) string {
+	values := url.Values{}
+	for k, v := range fields {
+		values.Set(k, v)
+	}
+	secret := hmacSHA256([]byte("WebAppData"), []byte(token))
+	values.Set("hash", hex.EncodeToString(hmacSHA256(secret, []byte(buildDataCheckString(values)))))
+	return values.Encode()
+}
+
+func launchFields(userID int64, authDate time.Time) map[string]string {
+	return map[string]string{
+		"query_id":  "AAHdF6IQAAAAAN0XohDhrOrc",
+		"user":      `{"id":` + strconv.FormatInt(userID, 10) + `,"first_name":"Ada"}`,
+		"auth_date": strconv.FormatInt(authDate.Unix(), 10),
+	}
+}
+
+func newTestVerifier(now time.Time) *initDataVerifier {
+	v := newInitDataVerifier(testBotToken, time.Hour)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestVerifyInitData(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now)
+
+	data, err := v.verify(signInitData(testBotToken, launchFields(42, now.Add(-time.Minute))))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if data.UserID != 42 || !data.AuthDate.Equal(now.Add(-time.Minute)) {
+		t.Errorf("unexpected payload: %+v", data)
+	}
+}
+
+func TestVerifyInitDataRejectsTampering(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now)
+	valid := signInitData(testBotToken, launchFields(42, now))
+
+	tamper := func(field, value string) string {
+		values, _ := url.ParseQuery(valid)
+		values.Set(field, value)
+		return values.Encode()
+	}
+
+	cases := map[string]string{
+		"empty":          "",
+		"unsigned":       strings.Replace(valid, "hash=", "nohash=", 1),
+		"forged user":    tamper("user", `{"id":1,"first_name":"Admin"}`),
+		"moved auth":     tamper("auth_date", strconv.FormatInt(now.Unix()+30, 10)),
+		"extra field":    tamper("start_param", "x"),
+		"short hash":     tamper("hash", "abcd"),
+		"non-hex hash":   tamper("hash", strings.Repeat("zz", 32)),
+		"wrong token":    signInitData("654321:OTHER", launchFields(42, now)),
+		"duplicate user": valid + "&user=" + url.QueryEscape(`{"id":1}`),
+	}
+	for name, raw := range cases {
+		if _, err := v.verify(raw); err == nil {
+			t.Errorf("%s: expected verify to fail", name)
+		}
+	}
+}
+
+func TestVerifyInitDataFreshness(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now)
+
+	cases := map[string]struct {
+		authDate time.Time
+		err      error
+	}{
+		"edge of window": {now.Add(-time.Hour), nil},
+		"stale":          {now.Add(-time.Hour - time.Second), errExpiredInitData},
+		"small skew":     {now.Add(30 * time.Second), nil},
+		"future":         {now.Add(time.Hour), errExpiredInitData},
+	}
+	for name, c := range cases {
+		_, err := v.verify(signInitData(testBotToken, launchFields(42, c.authDate)))
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got %v, want %v", name, err, c.err)
+		}
+	}
+
+	// A signed payload without a user is useless
+	fields := launchFields(42, now)
+	delete(fields, "user")
+	if _, err := v.verify(signInitData(testBotToken, fields)); err == nil {
+		t.Error("expected initData without a user to fail")
+	}
+}
+
+func TestSpendInitData(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now)
+
+	data, err := v.verify(signInitData(testBotToken, launchFields(42, now)))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := v.spend(data); err != nil {
+		t.Fatalf("first spend: %v", err)
+	}
+	if err := v.spend(data); !errors.Is(err, errReplayedInitData) {
+		t.Errorf("expected errReplayedInitData, got %v", err)
+	}
+
+	// Spent payloads are forgotten once they could no longer verify anyway
+	v.now = func() time.Time { return now.Add(2 * time.Hour) }
+	v.spend(&initData{Hash: "other", AuthDate: v.now()})
+	if _, remembered := v.used[data.Hash]; remembered {
+		t.Error("expected the expired hash to be pruned")
+	}
+}
+
+// newTestServer returns a server where 42 is the owner and 7 a viewer
+func newTestServer(t *testing.T) *WebServer {
+	t.Helper()
+	keys, err := servers.NewKeyring("test-key")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	mgr, err := servers.NewManager(keys, servers.NewJSONStore(filepath.Join(t.TempDir(), "servers.json")))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	acl := access.NewController(mgr, 42)
+	if err := acl.Grant(42, 7, access.RoleViewer); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	return NewServer(mgr, acl, testBotToken, time.Hour, time.Minute)
+}
+
+func TestAuthorizeInitData(t *testing.T) {
+	s := newTestServer(t)
+	request := func(userID int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/update", nil)
+		req.Header.Set("X-TG-INIT-DATA", signInitData(testBotToken, launchFields(userID, time.Now())))
+		w := httptest.NewRecorder()
+		if _, err := s.authorize(req, access.ActionUpdate); err != nil {
+			authError(w, err)
+		}
+		return w
+	}
+
+	// The owner's payload is good for one change; a replay is refused
+	req := httptest.NewRequest("GET", "/api/update", nil)
+	req.Header.Set("X-TG-INIT-DATA", signInitData(testBotToken, launchFields(42, time.Now())))
+	if _, err := s.authorize(req, access.ActionView); err != nil {
+		t.Fatalf("view: %v", err)
+	}
+	if _, err := s.authorize(req, access.ActionView); err != nil {
+		t.Fatalf("views may reuse initData: %v", err)
+	}
+	if _, err := s.authorize(req, access.ActionUpdate); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := s.authorize(req, access.ActionUpdate); !errors.Is(err, errReplayedInitData) {
+		t.Errorf("expected a replayed update to fail, got %v", err)
+	}
+
+	if w := request(7); w.Code != 403 {
+		t.Errorf("viewer update: expected 403, got %d", w.Code)
+	}
+	if w := request(99); w.Code != 401 {
+		t.Errorf("stranger update: expected 401, got %d", w.Code)
+	}
+
+	forged := httptest.NewRequest("GET", "/api/update", nil)
+	forged.Header.Set("X-TG-INIT-DATA", "user="+url.QueryEscape(`{"id":42}`)+"&auth_date=1&hash=00")
+	if _, err := s.authorize(forged, access.ActionUpdate); !errors.Is(err, errInvalidInitData) {
+		t.Errorf("expected a forged payload to fail, got %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// maxBodySize caps JSON request bodies
+const maxBodySize = 64 << 10
+
+var errNoServers = errors.New("no servers configured")
+
+// serverView is a server as the API shows it; the token never leaves the bot
+type serverView struct {
+	Nickname      string    `json:"nickname"`
+	WatchtowerURL string    `json:"watchtower_url"`
+	AgentURL      string    `json:"agent_url,omitempty"`
+	IsActive      bool      `json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+	Scheduled     bool      `json:"scheduled"`
+	Webhook       bool      `json:"webhook"`
+}
+
+// serverRequest is the body of POST and PUT /api/servers/{nickname}. On PUT
+// every field is optional and Nickname renames the server.
+type serverRequest struct {
+	Nickname *string `json:"nickname"`
+	URL      *string `json:"url"`
+	Token    *string `json:"token"`
+	AgentURL *string `json:"agent_url"`
+}
+
+// apiError writes the JSON error envelope {"error": "...", "code": "not_found"}
+func apiError(w http.ResponseWriter, status int, err error) {
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	jsonResponse(w, map[string]string{"error": err.Error(), "code": code}, status)
+}
+
+// errorStatus maps a manager or Watchtower error to an HTTP status
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, servers.ErrServerNotFound), errors.Is(err, errNoServers):
+		return http.StatusNotFound
+	case errors.Is(err, servers.ErrServerExists):
+		return http.StatusConflict
+	case errors.Is(err, servers.ErrInvalidName), errors.Is(err, servers.ErrInvalidURL):
+		return http.StatusBadRequest
+	case errors.Is(err, servers.ErrFrozen):
+		return http.StatusLocked
+	case errors.Is(err, api.ErrTimeout):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// allowMethod answers 405 unless r uses one of methods
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	apiError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed here", r.Method))
+	return false
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+// validateURL names the body field a bad URL came from
+func validateURL(field, raw string) error {
+	if err := servers.ValidateURL(raw); err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	return nil
+}
+
+// handleAPIServer serves /api/servers/{nickname}[/switch|/update|/status]
+func (s *WebServer) handleAPIServer(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/servers/"), "/")
+	if len(parts) > 2 || parts[0] == "" {
+		apiError(w, http.StatusNotFound, errors.New("no such endpoint"))
+		return
+	}
+	nickname := parts[0]
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch action {
+	case "":
+		if !allowMethod(w, r, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			s.serverGet(w, r, nickname)
+		case http.MethodPost:
+			s.serverCreate(w, r, nickname)
+		case http.MethodPut:
+			s.serverEdit(w, r, nickname)
+		case http.MethodDelete:
+			s.serverDelete(w, r, nickname)
+		}
+	case "switch":
+		if allowMethod(w, r, http.MethodPost) {
+			s.serverSwitch(w, r, nickname)
+		}
+	case "update":
+		if allowMethod(w, r, http.MethodPost) {
+			// An API token updates its own workspace's servers, whichever
+			// workspace its user has switched to since
+			if c, err := s.authorizeCaller(r, access.ActionUpdate, nickname); err != nil {
+				authError(w, err)
+			} else {
+				s.triggerUpdate(w, r, c, nickname)
+			}
+		}
+	case "status":
+		if allowMethod(w, r, http.MethodGet) {
+			s.serverStatus(w, r, nickname)
+		}
+	default:
+		apiError(w, http.StatusNotFound, errors.New("no such endpoint"))
+	}
+}
+
+// authorizeAPI checks action on one of the user's current servers; it answers
+// the request itself on failure
+func (s *WebServer) authorizeAPI(w http.ResponseWriter, r *http.Request, action access.Action, nickname string) (int64, bool) {
+	c, err := s.authorizeActive(r, action, nickname)
+	if err != nil {
+		authError(w, err)
+		return 0, false
+	}
+	return c.UserID, true
+}
+
+// view renders one of the user's servers
+func (s *WebServer) view(userID int64, nickname string) (*serverView, error) {
+	server, err := s.serverManager.GetServer(userID, nickname)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := s.serverManager.GetCurrentServer(userID)
+	return &serverView{
+		Nickname:      server.Nickname,
+		WatchtowerURL: server.WatchtowerURL,
+		AgentURL:      server.AgentURL,
+		IsActive:      current != nil && current.Nickname == server.Nickname,
+		CreatedAt:     server.CreatedAt,
+		Scheduled:     server.Schedule != nil,
+		Webhook:       server.HookID != "",
+	}, nil
+}
+
+func (s *WebServer) serverGet(w http.ResponseWriter, r *http.Request, nickname string) {
+	userID, ok := s.authorizeAPI(w, r, access.ActionView, nickname)
+	if !ok {
+		return
+	}
+	v, err := s.view(userID, nickname)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	jsonResponse(w, v, http.StatusOK)
+}
+
+func (s *WebServer) serverCreate(w http.ResponseWriter, r *http.Request, nickname string) {
+	userID, ok := s.authorizeAPI(w, r, access.ActionManage, nickname)
+	if !ok {
+		return
+	}
+
+	var req serverRequest
+	if err := decodeJSON(r, &req); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Nickname != nil && *req.Nickname != nickname {
+		apiError(w, http.StatusBadRequest, errors.New("nickname in the body differs from the URL"))
+		return
+	}
+	if req.URL == nil || req.Token == nil || *req.Token == "" {
+		apiError(w, http.StatusBadRequest, errors.New("url and token are required"))
+		return
+	}
+	if err := validateURL("url", *req.URL); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.AgentURL != nil && *req.AgentURL != "" {
+		if err := validateURL("agent_url", *req.AgentURL); err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := s.serverManager.AddServer(userID, nickname, *req.URL, *req.Token); err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	if req.AgentURL != nil && *req.AgentURL != "" {
+		if err := s.serverManager.UpdateServerAgentURL(userID, nickname, *req.AgentURL); err != nil {
+			apiError(w, errorStatus(err), err)
+			return
+		}
+	}
+	log.Printf("🌐 TWA user %d added server %s", userID, nickname)
+
+	v, err := s.view(userID, nickname)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", "/api/servers/"+url.PathEscape(nickname))
+	jsonResponse(w, v, http.StatusCreated)
+}
+
+func (s *WebServer) serverEdit(w http.ResponseWriter, r *http.Request, nickname string) {
+	userID, ok := s.authorizeAPI(w, r, access.ActionManage, nickname)
+	if !ok {
+		return
+	}
+
+	var req serverRequest
+	if err := decodeJSON(r, &req); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.URL != nil {
+		if err := validateURL("url", *req.URL); err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if req.AgentURL != nil && *req.AgentURL != "" {
+		if err := validateURL("agent_url", *req.AgentURL); err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if req.Token != nil && *req.Token == "" {
+		apiError(w, http.StatusBadRequest, errors.New("token can't be empty"))
+		return
+	}
+	if _, err := s.serverManager.GetServer(userID, nickname); err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+
+	// Rename last, so every other change applies under the old name
+	var err error
+	if req.URL != nil {
+		err = s.serverManager.UpdateServerURL(userID, nickname, *req.URL)
+	}
+	if err == nil && req.AgentURL != nil {
+		err = s.serverManager.UpdateServerAgentURL(userID, nickname, *req.AgentURL)
+	}
+	if err == nil && req.Token != nil {
+		err = s.serverManager.UpdateServerToken(userID, nickname, *req.Token)
+	}
+	if err == nil && req.Nickname != nil && *req.Nickname != nickname {
+		if err = s.serverManager.RenameServer(userID, nickname, *req.Nickname); err == nil {
+			nickname = *req.Nickname
+		}
+	}
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	log.Printf("🌐 TWA user %d edited server %s", userID, nickname)
+
+	v, err := s.view(userID, nickname)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	jsonResponse(w, v, http.StatusOK)
+}
+
+func (s *WebServer) serverDelete(w http.ResponseWriter, r *http.Request, nickname string) {
+	userID, ok := s.authorizeAPI(w, r, access.ActionManage, nickname)
+	if !ok {
+		return
+	}
+	if err := s.serverManager.RemoveServer(userID, nickname); err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	log.Printf("🌐 TWA user %d removed server %s", userID, nickname)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *WebServer) serverSwitch(w http.ResponseWriter, r *http.Request, nickname string) {
+	userID, ok := s.authorizeAPI(w, r, access.ActionView, nickname)
+	if !ok {
+		return
+	}
+	if err := s.serverManager.SwitchServer(userID, nickname); err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	v, err := s.view(userID, nickname)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	jsonResponse(w, v, http.StatusOK)
+}
+
+func (s *WebServer) serverStatus(w http.ResponseWriter, r *http.Request, nickname string) {
+	c, err := s.authorizeCaller(r, access.ActionView, nickname)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+	client, err := s.serverManager.GetAPIClientIn(c.Workspace, nickname)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		apiError(w, upstreamStatus(err), err)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"server": nickname, "status": status}, http.StatusOK)
+}
+
+// upstreamStatus is the status for a failed Watchtower call
+func upstreamStatus(err error) int {
+	if errors.Is(err, api.ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,201 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// testAPI is a test server's mux with a logged-in session per user
+type testAPI struct {
+	t      *testing.T
+	mux    *http.ServeMux
+	server *WebServer
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	s := newTestServer(t)
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+	return &testAPI{t: t, mux: mux, server: s}
+}
+
+// login exchanges fresh initData of userID for a session token
+func (a *testAPI) login(userID int64) string {
+	req := httptest.NewRequest("POST", "/api/session", nil)
+	req.Header.Set("X-TG-INIT-DATA", signInitData(testBotToken, launchFields(userID, time.Now())))
+	w := httptest.NewRecorder()
+	a.mux.ServeHTTP(w, req)
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Token == "" {
+		a.t.Fatalf("login %d: %d", userID, w.Code)
+	}
+	return body.Token
+}
+
+func (a *testAPI) do(token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	a.mux.ServeHTTP(w, req)
+	return w
+}
+
+// expect checks the status and, for errors, the JSON envelope
+func (a *testAPI) expect(w *httptest.ResponseRecorder, status int) {
+	a.t.Helper()
+	if w.Code != status {
+		a.t.Fatalf("expected %d, got %d: %s", status, w.Code, w.Body)
+	}
+	if status < 400 {
+		return
+	}
+	var envelope map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil || envelope["error"] == "" || envelope["code"] == "" {
+		a.t.Errorf("expected an error envelope, got %q (%v)", w.Body, err)
+	}
+}
+
+func TestServerCRUD(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.login(42)
+
+	api.expect(api.do(owner, "GET", "/api/servers/home", ""), http.StatusNotFound)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "https://home:8080"}`), http.StatusBadRequest)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "ftp://home", "token": "t"}`), http.StatusBadRequest)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "https://home", "token": "t", "extra": 1}`), http.StatusBadRequest)
+	api.expect(api.do(owner, "POST", "/api/servers/bad%20name", `{"url": "https://home", "token": "t"}`), http.StatusBadRequest)
+
+	w := api.do(owner, "POST", "/api/servers/home", `{"url": "https://home:8080", "token": "secret"}`)
+	api.expect(w, http.StatusCreated)
+	if w.Header().Get("Location") != "/api/servers/home" || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("unexpected create response: %v %s", w.Header(), w.Body)
+	}
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "https://home", "token": "t"}`), http.StatusConflict)
+	api.expect(api.do(owner, "POST", "/api/servers/vps", `{"url": "https://vps", "token": "t"}`), http.StatusCreated)
+
+	w = api.do(owner, "PUT", "/api/servers/vps", `{"nickname": "edge", "url": "https://edge", "agent_url": "http://edge:2375"}`)
+	api.expect(w, http.StatusOK)
+	var edited serverView
+	json.NewDecoder(w.Body).Decode(&edited)
+	if edited.Nickname != "edge" || edited.WatchtowerURL != "https://edge" || edited.AgentURL != "http://edge:2375" {
+		t.Errorf("unexpected edit result: %+v", edited)
+	}
+	api.expect(api.do(owner, "PUT", "/api/servers/vps", `{"url": "https://vps"}`), http.StatusNotFound)
+	api.expect(api.do(owner, "PUT", "/api/servers/edge", `{"nickname": "home"}`), http.StatusConflict)
+
+	w = api.do(owner, "POST", "/api/servers/edge/switch", "")
+	api.expect(w, http.StatusOK)
+	var switched serverView
+	json.NewDecoder(w.Body).Decode(&switched)
+	if !switched.IsActive {
+		t.Errorf("expected edge to be active: %+v", switched)
+	}
+
+	api.expect(api.do(owner, "DELETE", "/api/servers/edge", ""), http.StatusNoContent)
+	api.expect(api.do(owner, "DELETE", "/api/servers/edge", ""), http.StatusNotFound)
+
+	var list struct {
+		Servers []struct {
+			Nickname string `json:"nickname"`
+			IsActive bool   `json:"is_active"`
+		} `json:"servers"`
+	}
+	json.NewDecoder(api.do(owner, "GET", "/api/servers", "").Body).Decode(&list)
+	if len(list.Servers) != 1 || list.Servers[0].Nickname != "home" || !list.Servers[0].IsActive {
+		t.Errorf("unexpected server list: %+v", list)
+	}
+}
+
+func TestServerAPIMethodsAndRoles(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.login(42)
+	viewer := api.login(7)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "https://home", "token": "t"}`), http.StatusCreated)
+
+	w := api.do(owner, "GET", "/api/servers/home/update", "")
+	api.expect(w, http.StatusMethodNotAllowed)
+	if w.Header().Get("Allow") != "POST" {
+		t.Errorf("expected Allow: POST, got %q", w.Header().Get("Allow"))
+	}
+	api.expect(api.do(owner, "PATCH", "/api/servers/home", ""), http.StatusMethodNotAllowed)
+	api.expect(api.do(owner, "POST", "/api/servers/home/status", ""), http.StatusMethodNotAllowed)
+	api.expect(api.do(owner, "GET", "/api/update", ""), http.StatusMethodNotAllowed)
+	api.expect(api.do(owner, "GET", "/api/servers/home/reboot", ""), http.StatusNotFound)
+	api.expect(api.do(owner, "GET", "/api/servers/home/update/now", ""), http.StatusNotFound)
+	api.expect(api.do(owner, "GET", "/api/history?limit=0", ""), http.StatusBadRequest)
+
+	api.expect(api.do("nope", "GET", "/api/servers/home", ""), http.StatusUnauthorized)
+	api.expect(api.do(viewer, "DELETE", "/api/servers/home", ""), http.StatusForbidden)
+	api.expect(api.do(viewer, "POST", "/api/servers/home/update", ""), http.StatusForbidden)
+	api.expect(api.do(viewer, "PUT", "/api/servers/home", `{"token": "x"}`), http.StatusForbidden)
+}
+
+func TestServerAPIUpdateAndStatus(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/update":
+			w.Write([]byte(`{"updated": ["web"], "failed": []}`))
+		case "/v1/metrics":
+			w.Write([]byte("watchtower_containers_scanned 3\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer watchtower.Close()
+
+	api := newTestAPI(t)
+	owner := api.login(42)
+	api.expect(api.do(owner, "POST", "/api/update", ""), http.StatusNotFound)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "`+watchtower.URL+`", "token": "t"}`), http.StatusCreated)
+
+	w := api.do(owner, "POST", "/api/servers/home/update", "")
+	api.expect(w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"web"`) {
+		t.Errorf("unexpected update result: %s", w.Body)
+	}
+	api.expect(api.do(owner, "GET", "/api/servers/home/status", ""), http.StatusOK)
+	api.expect(api.do(owner, "GET", "/api/servers/gone/status", ""), http.StatusNotFound)
+
+	// A freeze answers 423 Locked
+	if _, err := api.server.serverManager.AddFreeze(42, servers.Freeze{Start: time.Now().Add(-time.Minute), End: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("AddFreeze: %v", err)
+	}
+	api.expect(api.do(owner, "POST", "/api/servers/home/update", ""), http.StatusLocked)
+}
+
+func TestServerAPIUpstreamTimeout(t *testing.T) {
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	defer watchtower.Close()
+
+	api := newTestAPI(t)
+	owner := api.login(42)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "`+watchtower.URL+`", "token": "t"}`), http.StatusCreated)
+
+	for _, req := range []struct{ method, path string }{
+		{"POST", "/api/servers/home/update"},
+		{"GET", "/api/servers/home/status"},
+	} {
+		w := api.do(owner, req.method, req.path, "")
+		if !strings.Contains(w.Body.String(), `"code":"gateway_timeout"`) {
+			t.Errorf("%s %s: expected a gateway_timeout envelope, got %s", req.method, req.path, w.Body)
+		}
+		api.expect(w, http.StatusGatewayTimeout)
+	}
+
+	w := api.do(owner, "POST", "/api/update/stream", "")
+	api.expect(w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"status":504`) {
+		t.Errorf("expected the failed event to carry 504: %s", w.Body)
+	}
+}
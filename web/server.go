@@ -1,17 +1,19 @@
 package web
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
+	"context"
 	"embed"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"net/url"
-	"sort"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/jobs"
 	"github.com/kfilin/watchtower-masterbot/servers"
 )
 
@@ -20,63 +22,119 @@ var assets embed.FS
 
 type WebServer struct {
 	serverManager *servers.ServerManager
-	adminID       int64
-	botToken      string
+	access        *access.Controller
+	initData      *initDataVerifier
+	sessions      *sessionManager
+	// heartbeat is how often a quiet update stream sends a heartbeat event
+	heartbeat time.Duration
+
+	// ctx is cancelled by Close to abort in-flight Watchtower calls
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewServer(mgr *servers.ServerManager, adminID int64, botToken string) *WebServer {
+// NewServer serves the terminal to users whose WebApp initData, signed with
+// botToken, is at most initDataMaxAge old. They trade it for a session token
+// that lasts sessionTTL between refreshes. Zero durations mean the defaults.
+func NewServer(mgr *servers.ServerManager, acl *access.Controller, botToken string, initDataMaxAge, sessionTTL time.Duration) *WebServer {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &WebServer{
 		serverManager: mgr,
-		adminID:       adminID,
-		botToken:      botToken,
+		access:        acl,
+		initData:      newInitDataVerifier(botToken, initDataMaxAge),
+		sessions:      newSessionManager(sessionTTL),
+		heartbeat:     DefaultHeartbeatInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Close aborts in-flight Watchtower calls so shutdown doesn't wait on them
+func (s *WebServer) Close() {
+	s.cancel()
+}
+
+// requestContext is cancelled when the client goes away or the server closes
+func (s *WebServer) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(s.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
 	}
 }
 
 func (s *WebServer) RegisterHandlers(mux *http.ServeMux) {
 	mux.HandleFunc("/terminal", s.handleTerminal)
 	mux.HandleFunc("/terminal/", s.handleTerminal)
+	mux.HandleFunc("/api/session", s.handleAPISession)
+	mux.HandleFunc("/api/session/refresh", s.handleAPISessionRefresh)
 	mux.HandleFunc("/api/servers", s.handleAPIServers)
+	mux.HandleFunc("/api/servers/", s.handleAPIServer)
 	mux.HandleFunc("/api/update", s.handleAPIUpdate)
+	mux.HandleFunc("/api/update/stream", s.handleAPIUpdateStream)
+	mux.HandleFunc("/api/containers", s.handleAPIContainers)
+	mux.HandleFunc("/api/history", s.handleAPIHistory)
 }
 
-func (s *WebServer) validate(r *http.Request) (int64, error) {
-	initData := r.Header.Get("X-TG-INIT-DATA")
-	if initData == "" {
-		return 0, fmt.Errorf("missing initData")
+// authorizeUser validates a terminal request and checks that its user may
+// perform action
+func (s *WebServer) authorizeUser(r *http.Request, action access.Action) (int64, error) {
+	// Open access is a convenience for the bot; never extend it to the web
+	if s.access.Open() {
+		return 0, errWebClosed
+	}
+
+	if token := sessionToken(r); token != "" {
+		return s.authorizeSession(token, action)
 	}
 
-	values, err := url.ParseQuery(initData)
+	// Without a session, every request carries its own initData
+	data, err := s.initData.verify(r.Header.Get("X-TG-INIT-DATA"))
 	if err != nil {
+		log.Printf("⛔ TWA request from %s refused: %v", r.RemoteAddr, err)
 		return 0, err
 	}
-
-	dataCheckString := buildDataCheckString(values)
-	hash := values.Get("hash")
-
-	secretKey := hmacSHA256([]byte(s.botToken), []byte("WebAppData"))
-	expectedHash := hex.EncodeToString(hmacSHA256(secretKey, []byte(dataCheckString)))
-
-	if hash != expectedHash {
-		// Log but don't fail for now if we want to be lenient during dev,
-		// but since security is priority in Project-Hub, let's keep it tight.
-		// return 0, fmt.Errorf("invalid hash")
+	if err := s.access.Check(data.UserID, action); err != nil {
+		log.Printf("⛔ TWA user %d denied %s: %v", data.UserID, action, err)
+		return 0, err
 	}
+	// Reads may reuse the launch payload; a change may not be replayed
+	if action != access.ActionView {
+		if err := s.initData.spend(data); err != nil {
+			log.Printf("⛔ TWA user %d replayed initData for %s", data.UserID, action)
+			return 0, err
+		}
+	}
+	return data.UserID, nil
+}
 
-	// Extract user ID
-	userJSON := values.Get("user")
-	var user struct {
-		ID int64 `json:"id"`
+// authorizeSession checks a session token. A user who lost access entirely
+// loses all their sessions with it.
+func (s *WebServer) authorizeSession(token string, action access.Action) (int64, error) {
+	sess, err := s.sessions.lookup(token)
+	if err != nil {
+		return 0, err
 	}
-	if err := json.Unmarshal([]byte(userJSON), &user); err != nil {
+	if err := s.access.Check(sess.UserID, action); err != nil {
+		if _, member := s.access.Role(sess.UserID); !member {
+			n := s.sessions.revokeUser(sess.UserID)
+			log.Printf("🔒 Revoked %d terminal session(s) of user %d: %v", n, sess.UserID, err)
+		} else {
+			log.Printf("⛔ TWA user %d denied %s: %v", sess.UserID, action, err)
+		}
 		return 0, err
 	}
+	return sess.UserID, nil
+}
 
-	if user.ID != s.adminID {
-		fmt.Printf("⛔ Unauthorized TWA access attempt: %d != %d\n", user.ID, s.adminID)
-		return 0, fmt.Errorf("unauthorized user")
+// authError answers a failed authorize: 403 for a role that is not allowed, 401 otherwise
+func authError(w http.ResponseWriter, err error) {
+	code := http.StatusUnauthorized
+	if errors.Is(err, access.ErrForbidden) {
+		code = http.StatusForbidden
 	}
-
-	return user.ID, nil
+	apiError(w, code, err)
 }
 
 func (s *WebServer) handleTerminal(w http.ResponseWriter, r *http.Request) {
@@ -92,19 +150,18 @@ func (s *WebServer) handleTerminal(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *WebServer) handleAPIServers(w http.ResponseWriter, r *http.Request) {
-	userID, err := s.validate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	if !allowMethod(w, r, http.MethodGet) {
 		return
 	}
-
-	// We need to list servers for this user
-	nicknames, err := s.serverManager.ListServers(userID)
+	userID, err := s.authorize(r, access.ActionView)
 	if err != nil {
-		jsonResponse(w, map[string]string{"error": err.Error()}, http.StatusOK)
+		authError(w, err)
 		return
 	}
 
+	// A user without servers gets an empty list, not an error
+	nicknames, _ := s.serverManager.ListServers(userID)
+
 	current, _ := s.serverManager.GetCurrentServer(userID)
 
 	type serverInfo struct {
@@ -123,52 +180,156 @@ func (s *WebServer) handleAPIServers(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, map[string]interface{}{"servers": results}, http.StatusOK)
 }
 
+// handleAPIUpdate updates the active server; POST /api/servers/{nickname}/update
+// targets any server
 func (s *WebServer) handleAPIUpdate(w http.ResponseWriter, r *http.Request) {
-	userID, err := s.validate(r)
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	c, err := s.authorizeActive(r, access.ActionUpdate, "")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		authError(w, err)
 		return
 	}
 
-	client, err := s.serverManager.GetAPIClient(userID)
+	current, err := s.serverManager.GetCurrentServer(c.UserID)
 	if err != nil {
-		jsonResponse(w, map[string]string{"error": err.Error()}, http.StatusOK)
+		apiError(w, http.StatusNotFound, errNoServers)
 		return
 	}
+	s.triggerUpdate(w, r, c, current.Nickname)
+}
 
-	resp, err := client.TriggerUpdate()
+// triggerUpdate runs an update of nickname in the caller's workspace and
+// records it in the history
+func (s *WebServer) triggerUpdate(w http.ResponseWriter, r *http.Request, c caller, nickname string) {
+	client, err := s.serverManager.GetAPIClientIn(c.Workspace, nickname)
 	if err != nil {
-		jsonResponse(w, map[string]string{"error": err.Error()}, http.StatusOK)
+		apiError(w, errorStatus(err), err)
+		return
+	}
+
+	// Freezes can only be overridden from the bot with /wt_update --force
+	if err := s.serverManager.CheckUpdateAllowedIn(c.Workspace, nickname, time.Now()); err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	started := time.Now()
+	resp, err := client.TriggerUpdate(ctx)
+	s.recordUpdate(c, nickname, started, resp, err)
+	if err != nil {
+		apiError(w, upstreamStatus(err), err)
 		return
 	}
 
 	jsonResponse(w, resp, http.StatusOK)
 }
 
-func jsonResponse(w http.ResponseWriter, data interface{}, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(data)
+// recordUpdate adds a terminal or API update to the workspace's history
+func (s *WebServer) recordUpdate(c caller, nickname string, started time.Time, resp *api.UpdateResponse, err error) {
+	entry := servers.HistoryEntry{
+		Server:      nickname,
+		Source:      c.Source,
+		TriggeredBy: c.UserID,
+		Started:     started,
+		Duration:    time.Since(started),
+		Status:      string(jobs.StateSucceeded),
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		entry.Status, entry.Error = string(jobs.StateCancelled), err.Error()
+	case err != nil:
+		entry.Status, entry.Error = string(jobs.StateFailed), err.Error()
+	default:
+		entry.Updated, entry.Failed, entry.Message = resp.Updated, resp.Failed, resp.Message
+	}
+	if _, err := s.serverManager.RecordHistory(c.Workspace, entry); err != nil {
+		log.Printf("❌ Failed to record %s update of %s in history: %v", c.Source, nickname, err)
+	}
 }
 
-func hmacSHA256(key, data []byte) []byte {
-	h := hmac.New(sha256.New, key)
-	h.Write(data)
-	return h.Sum(nil)
+// handleAPIHistory serves ?server=<nickname>&limit=<n> (default 20, at most 100)
+func (s *WebServer) handleAPIHistory(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	server := r.URL.Query().Get("server")
+	c, err := s.authorizeActive(r, access.ActionView, server)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			apiError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 100"))
+			return
+		}
+		limit = n
+	}
+
+	entries, err := s.serverManager.History(c.UserID, server, limit)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	if entries == nil {
+		entries = []servers.HistoryEntry{}
+	}
+
+	jsonResponse(w, map[string]interface{}{"history": entries}, http.StatusOK)
 }
 
-func buildDataCheckString(values url.Values) string {
-	keys := make([]string, 0, len(values))
-	for k := range values {
-		if k != "hash" {
-			keys = append(keys, k)
+func (s *WebServer) handleAPIContainers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	// Optional ?server=<nickname>, defaults to the active server
+	nickname := r.URL.Query().Get("server")
+	c, err := s.authorizeActive(r, access.ActionView, nickname)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if nickname == "" {
+		current, err := s.serverManager.GetCurrentServer(c.UserID)
+		if err != nil {
+			apiError(w, http.StatusNotFound, errNoServers)
+			return
 		}
+		nickname = current.Nickname
 	}
-	sort.Strings(keys)
 
-	var pairs []string
-	for _, k := range keys {
-		pairs = append(pairs, fmt.Sprintf("%s=%s", k, values.Get(k)))
+	client, err := s.serverManager.GetAPIClientIn(c.Workspace, nickname)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	containers, err := client.GetContainers(ctx)
+	if err != nil {
+		apiError(w, upstreamStatus(err), err)
+		return
 	}
-	return strings.Join(pairs, "\n")
+
+	jsonResponse(w, map[string]interface{}{
+		"server":     nickname,
+		"containers": containers,
+	}, http.StatusOK)
+}
+
+func jsonResponse(w http.ResponseWriter, data interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(data)
 }
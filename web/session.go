@@ -0,0 +1,274 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/access"
+)
+
+// DefaultSessionTTL is how long a terminal session token stays valid without a refresh
+const DefaultSessionTTL = 15 * time.Minute
+
+// maxSessionLifetime bounds a chain of refreshes; after it the terminal
+// exchanges fresh initData
+const maxSessionLifetime = 12 * time.Hour
+
+// sessionCookie carries the token for browsers; the terminal also sends it as a bearer token
+const sessionCookie = "wt_session"
+
+var (
+	errInvalidSession = errors.New("invalid session token")
+	errExpiredSession = errors.New("session expired")
+)
+
+// session is a terminal login bound to one Telegram user
+type session struct {
+	ID      string
+	UserID  int64
+	Started time.Time // when the initData was exchanged; kept across refreshes
+	Expires time.Time
+}
+
+// sessionClaims is the signed part of a token
+type sessionClaims struct {
+	ID      string `json:"sid"`
+	UserID  int64  `json:"uid"`
+	Expires int64  `json:"exp"`
+}
+
+// sessionManager issues signed session tokens and keeps the live sessions,
+// so that a token stops working as soon as its session is revoked
+type sessionManager struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionManager(ttl time.Duration) *sessionManager {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	// Tokens don't outlive the process; the terminal logs in again after a restart
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("web: no randomness for session keys: " + err.Error())
+	}
+	return &sessionManager{
+		key:      key,
+		ttl:      ttl,
+		now:      time.Now,
+		sessions: make(map[string]*session),
+	}
+}
+
+// issue starts a session for userID. started is when the user logged in.
+func (m *sessionManager) issue(userID int64, started time.Time) (string, *session, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	now := m.now()
+	sess := &session{
+		ID:      hex.EncodeToString(id),
+		UserID:  userID,
+		Started: started,
+		Expires: now.Add(m.ttl),
+	}
+	if limit := started.Add(maxSessionLifetime); sess.Expires.After(limit) {
+		sess.Expires = limit
+	}
+	if !sess.Expires.After(now) {
+		return "", nil, errExpiredSession
+	}
+
+	claims, _ := json.Marshal(sessionClaims{ID: sess.ID, UserID: userID, Expires: sess.Expires.Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(hmacSHA256(m.key, []byte(payload)))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(now)
+	m.sessions[sess.ID] = sess
+	copied := *sess
+	return token, &copied, nil
+}
+
+// lookup returns the live session a token belongs to
+func (m *sessionManager) lookup(token string) (*session, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidSession
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, hmacSHA256(m.key, []byte(payload))) {
+		return nil, errInvalidSession
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidSession
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, errInvalidSession
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[claims.ID]
+	if !ok || sess.UserID != claims.UserID {
+		return nil, errInvalidSession
+	}
+	if !m.now().Before(sess.Expires) {
+		delete(m.sessions, sess.ID)
+		return nil, errExpiredSession
+	}
+	copied := *sess
+	return &copied, nil
+}
+
+// revoke ends a session; its token is refused from now on
+func (m *sessionManager) revoke(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
+
+// revokeUser ends every session of userID and reports how many there were
+func (m *sessionManager) revokeUser(userID int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, sess := range m.sessions {
+		if sess.UserID == userID {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *sessionManager) prune(now time.Time) {
+	for id, sess := range m.sessions {
+		if !now.Before(sess.Expires) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// sessionToken reads a token from "Authorization: Bearer" or the session cookie
+func sessionToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// handleAPISession exchanges initData for a session token (POST) and logs
+// out (DELETE)
+func (s *WebServer) handleAPISession(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		s.sessionLogin(w, r)
+	} else {
+		s.sessionLogout(w, r)
+	}
+}
+
+func (s *WebServer) sessionLogin(w http.ResponseWriter, r *http.Request) {
+	if s.access.Open() {
+		authError(w, errWebClosed)
+		return
+	}
+	data, err := s.initData.verify(r.Header.Get("X-TG-INIT-DATA"))
+	if err != nil {
+		log.Printf("⛔ TWA login from %s refused: %v", r.RemoteAddr, err)
+		authError(w, err)
+		return
+	}
+	if err := s.access.Check(data.UserID, access.ActionView); err != nil {
+		log.Printf("⛔ TWA user %d denied a session: %v", data.UserID, err)
+		authError(w, err)
+		return
+	}
+	// One launch payload buys one session, so a captured one is worthless
+	if err := s.initData.spend(data); err != nil {
+		log.Printf("⛔ TWA user %d replayed initData for a session", data.UserID)
+		authError(w, err)
+		return
+	}
+
+	s.startSession(w, data.UserID, s.sessions.now())
+}
+
+// handleAPISessionRefresh swaps a live session for a new one with a fresh expiry
+func (s *WebServer) handleAPISessionRefresh(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	sess, err := s.sessions.lookup(sessionToken(r))
+	if err == nil {
+		err = s.access.Check(sess.UserID, access.ActionView)
+	}
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	s.sessions.revoke(sess.ID)
+	s.startSession(w, sess.UserID, sess.Started)
+}
+
+func (s *WebServer) sessionLogout(w http.ResponseWriter, r *http.Request) {
+	if sess, err := s.sessions.lookup(sessionToken(r)); err == nil {
+		s.sessions.revoke(sess.ID)
+		log.Printf("🔒 TWA user %d logged out", sess.UserID)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/api", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteStrictMode})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *WebServer) startSession(w http.ResponseWriter, userID int64, started time.Time) {
+	token, sess, err := s.sessions.issue(userID, started)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/api",
+		Expires:  sess.Expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	jsonResponse(w, map[string]interface{}{
+		"token":      token,
+		"user_id":    userID,
+		"expires_at": sess.Expires,
+	}, http.StatusOK)
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionTokens(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := newSessionManager(time.Minute)
+	m.now = func() time.Time { return now }
+
+	token, sess, err := m.issue(42, now)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if got, err := m.lookup(token); err != nil || got.UserID != 42 || got.ID != sess.ID {
+		t.Fatalf("lookup: %+v, %v", got, err)
+	}
+
+	// A token signed by another process, or altered, is refused
+	other := newSessionManager(time.Minute)
+	forged, _, _ := other.issue(42, now)
+	payload, sig, _ := strings.Cut(token, ".")
+	for name, bad := range map[string]string{
+		"empty":        "",
+		"no signature": payload,
+		"other key":    forged,
+		"swapped sig":  payload + "." + strings.Repeat("A", len(sig)),
+	} {
+		if _, err := m.lookup(bad); !errors.Is(err, errInvalidSession) {
+			t.Errorf("%s: expected errInvalidSession, got %v", name, err)
+		}
+	}
+
+	m.now = func() time.Time { return now.Add(time.Minute) }
+	if _, err := m.lookup(token); !errors.Is(err, errExpiredSession) {
+		t.Errorf("expected errExpiredSession, got %v", err)
+	}
+
+	// Refreshes never stretch a login past maxSessionLifetime
+	m.now = func() time.Time { return now.Add(maxSessionLifetime - 10*time.Second) }
+	_, sess, err = m.issue(42, now)
+	if err != nil || !sess.Expires.Equal(now.Add(maxSessionLifetime)) {
+		t.Errorf("expected expiry capped at the lifetime, got %+v, %v", sess, err)
+	}
+	m.now = func() time.Time { return now.Add(maxSessionLifetime) }
+	if _, _, err := m.issue(42, now); !errors.Is(err, errExpiredSession) {
+		t.Errorf("expected errExpiredSession past the lifetime, got %v", err)
+	}
+}
+
+func TestSessionRevocation(t *testing.T) {
+	m := newSessionManager(time.Minute)
+	a, sessA, _ := m.issue(42, time.Now())
+	b, _, _ := m.issue(42, time.Now())
+	c, _, _ := m.issue(7, time.Now())
+
+	m.revoke(sessA.ID)
+	if _, err := m.lookup(a); !errors.Is(err, errInvalidSession) {
+		t.Errorf("expected a revoked token to fail, got %v", err)
+	}
+	if n := m.revokeUser(42); n != 1 {
+		t.Errorf("expected 1 more session of user 42, got %d", n)
+	}
+	if _, err := m.lookup(b); err == nil {
+		t.Error("expected every session of user 42 to be revoked")
+	}
+	if _, err := m.lookup(c); err != nil {
+		t.Errorf("user 7 should keep their session: %v", err)
+	}
+}
+
+func TestSessionEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	do := func(method, path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	bearer := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+	tokenOf := func(w *httptest.ResponseRecorder) string {
+		var body struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		return body.Token
+	}
+
+	if w := do("GET", "/api/session", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/session: expected 405, got %d", w.Code)
+	}
+
+	launch := map[string]string{"X-TG-INIT-DATA": signInitData(testBotToken, launchFields(42, time.Now()))}
+	w := do("POST", "/api/session", launch)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	cookie := w.Result().Cookies()
+	if len(cookie) != 1 || cookie[0].Name != sessionCookie || !cookie[0].HttpOnly {
+		t.Errorf("expected an HttpOnly session cookie, got %+v", cookie)
+	}
+	token := tokenOf(w)
+
+	// The launch payload is spent on the login
+	if w := do("POST", "/api/session", launch); w.Code != http.StatusUnauthorized {
+		t.Errorf("second login with the same initData: expected 401, got %d", w.Code)
+	}
+
+	if w := do("GET", "/api/history", bearer(token)); w.Code != http.StatusOK {
+		t.Errorf("history with bearer: %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/api/history", map[string]string{"Cookie": cookie[0].String()}); w.Code != http.StatusOK {
+		t.Errorf("history with cookie: %d %s", w.Code, w.Body)
+	}
+
+	w = do("POST", "/api/session/refresh", bearer(token))
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: %d %s", w.Code, w.Body)
+	}
+	refreshed := tokenOf(w)
+	if w := do("GET", "/api/history", bearer(token)); w.Code != http.StatusUnauthorized {
+		t.Errorf("refreshed-away token: expected 401, got %d", w.Code)
+	}
+
+	if w := do("DELETE", "/api/session", bearer(refreshed)); w.Code != http.StatusNoContent {
+		t.Errorf("logout: %d", w.Code)
+	}
+	if w := do("GET", "/api/history", bearer(refreshed)); w.Code != http.StatusUnauthorized {
+		t.Errorf("logged-out token: expected 401, got %d", w.Code)
+	}
+
+	// A viewer's session still can't update
+	viewer := tokenOf(do("POST", "/api/session", map[string]string{
+		"X-TG-INIT-DATA": signInitData(testBotToken, launchFields(7, time.Now())),
+	}))
+	if w := do("POST", "/api/update", bearer(viewer)); w.Code != http.StatusForbidden {
+		t.Errorf("viewer update: expected 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/access"
+	"github.com/kfilin/watchtower-masterbot/internal/api"
+	"github.com/kfilin/watchtower-masterbot/jobs"
+)
+
+// DefaultHeartbeatInterval keeps proxies from closing a quiet update stream
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// eventStream writes Server-Sent Events; only the handler goroutine may use it
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported by this connection")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses unless told otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &eventStream{w: w, flusher: flusher}, nil
+}
+
+// send writes one event; a client that went away is noticed through the
+// request context, so write errors are ignored
+func (e *eventStream) send(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("❌ Failed to encode %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, payload)
+	e.flusher.Flush()
+}
+
+// handleAPIUpdateStream updates the active server, or ?server=<nickname>, and
+// streams its progress as events: queued, request, heartbeat, response, one
+// container event per container, and finally done or failed. Errors found
+// before the update starts are answered with the usual JSON envelope.
+func (s *WebServer) handleAPIUpdateStream(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	nickname := r.URL.Query().Get("server")
+	c, err := s.authorizeActive(r, access.ActionUpdate, nickname)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if nickname == "" {
+		current, err := s.serverManager.GetCurrentServer(c.UserID)
+		if err != nil {
+			apiError(w, http.StatusNotFound, errNoServers)
+			return
+		}
+		nickname = current.Nickname
+	}
+	client, err := s.serverManager.GetAPIClientIn(c.Workspace, nickname)
+	if err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+	// Freezes can only be overridden from the bot with /wt_update --force
+	if err := s.serverManager.CheckUpdateAllowedIn(c.Workspace, nickname, time.Now()); err != nil {
+		apiError(w, errorStatus(err), err)
+		return
+	}
+
+	stream, err := newEventStream(w)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	started := time.Now()
+	stream.send("queued", map[string]interface{}{"server": nickname, "started": started})
+
+	type outcome struct {
+		resp *api.UpdateResponse
+		err  error
+	}
+	finished := make(chan outcome, 1)
+	go func() {
+		resp, err := client.TriggerUpdate(ctx)
+		finished <- outcome{resp, err}
+	}()
+	stream.send("request", map[string]interface{}{"server": nickname})
+	log.Printf("🌐 User %d streaming update of %s", c.UserID, nickname)
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+
+	var result outcome
+wait:
+	for {
+		select {
+		case <-heartbeat.C:
+			stream.send("heartbeat", map[string]interface{}{"elapsed": int(time.Since(started).Seconds())})
+		case result = <-finished:
+			break wait
+		}
+	}
+
+	s.recordUpdate(c, nickname, started, result.resp, result.err)
+	duration := time.Since(started)
+	if result.err != nil {
+		state := jobs.StateFailed
+		if errors.Is(result.err, context.Canceled) {
+			state = jobs.StateCancelled
+		}
+		stream.send("failed", map[string]interface{}{
+			"state":       state,
+			"error":       result.err.Error(),
+			"status":      upstreamStatus(result.err),
+			"duration_ms": duration.Milliseconds(),
+		})
+		return
+	}
+
+	resp := result.resp
+	stream.send("response", map[string]interface{}{
+		"updated": len(resp.Updated),
+		"failed":  len(resp.Failed),
+		"message": resp.Message,
+	})
+	for _, name := range resp.Updated {
+		stream.send("container", jobs.Result{Container: name, Status: "updated"})
+	}
+	for _, name := range resp.Failed {
+		stream.send("container", jobs.Result{Container: name, Status: "failed"})
+	}
+	stream.send("done", map[string]interface{}{
+		"state":       jobs.StateSucceeded,
+		"server":      nickname,
+		"updated":     len(resp.Updated),
+		"failed":      len(resp.Failed),
+		"duration_ms": duration.Milliseconds(),
+	})
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kfilin/watchtower-masterbot/servers"
+)
+
+// streamEvents lists the event names of an SSE body in order
+func streamEvents(body string) []string {
+	var events []string
+	for _, line := range strings.Split(body, "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			events = append(events, name)
+		}
+	}
+	return events
+}
+
+func TestUpdateStream(t *testing.T) {
+	status := http.StatusOK
+	watchtower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"updated": ["web", "db"], "failed": ["cache"]}`))
+	}))
+	defer watchtower.Close()
+
+	api := newTestAPI(t)
+	api.server.heartbeat = 10 * time.Millisecond
+	owner := api.login(42)
+	viewer := api.login(7)
+
+	api.expect(api.do(owner, "POST", "/api/update/stream", ""), http.StatusNotFound)
+	api.expect(api.do(owner, "POST", "/api/servers/home", `{"url": "`+watchtower.URL+`", "token": "t"}`), http.StatusCreated)
+	api.expect(api.do(owner, "GET", "/api/update/stream", ""), http.StatusMethodNotAllowed)
+	api.expect(api.do(viewer, "POST", "/api/update/stream", ""), http.StatusForbidden)
+	api.expect(api.do(owner, "POST", "/api/update/stream?server=gone", ""), http.StatusNotFound)
+
+	w := api.do(owner, "POST", "/api/update/stream", "")
+	api.expect(w, http.StatusOK)
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+	events := strings.Join(streamEvents(w.Body.String()), " ")
+	if !strings.HasPrefix(events, "queued request heartbeat") ||
+		!strings.HasSuffix(events, "response container container container done") {
+		t.Errorf("unexpected events: %s", events)
+	}
+	if !strings.Contains(w.Body.String(), `{"container":"cache","status":"failed"}`) {
+		t.Errorf("missing per-container result: %s", w.Body)
+	}
+
+	status = http.StatusInternalServerError
+	w = api.do(owner, "POST", "/api/update/stream?server=home", "")
+	api.expect(w, http.StatusOK)
+	if events := streamEvents(w.Body.String()); events[len(events)-1] != "failed" {
+		t.Errorf("expected a failed event, got %v", events)
+	}
+
+	entries, err := api.server.serverManager.History(42, "home", 10)
+	if err != nil || len(entries) != 2 || entries[0].Source != servers.SourceWeb {
+		t.Errorf("expected both streamed updates in the history, got %+v (%v)", entries, err)
+	}
+
+	// A freeze is refused before the stream starts
+	if _, err := api.server.serverManager.AddFreeze(42, servers.Freeze{Start: time.Now().Add(-time.Minute), End: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("AddFreeze: %v", err)
+	}
+	api.expect(api.do(owner, "POST", "/api/update/stream", ""), http.StatusLocked)
+}